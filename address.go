@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Address normalization steps, applied in this order whatever order they
+// are configured in
+const (
+	addressStepNFC           = "nfc"
+	addressStepWhitespace    = "whitespace"
+	addressStepAbbreviations = "abbreviations"
+	addressStepCountry       = "country"
+)
+
+var addressSteps = []string{addressStepNFC, addressStepWhitespace, addressStepAbbreviations, addressStepCountry}
+
+// Street abbreviations expanded by the abbreviations step, matched as whole
+// words ignoring case, with or without a trailing period
+var addressAbbreviations = map[string]string{
+	"rd":   "Road",
+	"st":   "Street",
+	"ave":  "Avenue",
+	"ln":   "Lane",
+	"hwy":  "Highway",
+	"blvd": "Boulevard",
+	"sec":  "Sector",
+	"blk":  "Block",
+	"apt":  "Apartment",
+	"bldg": "Building",
+}
+
+var addressAbbreviationPattern = func() *regexp.Regexp {
+	words := make([]string, 0, len(addressAbbreviations))
+	for word := range addressAbbreviations {
+		words = append(words, word)
+	}
+	return regexp.MustCompile(`(?i)\b(` + strings.Join(words, "|") + `)\b\.?`)
+}()
+
+// Whitespace before commas, left by collapsing runs of spaces
+var spaceBeforeComma = regexp.MustCompile(` +,`)
+
+// addressNormalizer rewrites addresses so variants of the same place
+// compare equal
+type addressNormalizer struct {
+	steps map[string]bool
+
+	// Country names stripped from the end of addresses
+	countries []string
+}
+
+// Parse the comma-separated steps; nil when there are none
+func newAddressNormalizer(steps, countries string) (*addressNormalizer, error) {
+	n := &addressNormalizer{steps: map[string]bool{}}
+	for _, step := range strings.Split(steps, ",") {
+		step = strings.ToLower(strings.TrimSpace(step))
+		if step == "" {
+			continue
+		}
+		if !contains(addressSteps, step) {
+			return nil, fmt.Errorf("ADDRESS_NORMALIZE: unknown step %q, must be one of %s", step, strings.Join(addressSteps, ", "))
+		}
+		n.steps[step] = true
+	}
+	if len(n.steps) == 0 {
+		return nil, nil
+	}
+	for _, country := range strings.Split(countries, ",") {
+		if country = strings.TrimSpace(country); country != "" {
+			n.countries = append(n.countries, country)
+		}
+	}
+	return n, nil
+}
+
+func (n *addressNormalizer) normalize(address string) string {
+	if n.steps[addressStepNFC] {
+		address = norm.NFC.String(address)
+	}
+	if n.steps[addressStepWhitespace] {
+		address = spaceBeforeComma.ReplaceAllString(strings.Join(strings.Fields(address), " "), ",")
+	}
+	if n.steps[addressStepAbbreviations] {
+		address = addressAbbreviationPattern.ReplaceAllStringFunc(address, func(match string) string {
+			return addressAbbreviations[strings.ToLower(strings.TrimSuffix(match, "."))]
+		})
+	}
+	if n.steps[addressStepCountry] {
+		address = n.stripCountry(address)
+	}
+	return address
+}
+
+// Strip a trailing ", <country>", ignoring case
+func (n *addressNormalizer) stripCountry(address string) string {
+	trimmed := strings.TrimRight(address, " ,.")
+	for _, country := range n.countries {
+		if len(trimmed) <= len(country) || !strings.EqualFold(trimmed[len(trimmed)-len(country):], country) {
+			continue
+		}
+		rest := trimmed[:len(trimmed)-len(country)]
+		if stripped := strings.TrimRight(rest, " "); strings.HasSuffix(stripped, ",") {
+			return strings.TrimRight(stripped, " ,")
+		}
+	}
+	return address
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+)
+
+var (
+	zipMagic = []byte("PK\x03\x04")
+	tarMagic = []byte("ustar") // At offset 257 of the first header
+)
+
+// archiveReader steps through the members of an archive
+type archiveReader interface {
+	// The next member matching the pattern, io.EOF after the last
+	next() (name string, r io.Reader, err error)
+}
+
+// Whether an archive member name matches the pattern, by full path or
+// base name
+func matchMember(pattern, name string) bool {
+	if ok, _ := path.Match(pattern, name); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern, path.Base(name))
+	return ok
+}
+
+// If the input is a ZIP or TAR archive, read its members matching the
+// pattern one after another, starting with the first. TAR archives are
+// streamed, so may be compressed or come from a URL; ZIP archives need a
+// local file.
+func (in *input) openArchive(pattern string) error {
+	if in.table != nil {
+		return nil
+	}
+	buffered := bufio.NewReader(in.Reader)
+	in.Reader = buffered
+
+	head, err := buffered.Peek(len(tarMagic) + 257)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, zipMagic):
+		if in.file == nil || in.compression != compressionNone {
+			return fmt.Errorf("ZIP archives must be uncompressed local files, use a TAR archive to stream")
+		}
+		zr, err := zip.NewReader(in.file, in.size)
+		if err != nil {
+			return err
+		}
+		archive := &zipArchive{}
+		in.size = 0
+		for _, f := range zr.File {
+			if !f.FileInfo().IsDir() && matchMember(pattern, f.Name) {
+				archive.files = append(archive.files, f)
+				in.size += int64(f.UncompressedSize64)
+			}
+		}
+		in.closers = append(in.closers, archive)
+
+		// Progress counts the uncompressed bytes of the members
+		in.counter = &countingReader{}
+		in.archive = archive
+
+	case len(head) > 257 && bytes.HasPrefix(head[257:], tarMagic):
+		// Progress counts the source bytes, compressed or not
+		source := io.Reader(buffered)
+		if in.counter == nil {
+			in.counter = &countingReader{r: buffered}
+			source = in.counter
+		}
+		in.archive = &tarArchive{tr: tar.NewReader(source), pattern: pattern}
+
+	default:
+		return nil
+	}
+
+	if err := in.nextMember(); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("archive has no members matching %q", pattern)
+		}
+		return err
+	}
+	return nil
+}
+
+// Move on to the next archive member, decoded like the first; io.EOF after
+// the last
+func (in *input) nextMember() error {
+	name, r, err := in.archive.next()
+	if err != nil {
+		return err
+	}
+	slog.Info("Reading archive member", "member", name)
+
+	if _, ok := in.archive.(*zipArchive); ok {
+		in.counter.r = r
+		r = in.counter
+	}
+	in.member = name
+	in.Reader = r
+	if in.requestedEncoding != "" {
+		return in.decode(in.requestedEncoding)
+	}
+	return nil
+}
+
+// zipArchive reads the matching files of a ZIP archive
+type zipArchive struct {
+	files   []*zip.File
+	current io.ReadCloser
+}
+
+func (a *zipArchive) next() (string, io.Reader, error) {
+	if err := a.Close(); err != nil {
+		return "", nil, err
+	}
+	if len(a.files) == 0 {
+		return "", nil, io.EOF
+	}
+	f := a.files[0]
+	a.files = a.files[1:]
+
+	r, err := f.Open()
+	if err != nil {
+		return "", nil, fmt.Errorf("opening archive member %s: %w", f.Name, err)
+	}
+	a.current = r
+	return f.Name, r, nil
+}
+
+// Close the member being read
+func (a *zipArchive) Close() error {
+	if a.current == nil {
+		return nil
+	}
+	err := a.current.Close()
+	a.current = nil
+	return err
+}
+
+// tarArchive streams the matching regular files of a TAR archive
+type tarArchive struct {
+	tr      *tar.Reader
+	pattern string
+}
+
+func (a *tarArchive) next() (string, io.Reader, error) {
+	for {
+		hdr, err := a.tr.Next()
+		if err != nil {
+			return "", nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && matchMember(a.pattern, hdr.Name) {
+			return hdr.Name, a.tr, nil
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Suffix of the append-only audit log of what each run did, as JSON lines
+const auditFile = "_audit.jsonl"
+
+// auditLog appends events to the audit file, rolled into parts like the
+// rejects file
+type auditLog struct {
+	mu       sync.Mutex
+	file     *rollingFile
+	encoder  *json.Encoder
+	csvFile  string
+	importID string
+}
+
+func openAuditLog(cfg Config, importID string) (*auditLog, error) {
+	file, err := appendRollingFile(cfg.outputs.audit, cfg.AuditCompress, cfg.AuditMaxSize, cfg.AuditMaxFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{file: file, encoder: json.NewEncoder(file), csvFile: cfg.CSVFile, importID: importID}, nil
+}
+
+// Record an event with its details
+func (a *auditLog) record(event string, details map[string]any) error {
+	entry := map[string]any{
+		"time":     time.Now().UTC(),
+		"event":    event,
+		"csvFile":  a.csvFile,
+		"importId": a.importID,
+	}
+	for key, value := range details {
+		entry[key] = value
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.encoder.Encode(entry); err != nil {
+		return err
+	}
+	if err := a.file.flush(); err != nil {
+		return err
+	}
+	if a.file.full() {
+		return a.file.roll()
+	}
+	return nil
+}
+
+func (a *auditLog) Close() error {
+	return a.file.Close()
+}
+
+// SHA-256 of the header column names, as compliance evidence of the schema
+func headerHash(names []string) string {
+	data, _ := json.Marshal(names)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// What happens to rows with points outside the bounding box
+const (
+	bboxModeReject = "reject"
+	bboxModeFlag   = "flag"
+)
+
+// Named bounding boxes accepted for GEO_BBOX
+var namedBoundingBoxes = map[string]boundingBox{
+	"bangladesh": {MinLon: 88.0, MinLat: 20.5, MaxLon: 92.7, MaxLat: 26.7},
+}
+
+// boundingBox is a west,south,east,north box the points are expected in
+type boundingBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+// Whether a box is configured
+func (b boundingBox) set() bool {
+	return b != boundingBox{}
+}
+
+// Whether the point is inside the box, edges included
+func (b boundingBox) contains(lon, lat float64) bool {
+	return lon >= b.MinLon && lon <= b.MaxLon && lat >= b.MinLat && lat <= b.MaxLat
+}
+
+// Geo fields of the place with points outside the box
+func (b boundingBox) outside(place *Place) []string {
+	var fields []string
+	if loc := place.Location; loc != nil && !b.contains(loc.Coordinates[0], loc.Coordinates[1]) {
+		fields = append(fields, "location")
+	}
+	for name, value := range place.Extra {
+		if loc, ok := value.(*Location); ok && loc != nil && !b.contains(loc.Coordinates[0], loc.Coordinates[1]) {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+func (b boundingBox) String() string {
+	if !b.set() {
+		return ""
+	}
+	return fmt.Sprintf("%g,%g,%g,%g", b.MinLon, b.MinLat, b.MaxLon, b.MaxLat)
+}
+
+// Parse "minLon,minLat,maxLon,maxLat", the GeoJSON bbox order, or the name
+// of a known box such as bangladesh
+func (b *boundingBox) Set(value string) error {
+	if named, ok := namedBoundingBoxes[strings.ToLower(strings.TrimSpace(value))]; ok {
+		*b = named
+		return nil
+	}
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return fmt.Errorf("bounding box %q must be minLon,minLat,maxLon,maxLat", value)
+	}
+	var values [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return fmt.Errorf("bounding box %q: %w", value, err)
+		}
+		values[i] = v
+	}
+	parsed := boundingBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	if parsed.MinLon >= parsed.MaxLon || parsed.MinLat >= parsed.MaxLat {
+		return fmt.Errorf("bounding box %q: minimums must be less than maximums", value)
+	}
+	*b = parsed
+	return nil
+}
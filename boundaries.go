@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Boundary modes
+const (
+	boundariesValidate = "validate"
+	boundariesFill     = "fill"
+)
+
+// Administrative levels looked up in the boundary file, widest first
+var boundaryLevels = []string{"division", "district"}
+
+// boundaryMismatch records a row whose administrative field disagrees with
+// the boundary its coordinates fall in
+type boundaryMismatch struct {
+	Field    string `json:"field" bson:"field"`
+	Value    string `json:"value" bson:"value"`
+	Boundary string `json:"boundary" bson:"boundary"`
+}
+
+// boundary is one named polygon or multipolygon
+type boundary struct {
+	name     string
+	level    string
+	polygons [][][][2]float64 // polygon -> ring -> point; first ring is the outer one
+	min, max [2]float64
+}
+
+// boundaries is a set of division and district polygons from a GeoJSON
+// FeatureCollection, each feature with "name" and "level" properties
+type boundaries struct {
+	mode  string
+	items []boundary
+}
+
+// Load the boundary file, nil when none is configured
+func loadBoundaries(path, mode string) (*boundaries, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var collection struct {
+		Features []struct {
+			Properties map[string]any `json:"properties"`
+			Geometry   struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("parsing boundary file %s: %w", path, err)
+	}
+
+	b := &boundaries{mode: mode}
+	for i, feature := range collection.Features {
+		name, _ := feature.Properties["name"].(string)
+		level, _ := feature.Properties["level"].(string)
+		if name == "" || !contains(boundaryLevels, level) {
+			return nil, fmt.Errorf("boundary feature %d needs a name and a level of %s", i, strings.Join(boundaryLevels, " or "))
+		}
+
+		item := boundary{name: name, level: level}
+		switch feature.Geometry.Type {
+		case "Polygon":
+			var polygon [][][2]float64
+			err = json.Unmarshal(feature.Geometry.Coordinates, &polygon)
+			item.polygons = [][][][2]float64{polygon}
+		case "MultiPolygon":
+			err = json.Unmarshal(feature.Geometry.Coordinates, &item.polygons)
+		default:
+			err = fmt.Errorf("unsupported geometry type %q", feature.Geometry.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("boundary %s: %w", name, err)
+		}
+		item.bound()
+		b.items = append(b.items, item)
+	}
+	return b, nil
+}
+
+// Compute the bounding box, so most points are ruled out cheaply
+func (b *boundary) bound() {
+	b.min = [2]float64{180, 90}
+	b.max = [2]float64{-180, -90}
+	for _, polygon := range b.polygons {
+		if len(polygon) == 0 {
+			continue
+		}
+		for _, p := range polygon[0] {
+			for axis := 0; axis < 2; axis++ {
+				b.min[axis] = min(b.min[axis], p[axis])
+				b.max[axis] = max(b.max[axis], p[axis])
+			}
+		}
+	}
+}
+
+// Whether the [longitude, latitude] point lies inside the boundary
+func (b *boundary) contains(point [2]float64) bool {
+	if point[0] < b.min[0] || point[0] > b.max[0] || point[1] < b.min[1] || point[1] > b.max[1] {
+		return false
+	}
+	for _, polygon := range b.polygons {
+		if len(polygon) == 0 || !ringContains(polygon[0], point) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if ringContains(hole, point) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// Ray casting point-in-polygon test
+func ringContains(ring [][2]float64, point [2]float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > point[1]) != (b[1] > point[1]) &&
+			point[0] < (b[0]-a[0])*(point[1]-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Name of the boundary at each level containing the point
+func (b *boundaries) lookup(point [2]float64) map[string]string {
+	names := map[string]string{}
+	for i := range b.items {
+		item := &b.items[i]
+		if _, found := names[item.level]; found {
+			continue
+		}
+		if item.contains(point) {
+			names[item.level] = item.name
+		}
+	}
+	return names
+}
+
+// Check the place's division and district against the boundaries its
+// location falls in, filling empty ones in fill mode. Returns the fields
+// filled and the mismatches found.
+func (b *boundaries) apply(place *Place) (filled int, mismatches []boundaryMismatch) {
+	if place.Location == nil {
+		return 0, nil
+	}
+
+	names := b.lookup(place.Location.Coordinates)
+	fields := map[string]*string{"division": &place.Division, "district": &place.District}
+	for _, level := range boundaryLevels {
+		name, found := names[level]
+		if !found {
+			continue
+		}
+		value := fields[level]
+		switch {
+		case *value == "":
+			if b.mode == boundariesFill {
+				*value = name
+				filled++
+			}
+		case !strings.EqualFold(strings.TrimSpace(*value), name):
+			mismatches = append(mismatches, boundaryMismatch{Field: level, Value: *value, Boundary: name})
+		}
+	}
+	return filled, mismatches
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Checkpoint backends
+const (
+	checkpointBackendFile    = "file"
+	checkpointBackendMongoDB = "mongodb"
+	checkpointBackendRedis   = "redis"
+	checkpointBackendS3      = "s3"
+)
+
+// Prefix of the Redis keys checkpoints are kept under
+const checkpointRedisPrefix = "seeder:checkpoint:"
+
+// checkpointStore keeps the progress file contents runs resume from, each
+// under its progress file's name
+type checkpointStore interface {
+	// The checkpoint saved under name, nil if there is none
+	load(ctx context.Context, name string) ([]byte, error)
+	save(ctx context.Context, name string, data []byte) error
+	remove(ctx context.Context, name string) error
+	io.Closer
+}
+
+// Connect to the configured checkpoint backend
+func openCheckpointStore(ctx context.Context, cfg Config) (checkpointStore, error) {
+	switch cfg.CheckpointBackend {
+	case checkpointBackendMongoDB:
+		clientOpts, _, err := clientOptions(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		client, err := mongo.Connect(ctx, clientOpts)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to the checkpoint database: %w", err)
+		}
+		return mongoCheckpoints{client: client, collection: client.Database(cfg.DBName).Collection(cfg.CheckpointCollection)}, nil
+	case checkpointBackendRedis:
+		opts, err := redis.ParseURL(cfg.CheckpointURL)
+		if err != nil {
+			return nil, fmt.Errorf("CHECKPOINT_URL: %w", err)
+		}
+		return redisCheckpoints{redis.NewClient(opts)}, nil
+	case checkpointBackendS3:
+		store, err := newObjectStore(ctx, cfg.CheckpointURL, cfg.CheckpointEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		return objectCheckpoints{store}, nil
+	default:
+		return fileCheckpoints{}, nil
+	}
+}
+
+// Remove the named checkpoint, so the file is seeded afresh next time
+func clearCheckpoint(ctx context.Context, cfg Config, name string) error {
+	checkpoints, err := openCheckpointStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer checkpoints.Close()
+	return checkpoints.remove(ctx, name)
+}
+
+// fileCheckpoints keeps checkpoints in the progress files themselves
+type fileCheckpoints struct{}
+
+func (fileCheckpoints) load(ctx context.Context, name string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (fileCheckpoints) save(ctx context.Context, name string, data []byte) error {
+	return os.WriteFile(name, data, 0644)
+}
+
+func (fileCheckpoints) remove(ctx context.Context, name string) error {
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (fileCheckpoints) Close() error { return nil }
+
+// mongoCheckpoints keeps a document per checkpoint, with the progress file
+// name as its _id
+type mongoCheckpoints struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+func (c mongoCheckpoints) load(ctx context.Context, name string) ([]byte, error) {
+	var doc struct {
+		Data string `bson:"data"`
+	}
+	err := c.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(doc.Data), nil
+}
+
+func (c mongoCheckpoints) save(ctx context.Context, name string, data []byte) error {
+	_, err := c.collection.ReplaceOne(ctx, bson.M{"_id": name},
+		bson.M{"_id": name, "data": string(data), "updatedAt": time.Now()},
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+func (c mongoCheckpoints) remove(ctx context.Context, name string) error {
+	_, err := c.collection.DeleteOne(ctx, bson.M{"_id": name})
+	return err
+}
+
+func (c mongoCheckpoints) Close() error {
+	return c.client.Disconnect(context.Background())
+}
+
+// redisCheckpoints keeps a key per checkpoint
+type redisCheckpoints struct {
+	client *redis.Client
+}
+
+func (c redisCheckpoints) load(ctx context.Context, name string) ([]byte, error) {
+	data, err := c.client.Get(ctx, checkpointRedisPrefix+name).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (c redisCheckpoints) save(ctx context.Context, name string, data []byte) error {
+	return c.client.Set(ctx, checkpointRedisPrefix+name, data, 0).Err()
+}
+
+func (c redisCheckpoints) remove(ctx context.Context, name string) error {
+	return c.client.Del(ctx, checkpointRedisPrefix+name).Err()
+}
+
+func (c redisCheckpoints) Close() error {
+	return c.client.Close()
+}
+
+// objectCheckpoints keeps an object per checkpoint under the store's prefix
+type objectCheckpoints struct {
+	store *objectStore
+}
+
+func (c objectCheckpoints) load(ctx context.Context, name string) ([]byte, error) {
+	out, err := c.store.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.store.bucket),
+		Key:    aws.String(c.store.key(filepath.ToSlash(name))),
+	})
+	var missing *s3types.NoSuchKey
+	if errors.As(err, &missing) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+func (c objectCheckpoints) save(ctx context.Context, name string, data []byte) error {
+	_, err := c.store.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(c.store.bucket),
+		Key:           aws.String(c.store.key(filepath.ToSlash(name))),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+	})
+	return err
+}
+
+func (c objectCheckpoints) remove(ctx context.Context, name string) error {
+	_, err := c.store.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.store.bucket),
+		Key:    aws.String(c.store.key(filepath.ToSlash(name))),
+	})
+	return err
+}
+
+func (c objectCheckpoints) Close() error { return nil }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// An in-memory S3 endpoint serving path-style GET, PUT and DELETE
+func newFakeS3(t *testing.T) string {
+	t.Helper()
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+				return
+			}
+			w.Write(data)
+		case http.MethodPut:
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			objects[r.URL.Path] = data
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestCheckpointStores(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "file", cfg: Config{CheckpointBackend: checkpointBackendFile}},
+		{name: "s3", cfg: Config{CheckpointBackend: checkpointBackendS3, CheckpointURL: "s3://checkpoints/seeder", CheckpointEndpoint: newFakeS3(t)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			checkpoints, err := openCheckpointStore(ctx, tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer checkpoints.Close()
+			name := filepath.Join(t.TempDir(), "places"+progressFile)
+
+			point, err := getLastProcessedPlaceID(ctx, checkpoints, name)
+			if err != nil || point != (resumePoint{}) {
+				t.Errorf("checkpoint before any save = %+v, %v, want none", point, err)
+			}
+
+			points := []resumePoint{
+				{PlaceID: "p1"},
+				{PlaceID: "p2", Row: 2},
+				{PlaceID: "p3", Row: 3, Offset: 120, Validator: `"etag"`},
+			}
+			for _, want := range points {
+				if err := updateLastProcessedPlaceID(ctx, checkpoints, name, want); err != nil {
+					t.Fatal(err)
+				}
+				got, err := getLastProcessedPlaceID(ctx, checkpoints, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("checkpoint = %+v, want %+v", got, want)
+				}
+			}
+
+			if err := checkpoints.remove(ctx, name); err != nil {
+				t.Fatal(err)
+			}
+			if point, err := getLastProcessedPlaceID(ctx, checkpoints, name); err != nil || point != (resumePoint{}) {
+				t.Errorf("checkpoint after removing it = %+v, %v, want none", point, err)
+			}
+			if err := checkpoints.remove(ctx, name); err != nil {
+				t.Errorf("removing a missing checkpoint: %v", err)
+			}
+		})
+	}
+}
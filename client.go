@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/auth"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// Longest wait between attempts to reach the server at startup
+const maxPingBackoff = 30 * time.Second
+
+// Options for a client of MONGO_URI, or the one SECRETS_BACKEND resolves,
+// with the TLS, pool, timeout, write concern and read preference settings
+// applied over those of the URI. Also returns when the URI's credentials
+// need resolving again, zero for never.
+func clientOptions(ctx context.Context, cfg Config) (*options.ClientOptions, time.Time, error) {
+	uri, refreshAt, err := resolveMongoURI(ctx, cfg)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	opts := options.Client().ApplyURI(uri)
+
+	if cfg.TLSCAFile != "" || cfg.TLSCertFile != "" || cfg.TLSInsecure {
+		tlsConfig, err := clientTLSConfig(cfg)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	if cfg.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(uint64(cfg.MaxPoolSize))
+	}
+	if cfg.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(cfg.ConnectTimeout)
+	}
+	if cfg.SocketTimeout > 0 {
+		opts.SetSocketTimeout(cfg.SocketTimeout)
+	}
+	if cfg.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(cfg.ServerSelectionTimeout)
+	}
+	if cfg.HeartbeatInterval > 0 {
+		opts.SetHeartbeatInterval(cfg.HeartbeatInterval)
+	}
+
+	if cfg.WriteConcern != "" || cfg.WriteJournal || cfg.WriteTimeout > 0 {
+		concern := &writeconcern.WriteConcern{}
+		if opts.WriteConcern != nil {
+			*concern = *opts.WriteConcern
+		}
+		if cfg.WriteTimeout > 0 {
+			concern.WTimeout = cfg.WriteTimeout
+		}
+		switch w, err := strconv.Atoi(cfg.WriteConcern); {
+		case cfg.WriteConcern == "":
+		case err == nil:
+			concern.W = w
+		default:
+			concern.W = cfg.WriteConcern
+		}
+		if cfg.WriteJournal {
+			journal := true
+			concern.Journal = &journal
+		}
+		opts.SetWriteConcern(concern)
+	}
+
+	if cfg.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(cfg.ReadPreference)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("READ_PREFERENCE: %w", err)
+		}
+		pref, err := readpref.New(mode)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("READ_PREFERENCE: %w", err)
+		}
+		opts.SetReadPreference(pref)
+	}
+	return opts, refreshAt, opts.Validate()
+}
+
+// TLS settings for the client: the CA to verify the server with, the
+// certificate to present for mutual TLS, and whether to skip verification
+func clientTLSConfig(cfg Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.TLSInsecure}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("MONGO_TLS_CA_FILE: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("MONGO_TLS_CA_FILE: no PEM certificates in %s", cfg.TLSCAFile)
+		}
+	}
+	if cfg.TLSCertFile != "" {
+		// The key may be in the certificate file, as the URI's
+		// tlsCertificateKeyFile has it
+		keyFile := cfg.TLSKeyFile
+		if keyFile == "" {
+			keyFile = cfg.TLSCertFile
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("MONGO_TLS_CERT_FILE: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Ping the server, as connecting doesn't reach it, retrying up to retries
+// times with doubling waits. Failures say whether authentication, DNS or
+// reaching the server went wrong; the first two aren't retried.
+func pingServer(ctx context.Context, client *mongo.Client, retries int) error {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err := client.Ping(ctx, readpref.Primary())
+		if err == nil {
+			return nil
+		}
+		hint, retryable := connectionHint(err)
+		if !retryable || attempt >= retries {
+			if hint != "" {
+				return fmt.Errorf("connecting to MongoDB: %s: %w", hint, err)
+			}
+			return fmt.Errorf("connecting to MongoDB: %w", err)
+		}
+		slog.Warn("MongoDB not reachable, retrying", "attempt", attempt+1, "in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxPingBackoff)
+	}
+}
+
+// What a connection failure means, and whether it may pass. A server
+// selection timeout carries the cause in the servers' last errors.
+func connectionHint(err error) (string, bool) {
+	causes := []error{err}
+	var selection topology.ServerSelectionError
+	if errors.As(err, &selection) {
+		for _, server := range selection.Desc.Servers {
+			if server.LastError != nil {
+				causes = append(causes, server.LastError)
+			}
+		}
+	}
+
+	for _, cause := range causes {
+		var authErr *auth.Error
+		if errors.As(cause, &authErr) {
+			return "authentication failed, check the user, password and authSource of MONGO_URI", false
+		}
+		var dnsErr *net.DNSError
+		if errors.As(cause, &dnsErr) {
+			return fmt.Sprintf("can't resolve %s, check the host of MONGO_URI", dnsErr.Name), !dnsErr.IsNotFound
+		}
+		if errors.Is(cause, syscall.ECONNREFUSED) {
+			return "connection refused, check the host and port of MONGO_URI and that the server is running", true
+		}
+	}
+	if mongo.IsTimeout(err) {
+		return "timed out, check the host and port of MONGO_URI, firewalls and the cluster's IP access list", true
+	}
+	return "", true
+}
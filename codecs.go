@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonoptions"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+)
+
+// How time values are stored
+const (
+	timeFormatDate    = "date"
+	timeFormatRFC3339 = "rfc3339"
+	timeFormatUnix    = "unix"
+	timeFormatUnixMs  = "unixms"
+)
+
+// Registry documents are encoded with on the write path, the driver's
+// default unless configured otherwise
+var bsonRegistry = bson.DefaultRegistry
+
+// Codecs BSON_CODECS can register on top of the configured encoding:
+// nilslice stores nil slices, such as the types of a row without any, as
+// empty arrays rather than null, and int32 stores integers that fit as
+// 32-bit ints rather than 64-bit
+var bsonCodecs = map[string]func(*bsoncodec.Registry){
+	"nilslice": func(reg *bsoncodec.Registry) {
+		reg.RegisterKindEncoder(reflect.Slice, bsoncodec.NewSliceCodec(bsonoptions.SliceCodec().SetEncodeNilAsEmpty(true)))
+	},
+	"int32": func(reg *bsoncodec.Registry) {
+		reg.RegisterTypeEncoder(reflect.TypeOf(int64(0)), bsoncodec.ValueEncoderFunc(minIntEncoder))
+		reg.RegisterTypeEncoder(reflect.TypeOf(0), bsoncodec.ValueEncoderFunc(minIntEncoder))
+	},
+}
+
+// The codecs named in a BSON_CODECS list, in order
+func parseBSONCodecs(list string) ([]func(*bsoncodec.Registry), error) {
+	var codecs []func(*bsoncodec.Registry)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		register, ok := bsonCodecs[name]
+		if !ok {
+			return nil, fmt.Errorf("BSON_CODECS: unknown codec %q, must be nilslice or int32", name)
+		}
+		codecs = append(codecs, register)
+	}
+	return codecs, nil
+}
+
+// Encode documents with the registry for the configured options, set once
+// before any file is processed
+func setupBSONRegistry(cfg Config) error {
+	registry, err := newBSONRegistry(cfg)
+	if err != nil || registry == nil {
+		return err
+	}
+	bsonRegistry = registry
+	return nil
+}
+
+// Build the registry for the configured encoding options and codecs, nil
+// if the default registry will do
+func newBSONRegistry(cfg Config) (*bsoncodec.Registry, error) {
+	codecs, err := parseBSONCodecs(cfg.BSONCodecs)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.BSONOmitEmpty && cfg.BSONTimeFormat == timeFormatDate && len(codecs) == 0 {
+		return nil, nil
+	}
+	reg := bson.NewRegistry()
+
+	if cfg.BSONOmitEmpty {
+		// Every struct field behaves as if tagged omitempty
+		parser := bsoncodec.StructTagParserFunc(func(sf reflect.StructField) (bsoncodec.StructTags, error) {
+			tags, err := bsoncodec.DefaultStructTagParser(sf)
+			tags.OmitEmpty = true
+			return tags, err
+		})
+		codec, err := bsoncodec.NewStructCodec(parser)
+		if err != nil {
+			return nil, err
+		}
+		reg.RegisterKindEncoder(reflect.Struct, codec)
+	}
+
+	if cfg.BSONTimeFormat != timeFormatDate {
+		reg.RegisterTypeEncoder(reflect.TypeOf(time.Time{}), timeEncoder(cfg.BSONTimeFormat))
+	}
+
+	for _, register := range codecs {
+		register(reg)
+	}
+	return reg, nil
+}
+
+// Encoder storing time values as RFC 3339 strings or Unix timestamps
+func timeEncoder(format string) bsoncodec.ValueEncoderFunc {
+	return func(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+		t, ok := val.Interface().(time.Time)
+		if !ok {
+			return fmt.Errorf("time encoder can't encode %s", val.Type())
+		}
+		switch format {
+		case timeFormatRFC3339:
+			return vw.WriteString(t.UTC().Format(time.RFC3339Nano))
+		case timeFormatUnix:
+			return vw.WriteInt64(t.Unix())
+		case timeFormatUnixMs:
+			return vw.WriteInt64(t.UnixMilli())
+		}
+		return vw.WriteDateTime(t.UnixMilli())
+	}
+}
+
+// Encoder storing integers as 32-bit ints when they fit
+func minIntEncoder(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if i := val.Int(); i >= math.MinInt32 && i <= math.MaxInt32 {
+		return vw.WriteInt32(int32(i))
+	}
+	return vw.WriteInt64(val.Int())
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestBSONCodecs(t *testing.T) {
+	type doc struct {
+		Types []string `bson:"types"`
+		Count int64    `bson:"count"`
+		Big   int64    `bson:"big"`
+	}
+	tests := []struct {
+		name   string
+		codecs string
+		want   bson.D
+		err    bool
+	}{
+		{name: "none", want: bson.D{{Key: "types", Value: nil}, {Key: "count", Value: int64(3)}, {Key: "big", Value: int64(1 << 40)}}},
+		{name: "nilslice", codecs: "nilslice", want: bson.D{{Key: "types", Value: bson.A{}}, {Key: "count", Value: int64(3)}, {Key: "big", Value: int64(1 << 40)}}},
+		{name: "int32", codecs: "int32", want: bson.D{{Key: "types", Value: nil}, {Key: "count", Value: int32(3)}, {Key: "big", Value: int64(1 << 40)}}},
+		{name: "both", codecs: " nilslice, int32 ", want: bson.D{{Key: "types", Value: bson.A{}}, {Key: "count", Value: int32(3)}, {Key: "big", Value: int64(1 << 40)}}},
+		{name: "unknown", codecs: "nilslice,decimal", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, err := newBSONRegistry(Config{BSONTimeFormat: timeFormatDate, BSONCodecs: tt.codecs})
+			if tt.err {
+				if err == nil {
+					t.Errorf("newBSONRegistry(%q) succeeded, want an error", tt.codecs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if registry == nil {
+				registry = bson.DefaultRegistry
+			}
+			data, err := bson.MarshalWithRegistry(registry, doc{Count: 3, Big: 1 << 40})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bson.D
+			if err := bson.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("encoded with %q = %v, want %v", tt.codecs, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BSON types a column can be coerced to
+const (
+	typeString     = "string"
+	typeInt32      = "int32"
+	typeInt64      = "int64"
+	typeDouble     = "double"
+	typeBool       = "bool"
+	typeDate       = "date"
+	typeDecimal128 = "decimal128"
+	typeArray      = "array"
+	typeObject     = "object"
+	typeWKT        = "wkt"
+)
+
+var columnTypes = []string{typeString, typeInt32, typeInt64, typeDouble, typeBool, typeDate, typeDecimal128, typeArray, typeObject, typeWKT}
+
+// Date layouts tried when a date column has no format
+var defaultDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// columnType is the BSON type of a column and how its values are parsed.
+// A plain string is accepted as just the type.
+type columnType struct {
+	Type string `json:"type"`
+
+	// Date layout: rfc3339, unix, unixms or a Go layout like "02/01/2006"
+	Format string `json:"format,omitempty"`
+
+	// Array element separator; without one arrays are parsed like the
+	// types column, e.g. "['a','b']"
+	Separator string `json:"separator,omitempty"`
+
+	// Values read as true and false, case-insensitively, instead of
+	// "true" and "false"
+	TrueValues  []string `json:"trueValues,omitempty"`
+	FalseValues []string `json:"falseValues,omitempty"`
+}
+
+func (t *columnType) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &t.Type); err == nil {
+		return nil
+	}
+	type columnTypeFields columnType // Without the UnmarshalJSON method
+	return json.Unmarshal(data, (*columnTypeFields)(t))
+}
+
+func (t columnType) validate() error {
+	if !contains(columnTypes, t.Type) {
+		return fmt.Errorf("unknown type %q, must be one of %s", t.Type, strings.Join(columnTypes, ", "))
+	}
+	return nil
+}
+
+// Parse a value as the column's type
+func (t columnType) parse(value string) (any, error) {
+	switch t.Type {
+	case typeInt32:
+		n, err := strconv.ParseInt(value, 10, 32)
+		return int32(n), err
+	case typeInt64:
+		return strconv.ParseInt(value, 10, 64)
+	case typeDouble:
+		return strconv.ParseFloat(value, 64)
+	case typeBool:
+		return t.parseBool(value)
+	case typeDate:
+		return t.parseDate(value)
+	case typeDecimal128:
+		return primitive.ParseDecimal128(value)
+	case typeArray:
+		if t.Separator != "" {
+			return strings.Split(value, t.Separator), nil
+		}
+		return parseArrayFromColumn(value), nil
+	case typeObject:
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON([]byte(value), false, &doc); err != nil {
+			return nil, fmt.Errorf("%q is not a JSON object: %w", value, err)
+		}
+		return doc, nil
+	case typeWKT:
+		geometry, err := parseWKT(value)
+		if geometry == nil {
+			return nil, err // EMPTY is stored as null
+		}
+		return geometry, nil
+	}
+	return value, nil
+}
+
+func (t columnType) parseBool(value string) (bool, error) {
+	trueValues, falseValues := t.TrueValues, t.FalseValues
+	if len(trueValues) == 0 && len(falseValues) == 0 {
+		trueValues, falseValues = []string{"true"}, []string{"false"}
+	}
+	for _, v := range trueValues {
+		if strings.EqualFold(value, v) {
+			return true, nil
+		}
+	}
+	for _, v := range falseValues {
+		if strings.EqualFold(value, v) {
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("%q is not a boolean", value)
+}
+
+func (t columnType) parseDate(value string) (time.Time, error) {
+	return parseDateLayout(value, t.Format)
+}
+
+// Parse a date in the given layout: rfc3339, unix (seconds), unixms, a Go
+// layout, or empty to try the default layouts
+func parseDateLayout(value, layout string) (time.Time, error) {
+	switch strings.ToLower(layout) {
+	case "":
+		for _, layout := range defaultDateLayouts {
+			if parsed, err := time.Parse(layout, value); err == nil {
+				return parsed, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("%q is not a date", value)
+	case "rfc3339":
+		return time.Parse(time.RFC3339Nano, value)
+	case "unix":
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%q is not a unix timestamp", value)
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	case "unixms":
+		millis, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%q is not a unix timestamp in milliseconds", value)
+		}
+		return time.UnixMilli(millis).UTC(), nil
+	}
+	return time.Parse(layout, value)
+}
+
+// documentSchema turns rows into generic documents, one field per column
+// named after the header, instead of a Place
+type documentSchema struct {
+	names []string
+	types []columnType
+	nulls []nullRule
+
+	// Columns left out of the documents
+	excluded map[int]bool
+}
+
+// Column names and their types, for logging
+func (s documentSchema) String() string {
+	fields := make([]string, 0, len(s.names))
+	for i, name := range s.names {
+		if !s.excluded[i] {
+			fields = append(fields, name+":"+s.types[i].Type)
+		}
+	}
+	return strings.Join(fields, ", ")
+}
+
+// Build the document for a row. Null tokens are stored as null or omitted,
+// and a value that doesn't parse as its column's type rejects the row.
+func (s documentSchema) document(record []string) (bson.D, error) {
+	doc := make(bson.D, 0, len(s.names))
+	for i, name := range s.names {
+		if s.excluded[i] {
+			continue
+		}
+		raw := ""
+		if i < len(record) {
+			raw = record[i]
+		}
+
+		var value any
+		if s.nulls[i].matches(raw) {
+			if s.nulls[i].As == nullAsOmit {
+				continue
+			}
+		} else {
+			var err error
+			value, err = s.types[i].parse(raw)
+			if err != nil {
+				return nil, &rowError{Kind: "type_mismatch", Err: fmt.Errorf("column %s: %w", name, err)}
+			}
+		}
+		doc = append(doc, bson.E{Key: name, Value: value})
+	}
+	return doc, nil
+}
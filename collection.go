@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Empty the target collection before seeding: drop it, indexes and all,
+// with RECREATE, or delete its documents with TRUNCATE. Asks first unless
+// --yes. A dry run leaves the collection alone.
+func emptyCollection(cfg Config) error {
+	if cfg.DryRun {
+		slog.Info("Dry run, collection not emptied", "collection", cfg.DBName+"."+cfg.CollectionName)
+		return nil
+	}
+
+	ctx := context.Background()
+	clientOpts, _, err := clientOptions(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	client, err := mongo.Connect(ctx, clientOpts)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+	if err := pingServer(ctx, client, cfg.ConnectRetries); err != nil {
+		return err
+	}
+	collection := client.Database(cfg.DBName).Collection(cfg.CollectionName)
+
+	count, err := collection.EstimatedDocumentCount(ctx)
+	if err != nil {
+		return err
+	}
+	action := "truncate"
+	if cfg.Recreate {
+		action = "drop"
+	}
+	if !cfg.Yes {
+		if err := confirm(fmt.Sprintf("%s %s.%s, removing about %d documents", action, cfg.DBName, cfg.CollectionName, count)); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Recreate {
+		if err := collection.Drop(ctx); err != nil {
+			return err
+		}
+		slog.Info("Collection dropped", "collection", cfg.DBName+"."+cfg.CollectionName, "documents", count)
+		return nil
+	}
+	result, err := collection.DeleteMany(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	slog.Info("Collection truncated", "collection", cfg.DBName+"."+cfg.CollectionName, "deleted", result.DeletedCount)
+	return nil
+}
+
+// Collection types the target can be created as, besides a plain one
+const (
+	collectionTypeTimeSeries = "timeseries"
+	collectionTypeCapped     = "capped"
+)
+
+// Create a target collection as a time-series or capped collection, and
+// with the validator if there is one, unless it already exists, when it is
+// left as it is. A dry run only logs what it would create.
+func createCollection(ctx context.Context, collection *mongo.Collection, cfg Config, validator bson.D) error {
+	if validator == nil && cfg.CollectionType == "" {
+		return nil
+	}
+	name := collection.Database().Name() + "." + collection.Name()
+	opts := options.CreateCollection()
+	if validator != nil {
+		opts.SetValidator(validator).SetValidationAction(cfg.SchemaValidationAction)
+	}
+	switch cfg.CollectionType {
+	case collectionTypeTimeSeries:
+		timeSeries := options.TimeSeries().SetTimeField(cfg.TimeSeriesTimeField)
+		if cfg.TimeSeriesMetaField != "" {
+			timeSeries.SetMetaField(cfg.TimeSeriesMetaField)
+		}
+		if cfg.TimeSeriesGranularity != "" {
+			timeSeries.SetGranularity(cfg.TimeSeriesGranularity)
+		}
+		opts.SetTimeSeriesOptions(timeSeries)
+		if cfg.TimeSeriesExpireAfter > 0 {
+			opts.SetExpireAfterSeconds(int64(cfg.TimeSeriesExpireAfter.Seconds()))
+		}
+	case collectionTypeCapped:
+		opts.SetCapped(true).SetSizeInBytes(cfg.CappedSize)
+		if cfg.CappedMaxDocuments > 0 {
+			opts.SetMaxDocuments(cfg.CappedMaxDocuments)
+		}
+	}
+
+	if cfg.DryRun {
+		validatorJSON := ""
+		if validator != nil {
+			data, err := bson.MarshalExtJSON(validator, false, false)
+			if err != nil {
+				return err
+			}
+			validatorJSON = string(data)
+		}
+		slog.Info("Dry run, collection not created", "collection", name, "type", cfg.CollectionType, "validator", validatorJSON)
+		return nil
+	}
+
+	names, err := collection.Database().ListCollectionNames(ctx, bson.D{{Key: "name", Value: collection.Name()}})
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		slog.Warn("Collection already exists, its type and validator were left alone", "collection", name)
+		return nil
+	}
+
+	if err := collection.Database().CreateCollection(ctx, collection.Name(), opts); err != nil {
+		return fmt.Errorf("creating collection %s: %w", name, err)
+	}
+	slog.Info("Collection created", "collection", name, "type", cfg.CollectionType, "validator", validator != nil)
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Input compression formats
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Stream-decompress gzip (.csv.gz) and zstd (.csv.zst) input, recognised by
+// its magic bytes. Other input is read as is.
+func (in *input) decompress() error {
+	buffered := bufio.NewReader(in.Reader)
+	in.Reader = buffered
+	in.compression = compressionNone
+
+	head, err := buffered.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		in.counter = &countingReader{r: buffered}
+		gz, err := gzip.NewReader(in.counter)
+		if err != nil {
+			return err
+		}
+		in.Reader = gz
+		in.closers = append(in.closers, gz)
+		in.compression = compressionGzip
+
+	case bytes.HasPrefix(head, zstdMagic):
+		in.counter = &countingReader{r: buffered}
+		zr, err := zstd.NewReader(in.counter)
+		if err != nil {
+			return err
+		}
+		in.Reader = zr
+		in.closers = append(in.closers, zstdCloser{zr})
+		in.compression = compressionZstd
+	}
+	return nil
+}
+
+// zstdCloser adapts a zstd decoder, whose Close returns nothing
+type zstdCloser struct {
+	*zstd.Decoder
+}
+
+func (z zstdCloser) Close() error {
+	z.Decoder.Close()
+	return nil
+}
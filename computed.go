@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// computedField is a document field rendered from a row with a Go
+// template, e.g. fullAddress from "{{.address}}, {{.city}}, {{.division}}"
+type computedField struct {
+	name     string
+	template *template.Template
+}
+
+// Parse the mapping's computed fields, in name order. Templates see the
+// row's columns by header name and, for the Place schema, by the Place
+// fields they are mapped to; naming anything else is an error.
+func (m Mapping) resolveComputed(header *Header, cols columns, geo []geoColumn, generic bool) ([]computedField, error) {
+	names := make([]string, 0, len(m.Computed))
+	for name := range m.Computed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	taken := map[string]bool{}
+	if generic {
+		for _, name := range header.Names {
+			taken[name] = true
+		}
+	} else {
+		for name := range placeFields {
+			taken[name] = true
+		}
+		for _, g := range geo {
+			taken[g.Field] = true
+		}
+	}
+
+	// Check the templates against a row of empty values
+	empty := templateData(header, cols, nil)
+	fields := make([]computedField, 0, len(names))
+	for _, name := range names {
+		if name == "" || taken[name] {
+			return nil, fmt.Errorf("computed field %q clashes with another field", name)
+		}
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(m.Computed[name])
+		if err != nil {
+			return nil, fmt.Errorf("computed field %q: %w", name, err)
+		}
+		if err := tmpl.Execute(&strings.Builder{}, empty); err != nil {
+			return nil, fmt.Errorf("computed field %q: %w", name, err)
+		}
+		fields = append(fields, computedField{name: name, template: tmpl})
+	}
+	return fields, nil
+}
+
+// A row's values by header name, and by Place field where the column
+// doesn't have the same name
+func templateData(header *Header, cols columns, record []string) map[string]string {
+	data := make(map[string]string, len(header.Names)+len(cols))
+	for field := range cols {
+		data[field] = cols.get(record, field)
+	}
+	for i, name := range header.Names {
+		data[name] = ""
+		if i < len(record) {
+			data[name] = record[i]
+		}
+	}
+	return data
+}
+
+// Render the computed fields for a row
+func renderComputed(fields []computedField, data map[string]string) (bson.D, error) {
+	values := make(bson.D, 0, len(fields))
+	for _, field := range fields {
+		var b strings.Builder
+		if err := field.template.Execute(&b, data); err != nil {
+			return nil, &rowError{Kind: "template_error", Err: fmt.Errorf("computed field %s: %w", field.name, err)}
+		}
+		values = append(values, bson.E{Key: field.name, Value: b.String()})
+	}
+	return values, nil
+}
@@ -0,0 +1,1334 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/joho/godotenv"
+	"github.com/robfig/cron/v3"
+)
+
+// Config holds the seeder settings
+type Config struct {
+	CSVFile        string
+	MongoURI       string
+	DBName         string
+	CollectionName string
+
+	// Output files of the source being processed, named after it
+	outputs outputNames
+
+	// Comma-separated names of targets every input is seeded into in turn,
+	// each with its own URI and database, progress and output files. See
+	// seedTargets.
+	Targets string
+	target  string // The target being seeded
+
+	// Set by the server on the runs of an import, to follow and cancel them
+	control *runControl
+
+	// Sources from CSVFile processed at once, each with its own progress
+	// and output files, with at most MaxConcurrentInserts batches being
+	// written at a time across them (0 for one per file)
+	ParallelFiles        int
+	MaxConcurrentInserts int
+
+	// Endpoint for object store sources: an S3-compatible store such as
+	// MinIO for s3://, or a blob endpoint such as Azurite's for az://
+	SourceEndpoint string
+
+	// Cron expression to seed CSVFile on, as a long-lived process, e.g.
+	// "0 2 * * *" or "@daily", skipping runs while the inputs are unchanged
+	// since the last successful one if ScheduleSkipUnchanged
+	Schedule              string
+	ScheduleSkipUnchanged bool
+
+	// The serve subcommand listens on ServeAddr for CSV uploads, kept with
+	// their reports in ServeDir, requiring ServeToken as a bearer token
+	// (always, when listening beyond localhost) and refusing uploads over
+	// ServeMaxUpload bytes. Uploads may name DBName or one of ServeDatabases.
+	// Finished imports are forgotten, and their reports removed, after
+	// ServeRetention.
+	ServeAddr      string
+	ServeDir       string
+	ServeToken     string
+	ServeMaxUpload int64
+	ServeDatabases string // Comma-separated
+	ServeRetention time.Duration
+
+	// Also serve the imports API over gRPC on GRPCAddr, if set
+	GRPCAddr string
+
+	// Directory watched for files to seed in place of CSVFile, polled every
+	// WatchInterval for new files matching WatchPattern
+	Watch         string
+	WatchPattern  string
+	WatchInterval time.Duration
+
+	// Optional JSON file mapping Place fields to CSV column names
+	MappingFile string
+
+	// Optional JSON file of aggregation pipelines and commands run against
+	// the database once every input is seeded. See loadPostImport.
+	PostImportFile string
+
+	// Shell commands run with sh -c before seeding, after it succeeds and
+	// after it fails, seeing the run in SEED_ environment variables (see
+	// hookEnv). A failing pre or success hook fails the run.
+	HookPre     string
+	HookSuccess string
+	HookFailure string
+
+	// URL the run summary is POSTed to as JSON when the run finishes or
+	// fails, waiting up to WebhookTimeout
+	WebhookURL     string
+	WebhookTimeout time.Duration
+
+	// Send the run summary to a Slack incoming webhook, and by email over
+	// SMTP, for runs at least as severe as each one's minimum: success,
+	// warning (finished with rejected rows) or failure
+	SlackWebhookURL  string
+	SlackMinSeverity string
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	EmailFrom        string
+	EmailTo          string // Comma-separated
+	EmailMinSeverity string
+
+	// How duplicate header names are handled: rename or error
+	DuplicateHeaders string
+
+	// How documents are written: insert, upsert by placeId, new to insert
+	// only placeIds not already in the collection, or refresh to upsert
+	// only those whose RowHashField differs from the stored one, or update
+	// to set the fields of existing documents by placeId, never inserting
+	WriteMode string
+
+	// Field each document stores a hash of its source row in, empty for none
+	RowHashField string
+
+	// Mapped field, or column, whose value becomes the document _id in
+	// place of a generated ObjectID, e.g. placeId. Upserts and updates
+	// then match documents by _id. IDType is string to store the value
+	// as is, or objectid to store an ObjectID hashed from it, for
+	// collections that must keep ObjectID _ids.
+	IDField string
+	IDType  string
+
+	// Record each run in the _seed_runs collection, with Operator, else the
+	// OS user, as who ran it
+	RecordRuns bool
+	Operator   string
+
+	// Stamp documents with the source file, data row, run and time they
+	// were imported, in fields PROVENANCE_FIELDS can rename or leave out
+	Provenance       bool
+	ProvenanceFields string
+
+	// Store the run's import ID in the importId field of each document
+	// written, for the undo subcommand
+	TagImportID bool
+
+	// Have the undo subcommand undo upsert and refresh runs, and runs with
+	// no record in the runs collection, too
+	UndoForce bool
+
+	// For the delete subcommand: the column placeIds are read from, and
+	// whether documents are marked isDeleted rather than removed
+	DeleteIDColumn string
+	SoftDelete     bool
+
+	// Write each batch in a multi-document transaction, so it lands whole
+	// or not at all and the checkpoint is exact. Needs a replica set or
+	// sharded cluster; a document MongoDB rejects fails the batch and the
+	// run rather than going to the rejects file.
+	Transactions bool
+
+	// Mark places duplicating another place's normalized address and
+	// coordinates as merged into it
+	MergeDuplicates bool
+
+	// Parse, map and validate without writing anything to MongoDB or the
+	// progress file, printing the first DryRunPrint documents
+	DryRun      bool
+	DryRunPrint int
+
+	// Infer column types from the first InferSampleRows rows and write one
+	// field per column instead of a Place. Types declared in the mapping
+	// file take precedence.
+	InferSchema     bool
+	InferSampleRows int
+
+	// Only process this range of data rows, ignoring and leaving the
+	// checkpoint alone, e.g. to reimport a damaged window in upsert mode
+	Rows rowRange
+
+	// Only write rows whose FilterCountryColumn, by default the column the
+	// country field is read from, names this country
+	FilterCountry       string
+	FilterCountryColumn string
+
+	// Only write rows this expression is true for, e.g.
+	// country == "Bangladesh" && postalCode != ""
+	Where string
+
+	// Skip rows whose DedupeKey column, a header name or Place field,
+	// repeats an earlier row's in the file. Up to DedupeMaxKeys keys are
+	// remembered (0 for no limit).
+	DedupeKey     string
+	DedupeMaxKeys int
+
+	// Hold back rows within NearDuplicateMeters of an earlier place whose
+	// address is at least NearDuplicateSimilarity alike (0 to 1), writing
+	// them to a review file instead of inserting them. 0 meters disables.
+	// Up to NearDuplicateMaxPlaces places are remembered, and
+	// NearDuplicateMaxPerCell in any one grid cell (0 for no limit).
+	NearDuplicateMeters     float64
+	NearDuplicateSimilarity float64
+	NearDuplicateMaxPlaces  int
+	NearDuplicateMaxPerCell int
+
+	// Only write a sample of the rows: this fraction of them, picked by
+	// PlaceID, or every SampleEvery-th row (0 for all rows)
+	Sample      float64
+	SampleEvery int64
+
+	// Require the header to match the mapping's columns exactly
+	StrictSchema bool
+
+	// Optional GeoJSON file of division and district boundaries, used to
+	// validate those fields from the coordinates, or also fill empty ones
+	BoundariesFile string
+	BoundariesMode string
+
+	// Box the points are expected in, and whether rows with points outside
+	// it are rejected or flagged
+	GeoBBox     boundingBox
+	GeoBBoxMode string
+
+	// What happens to missing, unparseable or out of range coordinates in
+	// geo fields that don't say: keep them as parsed, with unparseable
+	// values as 0, omit the field, or reject the row
+	GeoOnInvalid string
+
+	// How geo fields that don't say are written: geojson, pair for a legacy
+	// [lon, lat] array, fields for separate latitude and longitude, or none
+	GeoFormat string
+
+	// What happens to latitude and longitude that look swapped: off, fix
+	// to swap them back, flag or reject
+	GeoSwap string
+
+	// Comma-separated normalization steps applied to addresses: nfc,
+	// whitespace, abbreviations and country, which strips a trailing name
+	// from AddressCountrySuffixes
+	AddressNormalize       string
+	AddressCountrySuffixes string
+
+	// Check plusCode values are valid Open Location Codes: off, flag or
+	// reject. With PlusCodeDerive, empty ones are computed from the location.
+	PlusCodeCheck  string
+	PlusCodeDerive bool
+
+	// Check address and localArea for junk: off, flag or reject. Values are
+	// junk if they contain a word from GarbageWordlist, match a regex from
+	// GarbagePatterns, exceed GarbageMaxLength characters or are more than
+	// GarbageMaxControlPercent control characters.
+	GarbageFilter            string
+	GarbageWordlist          string
+	GarbagePatterns          string
+	GarbageMaxLength         int
+	GarbageMaxControlPercent int
+
+	// Write concern: w as majority, a node count (0 for unacknowledged
+	// writes) or a tag set name, whether writes must reach the journal, and
+	// how long to wait for w before failing. Unset ones keep MONGO_URI's.
+	// ReadPreference picks the members reads such as new mode's lookups go
+	// to.
+	WriteConcern   string
+	WriteJournal   bool
+	WriteTimeout   time.Duration
+	ReadPreference string
+
+	// Resolve MONGO_URI at startup from a secrets backend, vault or aws:
+	// the secret at MongoURISecret, a Vault path or an AWS secret ID, holds
+	// the connection string under MongoURISecretKey, or a username and
+	// password to put in MONGO_URI. Long imports reconnect with it resolved
+	// again every SecretsRefresh, else two thirds into a Vault lease.
+	SecretsBackend    string
+	MongoURISecret    string
+	MongoURISecretKey string
+	SecretsRefresh    time.Duration
+
+	// TLS for MongoDB beyond what fits in the URI: a PEM CA file to verify
+	// the server with, a client certificate and key for mutual TLS (the key
+	// may be in the certificate file), and skipping server verification
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+	TLSInsecure bool
+
+	// Create the collection with a $jsonSchema validator derived from the
+	// mapping, so the server checks every writer's documents, failing
+	// those that don't match, or with the warn action only logging them.
+	// An existing collection is left alone.
+	SchemaValidator        bool
+	SchemaValidationAction string
+
+	// Create the collection as a timeseries or capped collection, empty for
+	// a plain one. A time-series collection keeps its measurement time in
+	// the TimeSeriesTimeField date field, its metadata in the optional
+	// TimeSeriesMetaField, and is bucketed by TimeSeriesGranularity
+	// (seconds, minutes or hours), its documents expiring after
+	// TimeSeriesExpireAfter if set. A capped collection holds CappedSize
+	// bytes, and at most CappedMaxDocuments documents if set, dropping the
+	// oldest beyond that. An existing collection is left alone.
+	CollectionType        string
+	TimeSeriesTimeField   string
+	TimeSeriesMetaField   string
+	TimeSeriesGranularity string
+	TimeSeriesExpireAfter time.Duration
+	CappedSize            int64
+	CappedMaxDocuments    int64
+
+	// Send each row to the collection Routes gives for its value in
+	// RouteColumn, a header name or Place field, e.g.
+	// "Dhaka=dhaka_places,Chattogram=ctg.places,*=other_places". Targets
+	// are a collection in DBName or a database.collection; "*" catches
+	// values with no route, else they go to CollectionName.
+	RouteColumn string
+	Routes      string
+
+	// Empty the collection before seeding, starting every input from its
+	// first row: Recreate drops it, indexes and all, Truncate deletes its
+	// documents. Either asks first, or Yes.
+	Recreate bool
+	Truncate bool
+
+	// Runs writing to a MONGO_URI, or with a secrets backend a
+	// MONGO_URI_SECRET, matching this regular expression need confirming,
+	// or Yes
+	ProductionURIPattern string
+	Yes                  bool
+
+	// Times to retry pinging MongoDB at startup, with doubling waits
+	ConnectRetries int
+
+	// Connection pool and timeouts, 0 keeping MONGO_URI's or the driver's
+	// defaults: the most connections pooled, how long to wait for a
+	// connection to open, for a socket read or write and for a suitable
+	// server, and how often servers are checked
+	MaxPoolSize            int
+	ConnectTimeout         time.Duration
+	SocketTimeout          time.Duration
+	ServerSelectionTimeout time.Duration
+	HeartbeatInterval      time.Duration
+
+	// Pooled connections opened and pinged before reading starts (0 disables)
+	WarmupConnections int
+
+	// Field delimiter and quote character
+	Delimiter rune
+	Quote     rune
+
+	// How malformed quoting is handled: strict, lazy or repair
+	Quotes string
+
+	// How rows with more or fewer fields than the header are handled:
+	// strict, or pad to pad and truncate them to the header
+	FieldCount string
+
+	// Input format: auto, csv, ndjson for one JSON object per line, xlsx or
+	// parquet
+	InputFormat string
+
+	// Worksheet read from an xlsx workbook, the first if empty
+	XLSXSheet string
+
+	// Comma-separated columns read from a Parquet file, all if empty
+	ParquetColumns string
+
+	// Comma-separated columns that are the only ones written to documents,
+	// or that are never written to them
+	IncludeColumns string
+	ExcludeColumns string
+
+	// Archive members read, by glob on the full path or base name
+	ArchiveMembers string
+
+	// Leading and trailing columns dropped from every row, auto to detect
+	// an unnamed index column and an empty trailing column
+	SkipColumns columnSkip
+
+	// How the CSV file is read: bufio or mmap
+	ReadMode string
+
+	// Character encoding of the CSV file, auto to detect it from a BOM or
+	// the bytes, falling back to windows-1252 when they aren't UTF-8
+	Encoding string
+
+	// Suppress all progress output
+	Quiet bool
+
+	// Draw files processed in parallel as a dashboard on terminals instead
+	// of a stack of bars
+	Dashboard bool
+
+	// When stderr is not a terminal, log progress every interval and/or every N rows
+	ProgressInterval  time.Duration
+	ProgressEveryRows int64
+
+	// Gzip the rejects file and roll it into a new part every RejectsMaxSize
+	// bytes, keeping at most RejectsMaxFiles parts (0 keeps all)
+	RejectsCompress bool
+	RejectsMaxSize  int64
+	RejectsMaxFiles int
+
+	// The same for the audit log, which each run appends to
+	AuditCompress bool
+	AuditMaxSize  int64
+	AuditMaxFiles int
+
+	// Encode every struct field as if tagged omitempty, store times as
+	// BSON dates, RFC 3339 strings, or Unix seconds or milliseconds, and
+	// register the named codecs on top
+	BSONOmitEmpty  bool
+	BSONTimeFormat string
+	BSONCodecs     string
+
+	// Write an integrity manifest of each run to the _seeder_manifests
+	// collection
+	Manifest bool
+
+	// Documents written per batch, 0 for the default: 1000, or 100 against
+	// Atlas serverless
+	BatchSize int
+
+	// Target is Atlas serverless: smaller default batches, and estimated
+	// processing units in the summary
+	Serverless bool
+
+	// Pace writes to at most this many documents per second (0 for no
+	// limit), and only write inside a daily HH:MM-HH:MM local time window
+	WriteRate     int64
+	OffPeakWindow string
+
+	// Export documents written since the previous snapshot as NDJSON this
+	// often during the run (0 disables)
+	SnapshotInterval time.Duration
+
+	// Object store prefix (s3://bucket/prefix or gs://bucket/prefix) to
+	// upload the summary, audit log and rejects to after each run, and an
+	// optional endpoint for S3-compatible stores
+	ReportsUploadURL      string
+	ReportsUploadEndpoint string
+
+	// Where checkpoints are kept: in progress files, a MongoDB collection in
+	// the target database, Redis or an object store. CheckpointURL names the
+	// Redis server or object store prefix, with an optional endpoint for
+	// S3-compatible stores.
+	CheckpointBackend    string
+	CheckpointURL        string
+	CheckpointEndpoint   string
+	CheckpointCollection string
+
+	// Log output format: text or json
+	LogFormat string
+
+	// Minimum log level: debug, info, warn or error
+	LogLevel string
+
+	// Optional log file, rolled into a new part once it reaches LogMaxSize
+	// bytes, keeping LogMaxBackups earlier parts, gzipped if LogCompress
+	LogFile       string
+	LogMaxSize    int64
+	LogMaxBackups int
+	LogCompress   bool
+}
+
+// Load variables from the file --env-file or ENV_FILE names, else from .env
+// if there is one, after those of the .env.<profile> file of the --profile
+// or PROFILE profile, e.g. .env.prod. Variables already in the environment
+// win over the files, and a profile's over the shared file.
+func loadEnvFile(args []string) error {
+	profile := flagArg(args, "profile")
+	if profile == "" {
+		profile = os.Getenv("PROFILE")
+	}
+	if profile != "" {
+		if err := godotenv.Load(".env." + profile); err != nil {
+			return fmt.Errorf("profile %s: %w", profile, err)
+		}
+	}
+
+	name := flagArg(args, "env-file")
+	if name == "" {
+		name = os.Getenv("ENV_FILE")
+	}
+	if name == "" {
+		err := godotenv.Load(".env")
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return godotenv.Load(name)
+}
+
+// The value of a flag read ahead of the others, such as --env-file, which
+// decides their defaults
+func flagArg(args []string, flag string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != flag {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// Load the settings from the environment and flags; serve is set for the
+// serve subcommand, which is sent its files rather than reading CSV_FILE
+func loadConfig(args []string, serve bool) (Config, error) {
+	env := &envParser{}
+	cfg := Config{
+		CSVFile:                  os.Getenv("CSV_FILE"),
+		SourceEndpoint:           os.Getenv("SOURCE_ENDPOINT"),
+		ParallelFiles:            int(env.int64("PARALLEL_FILES", 1)),
+		MaxConcurrentInserts:     int(env.int64("MAX_CONCURRENT_INSERTS", 0)),
+		Schedule:                 os.Getenv("SCHEDULE"),
+		ScheduleSkipUnchanged:    env.bool("SCHEDULE_SKIP_UNCHANGED", true),
+		ServeAddr:                envOr("SERVE_ADDR", "127.0.0.1:8080"),
+		ServeDir:                 envOr("SERVE_DIR", "uploads"),
+		ServeToken:               os.Getenv("SERVE_TOKEN"),
+		ServeMaxUpload:           env.size("SERVE_MAX_UPLOAD", 1<<30),
+		ServeDatabases:           os.Getenv("SERVE_DATABASES"),
+		ServeRetention:           env.duration("SERVE_RETENTION", 24*time.Hour),
+		GRPCAddr:                 os.Getenv("GRPC_ADDR"),
+		Watch:                    os.Getenv("WATCH"),
+		WatchPattern:             envOr("WATCH_PATTERN", "*.csv"),
+		WatchInterval:            env.duration("WATCH_INTERVAL", 5*time.Second),
+		MongoURI:                 os.Getenv("MONGO_URI"),
+		DBName:                   os.Getenv("DB_NAME"),
+		Targets:                  os.Getenv("TARGETS"),
+		CollectionName:           os.Getenv("COLLECTION_NAME"),
+		MappingFile:              os.Getenv("MAPPING_FILE"),
+		PostImportFile:           os.Getenv("POST_IMPORT_FILE"),
+		HookPre:                  os.Getenv("HOOK_PRE"),
+		HookSuccess:              os.Getenv("HOOK_SUCCESS"),
+		HookFailure:              os.Getenv("HOOK_FAILURE"),
+		WebhookURL:               os.Getenv("WEBHOOK_URL"),
+		WebhookTimeout:           env.duration("WEBHOOK_TIMEOUT", 10*time.Second),
+		SlackWebhookURL:          os.Getenv("SLACK_WEBHOOK_URL"),
+		SlackMinSeverity:         envOr("SLACK_MIN_SEVERITY", severitySuccess),
+		SMTPHost:                 os.Getenv("SMTP_HOST"),
+		SMTPPort:                 int(env.int64("SMTP_PORT", 587)),
+		SMTPUsername:             os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:             os.Getenv("SMTP_PASSWORD"),
+		EmailFrom:                os.Getenv("EMAIL_FROM"),
+		EmailTo:                  os.Getenv("EMAIL_TO"),
+		EmailMinSeverity:         envOr("EMAIL_MIN_SEVERITY", severitySuccess),
+		DuplicateHeaders:         envOr("DUPLICATE_HEADERS", duplicateHeadersRename),
+		WriteMode:                envOr("WRITE_MODE", writeModeInsert),
+		RowHashField:             os.Getenv("ROW_HASH_FIELD"),
+		IDField:                  os.Getenv("ID_FIELD"),
+		IDType:                   envOr("ID_TYPE", idTypeString),
+		TagImportID:              env.bool("TAG_IMPORT_ID", true),
+		RecordRuns:               env.bool("RECORD_RUNS", true),
+		Provenance:               env.bool("PROVENANCE", false),
+		ProvenanceFields:         os.Getenv("PROVENANCE_FIELDS"),
+		Operator:                 os.Getenv("SEED_OPERATOR"),
+		DeleteIDColumn:           os.Getenv("DELETE_ID_COLUMN"),
+		SoftDelete:               env.bool("SOFT_DELETE", false),
+		Transactions:             env.bool("TRANSACTIONS", false),
+		MergeDuplicates:          env.bool("MERGE_DUPLICATES", false),
+		DryRun:                   env.bool("DRY_RUN", false),
+		DryRunPrint:              int(env.int64("DRY_RUN_PRINT", 0)),
+		FilterCountry:            os.Getenv("FILTER_COUNTRY"),
+		FilterCountryColumn:      os.Getenv("FILTER_COUNTRY_COLUMN"),
+		DedupeKey:                os.Getenv("DEDUPE_KEY"),
+		DedupeMaxKeys:            int(env.int64("DEDUPE_MAX_KEYS", 10_000_000)),
+		NearDuplicateMeters:      env.float64("NEAR_DUPLICATE_METERS", 0),
+		NearDuplicateSimilarity:  env.float64("NEAR_DUPLICATE_SIMILARITY", 0.85),
+		NearDuplicateMaxPlaces:   int(env.int64("NEAR_DUPLICATE_MAX_PLACES", 2_000_000)),
+		NearDuplicateMaxPerCell:  int(env.int64("NEAR_DUPLICATE_MAX_PER_CELL", 1000)),
+		Where:                    os.Getenv("WHERE"),
+		IncludeColumns:           os.Getenv("INCLUDE_COLUMNS"),
+		ExcludeColumns:           os.Getenv("EXCLUDE_COLUMNS"),
+		Sample:                   env.float64("SAMPLE", 0),
+		SampleEvery:              env.int64("SAMPLE_EVERY", 0),
+		StrictSchema:             env.bool("STRICT_SCHEMA", false),
+		InferSchema:              env.bool("INFER_SCHEMA", false),
+		InferSampleRows:          int(env.int64("INFER_SAMPLE_ROWS", 1000)),
+		BoundariesFile:           os.Getenv("BOUNDARIES_FILE"),
+		BoundariesMode:           envOr("BOUNDARIES_MODE", boundariesFill),
+		GeoBBoxMode:              envOr("GEO_BBOX_MODE", bboxModeReject),
+		GeoSwap:                  envOr("GEO_SWAP", geoSwapOff),
+		GeoOnInvalid:             envOr("GEO_ON_INVALID", geoInvalidKeep),
+		GeoFormat:                envOr("GEO_FORMAT", geoFormatGeoJSON),
+		AddressNormalize:         os.Getenv("ADDRESS_NORMALIZE"),
+		AddressCountrySuffixes:   envOr("ADDRESS_COUNTRY_SUFFIXES", "Bangladesh"),
+		PlusCodeCheck:            envOr("PLUS_CODE_CHECK", plusCodeCheckOff),
+		PlusCodeDerive:           env.bool("PLUS_CODE_DERIVE", false),
+		GarbageFilter:            envOr("GARBAGE_FILTER", garbageFilterOff),
+		GarbageWordlist:          os.Getenv("GARBAGE_WORDLIST"),
+		GarbagePatterns:          os.Getenv("GARBAGE_PATTERNS"),
+		GarbageMaxLength:         int(env.int64("GARBAGE_MAX_LENGTH", 500)),
+		GarbageMaxControlPercent: int(env.int64("GARBAGE_MAX_CONTROL_PERCENT", 5)),
+		WarmupConnections:        int(env.int64("WARMUP_CONNECTIONS", 0)),
+		SecretsBackend:           os.Getenv("SECRETS_BACKEND"),
+		MongoURISecret:           os.Getenv("MONGO_URI_SECRET"),
+		MongoURISecretKey:        envOr("MONGO_URI_SECRET_KEY", "uri"),
+		SecretsRefresh:           env.duration("SECRETS_REFRESH", 0),
+		TLSCAFile:                os.Getenv("MONGO_TLS_CA_FILE"),
+		TLSCertFile:              os.Getenv("MONGO_TLS_CERT_FILE"),
+		TLSKeyFile:               os.Getenv("MONGO_TLS_KEY_FILE"),
+		TLSInsecure:              env.bool("MONGO_TLS_INSECURE", false),
+		SchemaValidator:          env.bool("SCHEMA_VALIDATOR", false),
+		SchemaValidationAction:   envOr("SCHEMA_VALIDATION_ACTION", validationActionError),
+		CollectionType:           os.Getenv("COLLECTION_TYPE"),
+		TimeSeriesTimeField:      os.Getenv("TIMESERIES_TIME_FIELD"),
+		TimeSeriesMetaField:      os.Getenv("TIMESERIES_META_FIELD"),
+		TimeSeriesGranularity:    os.Getenv("TIMESERIES_GRANULARITY"),
+		TimeSeriesExpireAfter:    env.duration("TIMESERIES_EXPIRE_AFTER", 0),
+		CappedSize:               env.size("CAPPED_SIZE", 0),
+		CappedMaxDocuments:       env.int64("CAPPED_MAX_DOCUMENTS", 0),
+		RouteColumn:              os.Getenv("ROUTE_COLUMN"),
+		Routes:                   os.Getenv("ROUTES"),
+		Recreate:                 env.bool("RECREATE", false),
+		Truncate:                 env.bool("TRUNCATE", false),
+		ProductionURIPattern:     os.Getenv("PRODUCTION_URI_PATTERN"),
+		Yes:                      env.bool("YES", false),
+		UndoForce:                env.bool("UNDO_FORCE", false),
+		ConnectRetries:           int(env.int64("CONNECT_RETRIES", 3)),
+		MaxPoolSize:              int(env.int64("MAX_POOL_SIZE", 0)),
+		ConnectTimeout:           env.duration("CONNECT_TIMEOUT", 0),
+		SocketTimeout:            env.duration("SOCKET_TIMEOUT", 0),
+		ServerSelectionTimeout:   env.duration("SERVER_SELECTION_TIMEOUT", 0),
+		HeartbeatInterval:        env.duration("HEARTBEAT_INTERVAL", 0),
+		WriteConcern:             os.Getenv("WRITE_CONCERN"),
+		WriteJournal:             env.bool("WRITE_JOURNAL", false),
+		WriteTimeout:             env.duration("WRITE_TIMEOUT", 0),
+		ReadPreference:           os.Getenv("READ_PREFERENCE"),
+		FieldCount:               envOr("FIELD_COUNT", fieldCountStrict),
+		Quotes:                   envOr("QUOTES", quotesStrict),
+		InputFormat:              envOr("INPUT_FORMAT", inputFormatAuto),
+		XLSXSheet:                os.Getenv("XLSX_SHEET"),
+		ParquetColumns:           os.Getenv("PARQUET_COLUMNS"),
+		ArchiveMembers:           envOr("ARCHIVE_MEMBERS", "*.csv"),
+		ReadMode:                 envOr("READ_MODE", readModeBufio),
+		Encoding:                 envOr("ENCODING", encodingAuto),
+		Quiet:                    env.bool("QUIET", false),
+		Dashboard:                env.bool("DASHBOARD", false),
+		ProgressInterval:         env.duration("PROGRESS_INTERVAL", 30*time.Second),
+		ProgressEveryRows:        env.int64("PROGRESS_EVERY_ROWS", 0),
+		RejectsCompress:          env.bool("REJECTS_COMPRESS", false),
+		RejectsMaxSize:           env.size("REJECTS_MAX_SIZE", 0),
+		RejectsMaxFiles:          int(env.int64("REJECTS_MAX_FILES", 0)),
+		AuditCompress:            env.bool("AUDIT_COMPRESS", false),
+		AuditMaxSize:             env.size("AUDIT_MAX_SIZE", 0),
+		AuditMaxFiles:            int(env.int64("AUDIT_MAX_FILES", 0)),
+		BSONOmitEmpty:            env.bool("BSON_OMIT_EMPTY", false),
+		BSONTimeFormat:           envOr("BSON_TIME_FORMAT", timeFormatDate),
+		BSONCodecs:               os.Getenv("BSON_CODECS"),
+		Manifest:                 env.bool("MANIFEST", false),
+		BatchSize:                int(env.int64("BATCH_SIZE", 0)),
+		Serverless:               env.bool("SERVERLESS", false),
+		WriteRate:                env.int64("WRITE_RATE", 0),
+		OffPeakWindow:            os.Getenv("OFF_PEAK_WINDOW"),
+		SnapshotInterval:         env.duration("SNAPSHOT_INTERVAL", 0),
+		ReportsUploadURL:         os.Getenv("REPORTS_UPLOAD_URL"),
+		ReportsUploadEndpoint:    os.Getenv("REPORTS_UPLOAD_ENDPOINT"),
+		CheckpointBackend:        envOr("CHECKPOINT_BACKEND", checkpointBackendFile),
+		CheckpointURL:            os.Getenv("CHECKPOINT_URL"),
+		CheckpointEndpoint:       os.Getenv("CHECKPOINT_ENDPOINT"),
+		CheckpointCollection:     envOr("CHECKPOINT_COLLECTION", "seeder_checkpoints"),
+		LogFormat:                envOr("LOG_FORMAT", logFormatText),
+		LogLevel:                 envOr("LOG_LEVEL", "info"),
+		LogFile:                  os.Getenv("LOG_FILE"),
+		LogMaxSize:               env.size("LOG_MAX_SIZE", 100<<20),
+		LogMaxBackups:            int(env.int64("LOG_MAX_BACKUPS", 5)),
+		LogCompress:              env.bool("LOG_COMPRESS", false),
+	}
+	if rows := os.Getenv("ROWS"); rows != "" {
+		if err := cfg.Rows.Set(rows); err != nil {
+			env.fail("ROWS", err)
+		}
+	}
+	if bbox := os.Getenv("GEO_BBOX"); bbox != "" {
+		if err := cfg.GeoBBox.Set(bbox); err != nil {
+			env.fail("GEO_BBOX", err)
+		}
+	}
+	if err := cfg.SkipColumns.Set(envOr("SKIP_COLUMNS", "auto")); err != nil {
+		env.fail("SKIP_COLUMNS", err)
+	}
+	skipRows := env.int64("SKIP_ROWS", 0)
+	limitRows := env.int64("LIMIT_ROWS", 0)
+	if env.err != nil {
+		return cfg, env.err
+	}
+
+	delimiter := envOr("DELIMITER", ",")
+	quote := envOr("QUOTE", `"`)
+
+	fs := flag.NewFlagSet("seeder", flag.ContinueOnError)
+	fs.StringVar(&cfg.CSVFile, "csv-file", cfg.CSVFile, "CSV file path, http(s), s3://, gs://, az:// or sftp:// URL, or - for stdin; several comma-separated or as a glob")
+	fs.StringVar(&cfg.HookPre, "hook-pre", cfg.HookPre, "shell command run before seeding")
+	fs.StringVar(&cfg.HookSuccess, "hook-success", cfg.HookSuccess, "shell command run after seeding succeeds")
+	fs.StringVar(&cfg.HookFailure, "hook-failure", cfg.HookFailure, "shell command run after seeding fails")
+	fs.StringVar(&cfg.WebhookURL, "webhook-url", cfg.WebhookURL, "URL the run summary is POSTed to when the run finishes or fails")
+	fs.StringVar(&cfg.SlackMinSeverity, "slack-min-severity", cfg.SlackMinSeverity, "least severe outcome sent to Slack: success, warning or failure")
+	fs.StringVar(&cfg.EmailTo, "email-to", cfg.EmailTo, "comma-separated addresses the run summary is emailed to")
+	fs.StringVar(&cfg.EmailMinSeverity, "email-min-severity", cfg.EmailMinSeverity, "least severe outcome emailed: success, warning or failure")
+	fs.StringVar(&cfg.Targets, "targets", cfg.Targets, "comma-separated targets to seed in turn, each with its own MONGO_URI_<NAME> and DB_NAME_<NAME>")
+	fs.IntVar(&cfg.ParallelFiles, "parallel-files", cfg.ParallelFiles, "process up to this many of the CSV_FILE sources at once")
+	fs.IntVar(&cfg.MaxConcurrentInserts, "max-concurrent-inserts", cfg.MaxConcurrentInserts, "batches written at once across parallel files (0 for one per file)")
+	fs.StringVar(&cfg.Schedule, "schedule", cfg.Schedule, "cron expression to seed CSV_FILE on as a long-lived process, e.g. \"0 2 * * *\"")
+	fs.BoolVar(&cfg.ScheduleSkipUnchanged, "schedule-skip-unchanged", cfg.ScheduleSkipUnchanged, "skip scheduled runs while the inputs are unchanged since the last successful one")
+	fs.StringVar(&cfg.ServeAddr, "listen", cfg.ServeAddr, "address serve listens on for CSV uploads")
+	fs.StringVar(&cfg.ServeDir, "serve-dir", cfg.ServeDir, "directory serve keeps uploads and their reports in")
+	fs.StringVar(&cfg.ServeDatabases, "serve-databases", cfg.ServeDatabases, "comma-separated databases uploads may name besides DB_NAME")
+	fs.DurationVar(&cfg.ServeRetention, "serve-retention", cfg.ServeRetention, "how long serve keeps finished imports and their reports")
+	fs.StringVar(&cfg.GRPCAddr, "grpc-listen", cfg.GRPCAddr, "address serve also listens on for the gRPC imports API")
+	fs.StringVar(&cfg.Watch, "watch", cfg.Watch, "watch this directory, seeding files as they arrive and moving them to done/")
+	fs.StringVar(&cfg.WatchPattern, "watch-pattern", cfg.WatchPattern, "glob of the files seeded in watch mode")
+	fs.DurationVar(&cfg.WatchInterval, "watch-interval", cfg.WatchInterval, "how often the watched directory is checked")
+	fs.StringVar(&cfg.SourceEndpoint, "source-endpoint", cfg.SourceEndpoint, "endpoint for object store sources, such as MinIO or Azurite")
+	fs.StringVar(&delimiter, "delimiter", delimiter, "field delimiter: a character, or tab, pipe, semicolon or comma")
+	fs.StringVar(&quote, "quote", quote, "quote character")
+	fs.StringVar(&cfg.Encoding, "encoding", cfg.Encoding, "CSV encoding: auto, utf-8, utf-16le, utf-16be, latin1 or windows-1252")
+	fs.StringVar(&cfg.InputFormat, "input-format", cfg.InputFormat, "input format: auto, csv, ndjson, xlsx or parquet")
+	fs.StringVar(&cfg.XLSXSheet, "xlsx-sheet", cfg.XLSXSheet, "worksheet to read from an xlsx workbook (default the first)")
+	fs.StringVar(&cfg.ParquetColumns, "parquet-columns", cfg.ParquetColumns, "comma-separated columns to read from a Parquet file (default all)")
+	fs.StringVar(&cfg.ArchiveMembers, "archive-members", cfg.ArchiveMembers, "glob of the ZIP or TAR archive members to read")
+	fs.Var(&cfg.SkipColumns, "skip-columns", "leading:trailing columns to drop, none, or auto to detect spreadsheet index and empty trailing columns")
+	fs.StringVar(&cfg.FieldCount, "field-count", cfg.FieldCount, "rows with the wrong number of fields: strict, or pad to pad or truncate them to the header")
+	fs.StringVar(&cfg.Quotes, "quotes", cfg.Quotes, "malformed quoting: strict, lazy, or repair to escape stray quotes and reject rows that still don't parse")
+	fs.StringVar(&cfg.WriteMode, "write-mode", cfg.WriteMode, "how documents are written: insert, upsert, new, refresh or update")
+	fs.StringVar(&cfg.DeleteIDColumn, "delete-id-column", cfg.DeleteIDColumn, "column the delete subcommand reads placeIds from")
+	fs.BoolVar(&cfg.SoftDelete, "soft-delete", cfg.SoftDelete, "have the delete subcommand set isDeleted and deletedAt instead of removing documents")
+	fs.BoolVar(&cfg.Provenance, "provenance", cfg.Provenance, "stamp documents with sourceFile, sourceLine, importRunId and importedAt")
+	fs.BoolVar(&cfg.RecordRuns, "record-runs", cfg.RecordRuns, "record each run in the _seed_runs collection")
+	fs.StringVar(&cfg.Operator, "operator", cfg.Operator, "who is running the seeder, recorded with the run (default the OS user)")
+	fs.BoolVar(&cfg.TagImportID, "tag-import-id", cfg.TagImportID, "store the run's import ID in each document's importId field, for undo")
+	fs.BoolVar(&cfg.UndoForce, "force", cfg.UndoForce, "have undo also undo upsert and refresh runs, deleting the documents they replaced, and unrecorded runs")
+	fs.StringVar(&cfg.IDField, "id-field", cfg.IDField, "mapped field or column whose value becomes each document's _id, e.g. placeId")
+	fs.StringVar(&cfg.IDType, "id-type", cfg.IDType, "how ID_FIELD values are stored as the _id: string, or objectid hashed from the value")
+	fs.StringVar(&cfg.RowHashField, "row-hash-field", cfg.RowHashField, "field storing a hash of each document's source row, needed by refresh")
+	fs.BoolVar(&cfg.Transactions, "transactions", cfg.Transactions, "write each batch in a transaction, needs a replica set")
+	fs.BoolVar(&cfg.MergeDuplicates, "merge-duplicates", cfg.MergeDuplicates, "mark duplicates of an existing place as merged into it")
+	fs.BoolVar(&cfg.DryRun, "dry-run", cfg.DryRun, "parse, map and validate without writing to MongoDB")
+	fs.IntVar(&cfg.DryRunPrint, "dry-run-print", cfg.DryRunPrint, "print the first N documents of a dry run as Extended JSON")
+	fs.Var(&cfg.Rows, "rows", "only process data rows first:last (either end may be open), ignoring the checkpoint")
+	fs.Int64Var(&skipRows, "skip", skipRows, "skip this many data rows, ignoring the checkpoint")
+	fs.StringVar(&cfg.FilterCountry, "filter-country", cfg.FilterCountry, "only write rows from this country, e.g. Bangladesh")
+	fs.StringVar(&cfg.FilterCountryColumn, "filter-country-column", cfg.FilterCountryColumn, "column the country filter reads, the country field's by default")
+	fs.Float64Var(&cfg.NearDuplicateMeters, "near-duplicate-meters", cfg.NearDuplicateMeters, "hold back rows this close to an earlier place with a similar address for review (0 disables)")
+	fs.Float64Var(&cfg.NearDuplicateSimilarity, "near-duplicate-similarity", cfg.NearDuplicateSimilarity, "how alike addresses must be to be near duplicates, 0 to 1")
+	fs.StringVar(&cfg.DedupeKey, "dedupe-key", cfg.DedupeKey, "skip rows repeating an earlier row's value in this column or Place field, e.g. placeId")
+	fs.StringVar(&cfg.Where, "where", cfg.Where, `only write rows this expression is true for, e.g. 'country == "Bangladesh" && postalCode != ""'`)
+	fs.StringVar(&cfg.IncludeColumns, "include-columns", cfg.IncludeColumns, "comma-separated columns, the only ones written to documents")
+	fs.StringVar(&cfg.ExcludeColumns, "exclude-columns", cfg.ExcludeColumns, "comma-separated columns never written to documents")
+	fs.Float64Var(&cfg.Sample, "sample", cfg.Sample, "only write this fraction of the rows, e.g. 0.01, picked by PlaceID")
+	fs.Int64Var(&cfg.SampleEvery, "every", cfg.SampleEvery, "only write every Nth row")
+	fs.Int64Var(&limitRows, "limit", limitRows, "stop after this many data rows (0 for no limit), ignoring the checkpoint")
+	fs.BoolVar(&cfg.StrictSchema, "strict-schema", cfg.StrictSchema, "require the header to match the mapping's columns exactly")
+	fs.BoolVar(&cfg.InferSchema, "infer-schema", cfg.InferSchema, "infer column types instead of using the Place schema")
+	fs.Var(&cfg.GeoBBox, "geo-bbox", "box points are expected in: minLon,minLat,maxLon,maxLat or bangladesh")
+	fs.StringVar(&cfg.GeoBBoxMode, "geo-bbox-mode", cfg.GeoBBoxMode, "rows with points outside the box: reject or flag")
+	fs.StringVar(&cfg.GeoOnInvalid, "geo-on-invalid", cfg.GeoOnInvalid, "missing, unparseable or out of range coordinates: keep, omit or reject")
+	fs.StringVar(&cfg.GeoFormat, "geo-format", cfg.GeoFormat, "how geo fields are written: geojson, pair, fields or none")
+	fs.StringVar(&cfg.GeoSwap, "geo-swap", cfg.GeoSwap, "latitude and longitude that look swapped: off, fix, flag or reject")
+	fs.StringVar(&cfg.AddressNormalize, "address-normalize", cfg.AddressNormalize, "comma-separated address normalization steps: nfc, whitespace, abbreviations, country")
+	fs.StringVar(&cfg.PlusCodeCheck, "plus-code-check", cfg.PlusCodeCheck, "plusCode values that aren't valid plus codes: off, flag or reject")
+	fs.BoolVar(&cfg.PlusCodeDerive, "plus-code-derive", cfg.PlusCodeDerive, "compute empty plusCode values from the location")
+	fs.StringVar(&cfg.GarbageFilter, "garbage-filter", cfg.GarbageFilter, "check address and localArea for junk: off, flag or reject")
+	fs.StringVar(&cfg.SecretsBackend, "secrets-backend", cfg.SecretsBackend, "resolve MONGO_URI from vault or aws (Secrets Manager)")
+	fs.StringVar(&cfg.MongoURISecret, "mongo-uri-secret", cfg.MongoURISecret, "Vault path or AWS secret ID holding the connection string or credentials")
+	fs.StringVar(&cfg.MongoURISecretKey, "mongo-uri-secret-key", cfg.MongoURISecretKey, "key of the connection string in the secret")
+	fs.DurationVar(&cfg.SecretsRefresh, "secrets-refresh", cfg.SecretsRefresh, "resolve the secret again and reconnect this often (0 follows a Vault lease)")
+	fs.StringVar(&cfg.TLSCAFile, "tls-ca-file", cfg.TLSCAFile, "PEM file of the CA to verify MongoDB's certificate with")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert-file", cfg.TLSCertFile, "PEM client certificate for mutual TLS")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key-file", cfg.TLSKeyFile, "PEM key of the client certificate, if not in its file")
+	fs.BoolVar(&cfg.TLSInsecure, "tls-insecure", cfg.TLSInsecure, "skip verifying MongoDB's certificate, for testing only")
+	fs.IntVar(&cfg.ConnectRetries, "connect-retries", cfg.ConnectRetries, "times to retry reaching MongoDB at startup, with doubling waits")
+	fs.IntVar(&cfg.MaxPoolSize, "max-pool-size", cfg.MaxPoolSize, "most connections the client pools (0 keeps the default)")
+	fs.DurationVar(&cfg.ConnectTimeout, "connect-timeout", cfg.ConnectTimeout, "how long to wait for a connection to open (0 keeps the default)")
+	fs.DurationVar(&cfg.SocketTimeout, "socket-timeout", cfg.SocketTimeout, "how long to wait for a socket read or write (0 keeps the default)")
+	fs.DurationVar(&cfg.ServerSelectionTimeout, "server-selection-timeout", cfg.ServerSelectionTimeout, "how long to wait for a suitable server (0 keeps the default)")
+	fs.DurationVar(&cfg.HeartbeatInterval, "heartbeat-interval", cfg.HeartbeatInterval, "how often servers are checked (0 keeps the default)")
+	fs.StringVar(&cfg.WriteConcern, "write-concern", cfg.WriteConcern, "write concern w: majority, a node count (0 for unacknowledged) or a tag set")
+	fs.BoolVar(&cfg.WriteJournal, "write-journal", cfg.WriteJournal, "wait for writes to reach the journal")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout, "how long to wait for the write concern before failing (0 waits indefinitely)")
+	fs.StringVar(&cfg.ReadPreference, "read-preference", cfg.ReadPreference, "primary, primaryPreferred, secondary, secondaryPreferred or nearest")
+	fs.IntVar(&cfg.WarmupConnections, "warmup-connections", cfg.WarmupConnections, "open and ping this many pooled connections before reading (0 disables)")
+	fs.BoolVar(&cfg.BSONOmitEmpty, "bson-omit-empty", cfg.BSONOmitEmpty, "leave empty fields out of documents, as if every field were omitempty")
+	fs.StringVar(&cfg.BSONTimeFormat, "bson-time-format", cfg.BSONTimeFormat, "how times are stored: date, rfc3339, unix or unixms")
+	fs.StringVar(&cfg.BSONCodecs, "bson-codecs", cfg.BSONCodecs, "comma-separated codecs to encode documents with: nilslice, int32")
+	fs.BoolVar(&cfg.Manifest, "manifest", cfg.Manifest, "write an integrity manifest of the run to the _seeder_manifests collection")
+	fs.IntVar(&cfg.BatchSize, "batch-size", cfg.BatchSize, "documents written per batch (default 1000, or 100 with -serverless)")
+	fs.BoolVar(&cfg.Serverless, "serverless", cfg.Serverless, "target Atlas serverless: smaller batches and estimated RPUs/WPUs in the summary")
+	fs.Int64Var(&cfg.WriteRate, "write-rate", cfg.WriteRate, "write at most N documents per second (0 for no limit)")
+	fs.StringVar(&cfg.OffPeakWindow, "off-peak-window", cfg.OffPeakWindow, "only write between HH:MM-HH:MM local time")
+	fs.DurationVar(&cfg.SnapshotInterval, "snapshot-interval", cfg.SnapshotInterval, "export newly written documents as NDJSON this often (0 disables)")
+	fs.BoolVar(&cfg.Quiet, "quiet", cfg.Quiet, "suppress all progress output")
+	fs.BoolVar(&cfg.Dashboard, "dashboard", cfg.Dashboard, "show files processed in parallel on a dashboard instead of bars")
+	fs.DurationVar(&cfg.ProgressInterval, "progress-interval", cfg.ProgressInterval, "log progress this often when not on a terminal (0 disables)")
+	fs.Int64Var(&cfg.ProgressEveryRows, "progress-every", cfg.ProgressEveryRows, "log progress every N rows when not on a terminal (0 disables)")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "log output format: text or json")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "minimum log level: debug, info, warn or error")
+	fs.StringVar(&cfg.LogFile, "log-file", cfg.LogFile, "write logs to this file instead of stderr")
+	fs.String("env-file", "", "load variables from this file instead of .env (also ENV_FILE)")
+	fs.String("profile", "", "load variables from .env.<profile> first, e.g. prod for .env.prod (also PROFILE)")
+	fs.BoolVar(&cfg.Yes, "yes", cfg.Yes, "don't ask for confirmation before writing to a production cluster or emptying the collection")
+	fs.BoolVar(&cfg.SchemaValidator, "schema-validator", cfg.SchemaValidator, "create the collection with a $jsonSchema validator derived from the mapping")
+	fs.StringVar(&cfg.SchemaValidationAction, "schema-validation-action", cfg.SchemaValidationAction, "what the server does with documents failing the validator: error or warn")
+	fs.StringVar(&cfg.CollectionType, "collection-type", cfg.CollectionType, "create the collection as a timeseries or capped collection")
+	fs.StringVar(&cfg.TimeSeriesTimeField, "timeseries-time-field", cfg.TimeSeriesTimeField, "date field holding each measurement's time")
+	fs.StringVar(&cfg.TimeSeriesMetaField, "timeseries-meta-field", cfg.TimeSeriesMetaField, "field holding the metadata identifying a series")
+	fs.StringVar(&cfg.RouteColumn, "route-column", cfg.RouteColumn, "column or Place field whose value picks each row's collection from --routes")
+	fs.StringVar(&cfg.Routes, "routes", cfg.Routes, "comma-separated value=collection or value=database.collection routes, * for the rest")
+	fs.StringVar(&cfg.CheckpointBackend, "checkpoint-backend", cfg.CheckpointBackend, "where checkpoints are kept: file, mongodb, redis or s3")
+	fs.StringVar(&cfg.CheckpointURL, "checkpoint-url", cfg.CheckpointURL, "redis:// server or s3:// or gs:// prefix checkpoints are kept in")
+	fs.BoolVar(&cfg.Recreate, "recreate", cfg.Recreate, "drop the collection, indexes and all, before seeding from the first row")
+	fs.BoolVar(&cfg.Truncate, "truncate", cfg.Truncate, "delete the collection's documents before seeding from the first row")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	// Input piped in with no file named is read from stdin
+	if cfg.CSVFile == "" && cfg.Watch == "" && !serve {
+		if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+			cfg.CSVFile = stdinPath
+		}
+	}
+
+	// Watch mode finds its own files, and the server is sent them
+	csvFile := cfg.CSVFile
+	switch {
+	case cfg.Watch != "":
+		csvFile = cfg.Watch
+	case serve:
+		csvFile = cfg.ServeDir
+	}
+	required := []struct{ name, value string }{
+		{"CSV_FILE", csvFile},
+		{"MONGO_URI", cfg.MongoURI},
+		{"DB_NAME", cfg.DBName},
+		{"COLLECTION_NAME", cfg.CollectionName},
+	}
+	for _, r := range required {
+		// Targets can each have their own URI and database, which
+		// seedTargets checks
+		perTarget := cfg.Targets != "" && (r.name == "MONGO_URI" || r.name == "DB_NAME")
+		if r.value == "" && !perTarget {
+			return cfg, fmt.Errorf("%s environment variable not set", r.name)
+		}
+	}
+
+	// Skipping and limiting rows is another way to give the row range
+	if skipRows < 0 || limitRows < 0 {
+		return cfg, fmt.Errorf("SKIP_ROWS and LIMIT_ROWS must not be negative")
+	}
+	if skipRows > 0 || limitRows > 0 {
+		if cfg.Rows.set() {
+			return cfg, fmt.Errorf("ROWS can't be combined with SKIP_ROWS or LIMIT_ROWS")
+		}
+		cfg.Rows = rowRange{First: skipRows + 1}
+		if limitRows > 0 {
+			cfg.Rows.Last = skipRows + limitRows
+		}
+	}
+
+	if cfg.IncludeColumns != "" && cfg.ExcludeColumns != "" {
+		return cfg, fmt.Errorf("INCLUDE_COLUMNS and EXCLUDE_COLUMNS can't be combined")
+	}
+	if cfg.NearDuplicateMeters < 0 {
+		return cfg, fmt.Errorf("NEAR_DUPLICATE_METERS must not be negative")
+	}
+	if cfg.NearDuplicateSimilarity < 0 || cfg.NearDuplicateSimilarity > 1 {
+		return cfg, fmt.Errorf("NEAR_DUPLICATE_SIMILARITY must be between 0 and 1")
+	}
+	if cfg.NearDuplicateMaxPlaces < 0 || cfg.NearDuplicateMaxPerCell < 0 {
+		return cfg, fmt.Errorf("NEAR_DUPLICATE_MAX_PLACES and NEAR_DUPLICATE_MAX_PER_CELL must not be negative")
+	}
+
+	if cfg.Sample < 0 || cfg.Sample > 1 {
+		return cfg, fmt.Errorf("SAMPLE must be a fraction between 0 and 1")
+	}
+	if cfg.SampleEvery < 0 {
+		return cfg, fmt.Errorf("SAMPLE_EVERY must not be negative")
+	}
+	if cfg.Sample > 0 && cfg.SampleEvery > 0 {
+		return cfg, fmt.Errorf("SAMPLE and SAMPLE_EVERY can't be combined")
+	}
+
+	var err error
+	if cfg.Delimiter, err = parseDialectChar("DELIMITER", delimiter); err != nil {
+		return cfg, err
+	}
+	if cfg.Quote, err = parseDialectChar("QUOTE", quote); err != nil {
+		return cfg, err
+	}
+	if cfg.Quote >= utf8.RuneSelf || cfg.Quote == cfg.Delimiter {
+		return cfg, fmt.Errorf("QUOTE must be an ASCII character other than the delimiter")
+	}
+
+	switch cfg.Quotes {
+	case quotesStrict, quotesLazy, quotesRepair:
+	default:
+		return cfg, fmt.Errorf("QUOTES must be %q, %q or %q", quotesStrict, quotesLazy, quotesRepair)
+	}
+
+	switch cfg.FieldCount {
+	case fieldCountStrict, fieldCountPad:
+	default:
+		return cfg, fmt.Errorf("FIELD_COUNT must be %q or %q", fieldCountStrict, fieldCountPad)
+	}
+
+	switch cfg.DuplicateHeaders {
+	case duplicateHeadersRename, duplicateHeadersError:
+	default:
+		return cfg, fmt.Errorf("DUPLICATE_HEADERS must be %q or %q", duplicateHeadersRename, duplicateHeadersError)
+	}
+
+	switch cfg.ReadMode {
+	case readModeBufio, readModeMmap:
+	default:
+		return cfg, fmt.Errorf("READ_MODE must be %q or %q", readModeBufio, readModeMmap)
+	}
+
+	switch cfg.InputFormat {
+	case inputFormatAuto, inputFormatCSV, inputFormatNDJSON, inputFormatXLSX, inputFormatParquet:
+	default:
+		return cfg, fmt.Errorf("INPUT_FORMAT must be %q, %q, %q, %q or %q", inputFormatAuto, inputFormatCSV, inputFormatNDJSON, inputFormatXLSX, inputFormatParquet)
+	}
+
+	if _, err := path.Match(cfg.ArchiveMembers, ""); err != nil {
+		return cfg, fmt.Errorf("ARCHIVE_MEMBERS %q: %w", cfg.ArchiveMembers, err)
+	}
+	if _, err := path.Match(cfg.WatchPattern, ""); err != nil {
+		return cfg, fmt.Errorf("WATCH_PATTERN %q: %w", cfg.WatchPattern, err)
+	}
+	if cfg.WatchInterval <= 0 {
+		return cfg, fmt.Errorf("WATCH_INTERVAL must be positive")
+	}
+	if cfg.ParallelFiles < 1 {
+		return cfg, fmt.Errorf("PARALLEL_FILES must be at least 1")
+	}
+	if cfg.MaxConcurrentInserts < 0 {
+		return cfg, fmt.Errorf("MAX_CONCURRENT_INSERTS must not be negative")
+	}
+
+	cfg.Encoding = strings.ToLower(cfg.Encoding)
+	if _, ok := encodings[cfg.Encoding]; !ok && cfg.Encoding != encodingAuto {
+		return cfg, fmt.Errorf("ENCODING must be %q, %q, %q, %q, %q or %q", encodingAuto, encodingUTF8, encodingUTF16LE, encodingUTF16BE, encodingLatin1, encodingWindows1252)
+	}
+
+	switch cfg.WriteMode {
+	case writeModeInsert, writeModeUpsert, writeModeNew, writeModeRefresh, writeModeUpdate:
+	default:
+		return cfg, fmt.Errorf("WRITE_MODE must be %q, %q, %q, %q or %q", writeModeInsert, writeModeUpsert, writeModeNew, writeModeRefresh, writeModeUpdate)
+	}
+	switch cfg.IDType {
+	case idTypeString, idTypeObjectID:
+	default:
+		return cfg, fmt.Errorf("ID_TYPE must be %q or %q", idTypeString, idTypeObjectID)
+	}
+	if cfg.IDType == idTypeObjectID && cfg.IDField == "" {
+		return cfg, fmt.Errorf("ID_TYPE %q needs ID_FIELD", idTypeObjectID)
+	}
+	if cfg.WriteMode == writeModeRefresh && cfg.RowHashField == "" {
+		return cfg, fmt.Errorf("WRITE_MODE %q needs ROW_HASH_FIELD", writeModeRefresh)
+	}
+	if placeFields[cfg.RowHashField] || cfg.RowHashField == importIDField {
+		return cfg, fmt.Errorf("ROW_HASH_FIELD %q clashes with another field", cfg.RowHashField)
+	}
+
+	switch cfg.BoundariesMode {
+	case boundariesValidate, boundariesFill:
+	default:
+		return cfg, fmt.Errorf("BOUNDARIES_MODE must be %q or %q", boundariesValidate, boundariesFill)
+	}
+
+	switch cfg.GeoBBoxMode {
+	case bboxModeReject, bboxModeFlag:
+	default:
+		return cfg, fmt.Errorf("GEO_BBOX_MODE must be %q or %q", bboxModeReject, bboxModeFlag)
+	}
+
+	switch cfg.GeoOnInvalid {
+	case geoInvalidKeep, geoInvalidOmit, geoInvalidReject:
+	default:
+		return cfg, fmt.Errorf("GEO_ON_INVALID must be %q, %q or %q", geoInvalidKeep, geoInvalidOmit, geoInvalidReject)
+	}
+
+	switch cfg.GeoFormat {
+	case geoFormatGeoJSON, geoFormatPair, geoFormatFields, geoFormatNone:
+	default:
+		return cfg, fmt.Errorf("GEO_FORMAT must be %q, %q, %q or %q", geoFormatGeoJSON, geoFormatPair, geoFormatFields, geoFormatNone)
+	}
+
+	switch cfg.GeoSwap {
+	case geoSwapOff, geoSwapFix, geoSwapFlag, geoSwapReject:
+	default:
+		return cfg, fmt.Errorf("GEO_SWAP must be %q, %q, %q or %q", geoSwapOff, geoSwapFix, geoSwapFlag, geoSwapReject)
+	}
+
+	switch cfg.PlusCodeCheck {
+	case plusCodeCheckOff, plusCodeCheckFlag, plusCodeCheckReject:
+	default:
+		return cfg, fmt.Errorf("PLUS_CODE_CHECK must be %q, %q or %q", plusCodeCheckOff, plusCodeCheckFlag, plusCodeCheckReject)
+	}
+
+	switch cfg.GarbageFilter {
+	case garbageFilterOff, garbageFilterFlag, garbageFilterReject:
+	default:
+		return cfg, fmt.Errorf("GARBAGE_FILTER must be %q, %q or %q", garbageFilterOff, garbageFilterFlag, garbageFilterReject)
+	}
+
+	if cfg.InferSchema {
+		if option := cfg.placeOnlyOption(); option != "" {
+			return cfg, fmt.Errorf("%s needs the Place schema, not INFER_SCHEMA", option)
+		}
+		if cfg.InferSampleRows < 1 {
+			return cfg, fmt.Errorf("INFER_SAMPLE_ROWS must be at least 1")
+		}
+	}
+
+	switch cfg.BSONTimeFormat {
+	case timeFormatDate, timeFormatRFC3339, timeFormatUnix, timeFormatUnixMs:
+	default:
+		return cfg, fmt.Errorf("BSON_TIME_FORMAT must be %q, %q, %q or %q", timeFormatDate, timeFormatRFC3339, timeFormatUnix, timeFormatUnixMs)
+	}
+	if _, err := parseBSONCodecs(cfg.BSONCodecs); err != nil {
+		return cfg, err
+	}
+
+	switch {
+	case cfg.BatchSize < 0:
+		return cfg, fmt.Errorf("BATCH_SIZE can't be negative")
+	case cfg.BatchSize == 0 && cfg.Serverless:
+		cfg.BatchSize = serverlessBatchSize
+	case cfg.BatchSize == 0:
+		cfg.BatchSize = 1000
+	}
+	if cfg.WriteRate < 0 {
+		return cfg, fmt.Errorf("WRITE_RATE can't be negative")
+	}
+	if _, err := parseOffPeakWindow(cfg.OffPeakWindow); err != nil {
+		return cfg, fmt.Errorf("OFF_PEAK_WINDOW: %w", err)
+	}
+
+	switch cfg.SecretsBackend {
+	case "":
+	case secretsBackendVault, secretsBackendAWS:
+		if cfg.MongoURISecret == "" {
+			return cfg, fmt.Errorf("SECRETS_BACKEND %q needs MONGO_URI_SECRET", cfg.SecretsBackend)
+		}
+	default:
+		return cfg, fmt.Errorf("SECRETS_BACKEND must be empty, %q or %q", secretsBackendVault, secretsBackendAWS)
+	}
+	if serve && (cfg.Watch != "" || cfg.Schedule != "") {
+		return cfg, fmt.Errorf("serve takes its files by upload, so can't be combined with WATCH or SCHEDULE")
+	}
+	if serve && (cfg.Recreate || cfg.Truncate) {
+		return cfg, fmt.Errorf("serve can't be combined with RECREATE or TRUNCATE, which would empty the collection for every upload")
+	}
+	if serve && cfg.ServeToken == "" {
+		for _, addr := range []string{cfg.ServeAddr, cfg.GRPCAddr} {
+			if addr != "" && !isLoopback(addr) {
+				return cfg, fmt.Errorf("SERVE_TOKEN must be set for serve to listen beyond localhost on %s", addr)
+			}
+		}
+	}
+	if cfg.ServeMaxUpload <= 0 {
+		return cfg, fmt.Errorf("SERVE_MAX_UPLOAD must be positive")
+	}
+	if cfg.ServeRetention <= 0 {
+		return cfg, fmt.Errorf("SERVE_RETENTION must be positive")
+	}
+	if cfg.Schedule != "" {
+		if _, err := cron.ParseStandard(cfg.Schedule); err != nil {
+			return cfg, fmt.Errorf("SCHEDULE: %w", err)
+		}
+		switch {
+		case cfg.Watch != "":
+			return cfg, fmt.Errorf("SCHEDULE can't be combined with WATCH")
+		case cfg.CSVFile == stdinPath:
+			return cfg, fmt.Errorf("SCHEDULE reads the input again on every run, so can't read stdin")
+		}
+	}
+	if cfg.Targets != "" {
+		switch {
+		case cfg.SecretsBackend != "":
+			return cfg, fmt.Errorf("TARGETS can't be combined with SECRETS_BACKEND")
+		case cfg.Watch != "":
+			return cfg, fmt.Errorf("TARGETS can't be combined with WATCH")
+		case cfg.CSVFile == stdinPath:
+			return cfg, fmt.Errorf("TARGETS read the input once for each target, so can't read stdin")
+		}
+	}
+	if cfg.TLSKeyFile != "" && cfg.TLSCertFile == "" {
+		return cfg, fmt.Errorf("MONGO_TLS_KEY_FILE needs MONGO_TLS_CERT_FILE")
+	}
+	switch cfg.SchemaValidationAction {
+	case validationActionError, validationActionWarn:
+	default:
+		return cfg, fmt.Errorf("SCHEMA_VALIDATION_ACTION must be %q or %q", validationActionError, validationActionWarn)
+	}
+	switch cfg.CollectionType {
+	case "":
+	case collectionTypeTimeSeries:
+		if cfg.TimeSeriesTimeField == "" {
+			return cfg, fmt.Errorf("COLLECTION_TYPE %q needs TIMESERIES_TIME_FIELD", collectionTypeTimeSeries)
+		}
+		if cfg.BSONTimeFormat != timeFormatDate {
+			return cfg, fmt.Errorf("COLLECTION_TYPE %q needs times stored as dates, BSON_TIME_FORMAT %q", collectionTypeTimeSeries, timeFormatDate)
+		}
+		if cfg.WriteMode != writeModeInsert {
+			return cfg, fmt.Errorf("COLLECTION_TYPE %q only takes WRITE_MODE %q", collectionTypeTimeSeries, writeModeInsert)
+		}
+		switch cfg.TimeSeriesGranularity {
+		case "", "seconds", "minutes", "hours":
+		default:
+			return cfg, fmt.Errorf("TIMESERIES_GRANULARITY must be seconds, minutes or hours")
+		}
+	case collectionTypeCapped:
+		if cfg.CappedSize <= 0 {
+			return cfg, fmt.Errorf("COLLECTION_TYPE %q needs CAPPED_SIZE", collectionTypeCapped)
+		}
+	default:
+		return cfg, fmt.Errorf("COLLECTION_TYPE must be empty, %q or %q", collectionTypeTimeSeries, collectionTypeCapped)
+	}
+	if cfg.Routes != "" && cfg.RouteColumn == "" {
+		return cfg, fmt.Errorf("ROUTES needs ROUTE_COLUMN")
+	}
+	if cfg.RouteColumn != "" {
+		switch {
+		case cfg.WriteMode == writeModeNew || cfg.WriteMode == writeModeRefresh:
+			return cfg, fmt.Errorf("ROUTE_COLUMN can't be combined with WRITE_MODE %q", cfg.WriteMode)
+		case cfg.MergeDuplicates:
+			return cfg, fmt.Errorf("ROUTE_COLUMN can't be combined with MERGE_DUPLICATES")
+		case cfg.SnapshotInterval > 0:
+			return cfg, fmt.Errorf("ROUTE_COLUMN can't be combined with SNAPSHOT_INTERVAL")
+		case cfg.Recreate || cfg.Truncate:
+			return cfg, fmt.Errorf("RECREATE and TRUNCATE only empty COLLECTION_NAME, so can't be combined with ROUTE_COLUMN")
+		}
+	}
+	if cfg.Recreate && cfg.Truncate {
+		return cfg, fmt.Errorf("RECREATE and TRUNCATE can't be combined")
+	}
+	if (cfg.Recreate || cfg.Truncate) && cfg.Rows.set() {
+		return cfg, fmt.Errorf("RECREATE and TRUNCATE seed from the first row, so can't be combined with ROWS")
+	}
+	if _, err := regexp.Compile(cfg.ProductionURIPattern); err != nil {
+		return cfg, fmt.Errorf("PRODUCTION_URI_PATTERN: %w", err)
+	}
+	if cfg.ConnectRetries < 0 {
+		return cfg, fmt.Errorf("CONNECT_RETRIES can't be negative")
+	}
+	if cfg.MaxPoolSize < 0 {
+		return cfg, fmt.Errorf("MAX_POOL_SIZE can't be negative")
+	}
+	if cfg.MaxPoolSize > 0 && cfg.WarmupConnections > cfg.MaxPoolSize {
+		return cfg, fmt.Errorf("WARMUP_CONNECTIONS can't be more than MAX_POOL_SIZE")
+	}
+	for name, severity := range map[string]string{"SLACK_MIN_SEVERITY": cfg.SlackMinSeverity, "EMAIL_MIN_SEVERITY": cfg.EmailMinSeverity} {
+		if _, ok := severityRanks[severity]; !ok {
+			return cfg, fmt.Errorf("%s must be %q, %q or %q", name, severitySuccess, severityWarning, severityFailure)
+		}
+	}
+	if cfg.EmailTo != "" && (cfg.SMTPHost == "" || cfg.EmailFrom == "") {
+		return cfg, fmt.Errorf("EMAIL_TO needs SMTP_HOST and EMAIL_FROM")
+	}
+	if (cfg.WebhookURL != "" || cfg.SlackWebhookURL != "") && cfg.WebhookTimeout <= 0 {
+		return cfg, fmt.Errorf("WEBHOOK_TIMEOUT must be positive")
+	}
+	if cfg.HeartbeatInterval > 0 && cfg.HeartbeatInterval < 500*time.Millisecond {
+		return cfg, fmt.Errorf("HEARTBEAT_INTERVAL can't be under 500ms")
+	}
+	if cfg.WriteJournal && cfg.WriteConcern == "0" {
+		return cfg, fmt.Errorf("WRITE_JOURNAL can't be used with unacknowledged writes, WRITE_CONCERN 0")
+	}
+	if cfg.Transactions && cfg.WriteConcern == "0" {
+		return cfg, fmt.Errorf("TRANSACTIONS can't be used with unacknowledged writes, WRITE_CONCERN 0")
+	}
+	if cfg.WarmupConnections < 0 {
+		return cfg, fmt.Errorf("WARMUP_CONNECTIONS can't be negative")
+	}
+
+	if cfg.ReportsUploadURL != "" && !strings.HasPrefix(cfg.ReportsUploadURL, "s3://") && !strings.HasPrefix(cfg.ReportsUploadURL, "gs://") {
+		return cfg, fmt.Errorf("REPORTS_UPLOAD_URL must start with s3:// or gs://")
+	}
+
+	switch cfg.CheckpointBackend {
+	case checkpointBackendFile, checkpointBackendMongoDB:
+	case checkpointBackendRedis:
+		if !strings.HasPrefix(cfg.CheckpointURL, "redis://") && !strings.HasPrefix(cfg.CheckpointURL, "rediss://") {
+			return cfg, fmt.Errorf("CHECKPOINT_BACKEND %q needs CHECKPOINT_URL starting with redis:// or rediss://", checkpointBackendRedis)
+		}
+	case checkpointBackendS3:
+		if !strings.HasPrefix(cfg.CheckpointURL, "s3://") && !strings.HasPrefix(cfg.CheckpointURL, "gs://") {
+			return cfg, fmt.Errorf("CHECKPOINT_BACKEND %q needs CHECKPOINT_URL starting with s3:// or gs://", checkpointBackendS3)
+		}
+	default:
+		return cfg, fmt.Errorf("CHECKPOINT_BACKEND must be %q, %q, %q or %q", checkpointBackendFile, checkpointBackendMongoDB, checkpointBackendRedis, checkpointBackendS3)
+	}
+
+	switch cfg.LogFormat {
+	case logFormatText, logFormatJSON:
+	default:
+		return cfg, fmt.Errorf("LOG_FORMAT must be %q or %q", logFormatText, logFormatJSON)
+	}
+
+	return cfg, nil
+}
+
+// Name of the first option set that only applies to the Place schema, not
+// generic documents
+func (cfg Config) placeOnlyOption() string {
+	switch {
+	case cfg.MergeDuplicates:
+		return "MERGE_DUPLICATES"
+	case cfg.BoundariesFile != "":
+		return "BOUNDARIES_FILE"
+	case cfg.GarbageFilter != garbageFilterOff:
+		return "GARBAGE_FILTER"
+	case cfg.GeoBBox.set():
+		return "GEO_BBOX"
+	case cfg.GeoSwap != geoSwapOff:
+		return "GEO_SWAP"
+	case cfg.GeoOnInvalid != geoInvalidKeep:
+		return "GEO_ON_INVALID"
+	case cfg.GeoFormat != geoFormatGeoJSON:
+		return "GEO_FORMAT"
+	case cfg.NearDuplicateMeters > 0:
+		return "NEAR_DUPLICATE_METERS"
+	case cfg.AddressNormalize != "":
+		return "ADDRESS_NORMALIZE"
+	case cfg.PlusCodeCheck != plusCodeCheckOff:
+		return "PLUS_CODE_CHECK"
+	case cfg.PlusCodeDerive:
+		return "PLUS_CODE_DERIVE"
+	}
+	return ""
+}
+
+// Get an environment variable or a default when unset
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envParser reads typed environment variables, keeping the first parse error
+type envParser struct {
+	err error
+}
+
+func (p *envParser) bool(name string, fallback bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		p.fail(name, err)
+		return fallback
+	}
+	return parsed
+}
+
+func (p *envParser) int64(name string, fallback int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		p.fail(name, err)
+		return fallback
+	}
+	return parsed
+}
+
+func (p *envParser) float64(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		p.fail(name, err)
+		return fallback
+	}
+	return parsed
+}
+
+func (p *envParser) duration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		p.fail(name, err)
+		return fallback
+	}
+	return parsed
+}
+
+func (p *envParser) size(name string, fallback int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := parseSize(value)
+	if err != nil {
+		p.fail(name, err)
+		return fallback
+	}
+	return parsed
+}
+
+func (p *envParser) fail(name string, err error) {
+	if p.err == nil {
+		p.err = fmt.Errorf("invalid %s: %w", name, err)
+	}
+}
+
+// Whether the host:port address only listens on the loopback interface
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
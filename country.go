@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// countryFilter keeps the rows whose country column names one country
+type countryFilter struct {
+	country string
+	column  int
+}
+
+// Resolve the country filter's column: the configured header name, or else
+// the column the country field is read from. Nil when no country is set.
+func newCountryFilter(cfg Config, header *Header, cols columns) (*countryFilter, error) {
+	if cfg.FilterCountry == "" {
+		return nil, nil
+	}
+	name := cfg.FilterCountryColumn
+	if name == "" {
+		if i, ok := cols["country"]; ok {
+			return &countryFilter{country: cfg.FilterCountry, column: i}, nil
+		}
+		name = "country"
+	}
+	i, ok := header.Index(name)
+	if !ok {
+		return nil, fmt.Errorf("FILTER_COUNTRY_COLUMN: column %q not found in header", name)
+	}
+	return &countryFilter{country: cfg.FilterCountry, column: i}, nil
+}
+
+// Whether the row is in the country, ignoring case and surrounding space
+func (f *countryFilter) keep(record []string) bool {
+	return f.column < len(record) && strings.EqualFold(strings.TrimSpace(record[f.column]), f.country)
+}
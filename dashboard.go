@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Dashboard layout: how often it is redrawn, the seconds of throughput
+// graphed, the files and errors listed and the widths lines are cut to
+const (
+	dashboardInterval   = 500 * time.Millisecond
+	dashboardSamples    = 60
+	dashboardFiles      = 20
+	dashboardErrors     = 8
+	dashboardBarWidth   = 24
+	dashboardLineLength = 140
+)
+
+// Heights of the throughput graph's columns
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// Dashboard the files processed in parallel are drawn on, nil when there
+// isn't one
+var progressDashboard *dashboard
+
+// dashboard redraws the progress of files processed in parallel in place:
+// a bar per file, overall throughput over time, rejects by error kind and
+// the latest rejected rows and logged warnings
+type dashboard struct {
+	out      io.Writer
+	total    int
+	started  time.Time
+	stop     chan struct{}
+	stopped  chan struct{}
+	previous *slog.Logger
+
+	mu       sync.Mutex
+	files    []*dashboardFile
+	finished int
+	failed   int
+	logged   []dashboardError
+	held     []byte
+
+	// Redraw state, only touched by the drawing goroutine
+	samples  []float64
+	lastRows int64
+	lastAt   time.Time
+	lines    int
+}
+
+// dashboardFile is one file's row on the dashboard, and its progress
+type dashboardFile struct {
+	source string
+	name   string
+	total  int64
+	offset atomic.Int64
+	stats  *runStats
+	state  string // running, done or failed
+}
+
+// dashboardError is a rejected row or logged warning listed on the dashboard
+type dashboardError struct {
+	at      time.Time
+	file    string
+	message string
+}
+
+// Start drawing the dashboard for a run of total files, taking over the
+// logger so lines below warnings don't scroll it away unless they go to
+// LOG_FILE. Warnings and errors are listed on the dashboard instead.
+func startDashboard(cfg Config, total int) *dashboard {
+	now := time.Now()
+	d := &dashboard{
+		out:      os.Stderr,
+		total:    total,
+		started:  now,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		previous: slog.Default(),
+		lastAt:   now,
+	}
+	slog.SetDefault(slog.New(dashboardLogs{Handler: d.previous.Handler(), dashboard: d, passThrough: cfg.LogFile != ""}))
+	go d.run()
+	return d
+}
+
+// Stop redrawing, leaving the final dashboard on screen, give the logger
+// back and print what was held back from stdout
+func (d *dashboard) close() {
+	close(d.stop)
+	<-d.stopped
+	slog.SetDefault(d.previous)
+	os.Stdout.Write(d.held)
+}
+
+// Write summaries and dry-run documents to stdout, held back while the
+// dashboard is drawn so they don't scroll it away
+func writeStdout(data []byte) error {
+	if d := progressDashboard; d != nil {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.held = append(d.held, data...)
+		return nil
+	}
+	_, err := os.Stdout.Write(data)
+	return err
+}
+
+func (d *dashboard) run() {
+	defer close(d.stopped)
+	ticker := time.NewTicker(dashboardInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.draw()
+		case <-d.stop:
+			d.draw()
+			return
+		}
+	}
+}
+
+// Add a file's row, as it starts being read
+func (d *dashboard) add(source string, total int64, stats *runStats) *dashboardFile {
+	file := &dashboardFile{source: source, name: filepath.Base(source), total: total, stats: stats, state: "running"}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.files = append(d.files, file)
+	return file
+}
+
+// Mark the file done, or failed with err. Files finished without being
+// read, as an earlier run completed them, get no row.
+func (d *dashboard) done(source string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.finished++
+	if err != nil {
+		d.failed++
+	}
+	for _, file := range d.files {
+		if file.source == source && file.state == "running" {
+			file.state = "done"
+			if err != nil {
+				file.state = "failed"
+			}
+			break
+		}
+	}
+}
+
+// Keep a logged warning or error to list
+func (d *dashboard) log(record slog.Record) {
+	message, file := record.Message, ""
+	record.Attrs(func(attr slog.Attr) bool {
+		switch attr.Key {
+		case "file":
+			file = filepath.Base(attr.Value.String())
+		case "error":
+			message += ": " + attr.Value.String()
+		}
+		return true
+	})
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.logged) == dashboardErrors {
+		d.logged = d.logged[1:]
+	}
+	d.logged = append(d.logged, dashboardError{at: record.Time, file: file, message: message})
+}
+
+func (f *dashboardFile) update(offset int64) {
+	f.offset.Store(offset)
+}
+
+func (f *dashboardFile) finish() {
+	f.offset.Store(f.total)
+}
+
+// Redraw over the previous dashboard
+func (d *dashboard) draw() {
+	lines := d.render()
+	var b strings.Builder
+	if d.lines > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", d.lines)
+	}
+	b.WriteString("\r\x1b[J")
+	for _, line := range lines {
+		if len([]rune(line)) > dashboardLineLength {
+			line = string([]rune(line)[:dashboardLineLength-1]) + "…"
+		}
+		b.WriteString(line + "\n")
+	}
+	io.WriteString(d.out, b.String())
+	d.lines = len(lines)
+}
+
+// The dashboard's lines, sampling throughput since the last redraw
+func (d *dashboard) render() []string {
+	// Files with their state as of now, as it changes under the lock
+	type fileState struct {
+		*dashboardFile
+		state string
+	}
+	d.mu.Lock()
+	files := make([]fileState, len(d.files))
+	for i, file := range d.files {
+		files[i] = fileState{file, file.state}
+	}
+	finished, failed := d.finished, d.failed
+	errs := append([]dashboardError(nil), d.logged...)
+	d.mu.Unlock()
+
+	var rows int64
+	byKind := map[string]int64{}
+	for _, file := range files {
+		rows += file.stats.rowsRead.Load()
+		for kind, n := range file.stats.errorCounts() {
+			byKind[kind] += n
+		}
+		for _, rejected := range file.stats.recentRejected() {
+			errs = append(errs, dashboardError{at: rejected.at, file: file.name, message: rejected.reason})
+		}
+	}
+
+	now := time.Now()
+	rate := float64(rows-d.lastRows) / now.Sub(d.lastAt).Seconds()
+	d.lastRows, d.lastAt = rows, now
+	if len(d.samples) == dashboardSamples {
+		d.samples = d.samples[1:]
+	}
+	d.samples = append(d.samples, rate)
+
+	running := 0
+	for _, file := range files {
+		if file.state == "running" {
+			running++
+		}
+	}
+	lines := []string{fmt.Sprintf("Files %d/%d done, %d failed, %d running   %s rows   elapsed %s",
+		finished, d.total, failed, running, formatCount(rows), now.Sub(d.started).Round(time.Second)), ""}
+
+	// Running files first, then finished ones in the order they started
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].state == "running" && files[j].state != "running"
+	})
+	shown := files
+	if len(shown) > dashboardFiles {
+		shown = shown[:dashboardFiles]
+	}
+	width := 0
+	for _, file := range shown {
+		width = max(width, len(file.name))
+	}
+	for _, file := range shown {
+		lines = append(lines, file.line(width, file.state))
+	}
+	if len(files) > len(shown) {
+		lines = append(lines, fmt.Sprintf("  … and %d more", len(files)-len(shown)))
+	}
+
+	lines = append(lines, "", fmt.Sprintf("Throughput %s %s rows/s", sparkline(d.samples), formatCount(int64(rate))))
+
+	if len(byKind) > 0 {
+		kinds := make([]string, 0, len(byKind))
+		for kind := range byKind {
+			kinds = append(kinds, kind)
+		}
+		sort.Slice(kinds, func(i, j int) bool {
+			if byKind[kinds[i]] != byKind[kinds[j]] {
+				return byKind[kinds[i]] > byKind[kinds[j]]
+			}
+			return kinds[i] < kinds[j]
+		})
+		counts := make([]string, len(kinds))
+		for i, kind := range kinds {
+			counts[i] = fmt.Sprintf("%s %s", kind, formatCount(byKind[kind]))
+		}
+		lines = append(lines, "Rejects    "+strings.Join(counts, ", "))
+	}
+
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].at.Before(errs[j].at) })
+		if len(errs) > dashboardErrors {
+			errs = errs[len(errs)-dashboardErrors:]
+		}
+		lines = append(lines, "", "Recent errors")
+		for _, e := range errs {
+			line := "  " + e.at.Format(time.TimeOnly) + " "
+			if e.file != "" {
+				line += e.file + ": "
+			}
+			lines = append(lines, line+strings.ReplaceAll(e.message, "\n", " "))
+		}
+	}
+	return lines
+}
+
+// The file's bar, rows, rejects and throughput
+func (f *dashboardFile) line(width int, state string) string {
+	fraction := 0.0
+	if f.total > 0 {
+		fraction = min(float64(f.offset.Load())/float64(f.total), 1)
+	}
+	filled := int(fraction * dashboardBarWidth)
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", dashboardBarWidth-filled)
+	status := fmt.Sprintf("%3.0f%%", fraction*100)
+	switch state {
+	case "done":
+		status = "done"
+	case "failed":
+		status = "FAIL"
+	}
+	rows := f.stats.rowsRead.Load()
+	return fmt.Sprintf("  %-*s %s %4s %10s rows %8s rejected %8s rows/s",
+		width, f.name, bar, status, formatCount(rows), formatCount(f.stats.rejected.Load()), formatCount(int64(f.stats.rate(rows))))
+}
+
+// The samples as a row of bars scaled to the largest
+func sparkline(samples []float64) string {
+	peak := 0.0
+	for _, sample := range samples {
+		peak = max(peak, sample)
+	}
+	graph := make([]rune, dashboardSamples)
+	for i := range graph {
+		graph[i] = ' '
+	}
+	offset := dashboardSamples - len(samples)
+	for i, sample := range samples {
+		level := 0
+		if peak > 0 {
+			level = int(sample / peak * float64(len(sparkLevels)-1))
+		}
+		graph[offset+i] = sparkLevels[level]
+	}
+	return string(graph)
+}
+
+// n with thousands separators
+func formatCount(n int64) string {
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	digits := fmt.Sprint(n)
+	var b strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	return b.String()
+}
+
+// dashboardLogs lists warnings and errors on the dashboard, passing records
+// on to the logger's own handler only when they don't go to the terminal
+type dashboardLogs struct {
+	slog.Handler
+	dashboard   *dashboard
+	passThrough bool
+}
+
+func (h dashboardLogs) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || h.passThrough && h.Handler.Enabled(ctx, level)
+}
+
+func (h dashboardLogs) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelWarn {
+		h.dashboard.log(record)
+	}
+	if h.passThrough && h.Handler.Enabled(ctx, record.Level) {
+		return h.Handler.Handle(ctx, record)
+	}
+	return nil
+}
+
+func (h dashboardLogs) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return dashboardLogs{Handler: h.Handler.WithAttrs(attrs), dashboard: h.dashboard, passThrough: h.passThrough}
+}
+
+func (h dashboardLogs) WithGroup(name string) slog.Handler {
+	return dashboardLogs{Handler: h.Handler.WithGroup(name), dashboard: h.dashboard, passThrough: h.passThrough}
+}
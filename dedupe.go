@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"hash/maphash"
+	"log/slog"
+	"strings"
+)
+
+// dedupeSet remembers the key column values seen so far in a file, as
+// 64-bit hashes to bound memory, so rows repeating one are skipped. Once
+// maxKeys are held no new ones are added, and later rows are only checked
+// against those.
+type dedupeSet struct {
+	name    string
+	column  int
+	seed    maphash.Seed
+	seen    map[uint64]struct{}
+	maxKeys int
+	full    bool
+}
+
+// Resolve the key as a header name, or else the Place field the mapping
+// maps to a column. Nil when key is empty.
+func newDedupeSet(key string, maxKeys int, header *Header, cols columns) (*dedupeSet, error) {
+	if key == "" {
+		return nil, nil
+	}
+	i, ok := header.Index(key)
+	if !ok {
+		i, ok = cols[key]
+	}
+	if !ok {
+		return nil, fmt.Errorf("DEDUPE_KEY: no column %q", key)
+	}
+	return &dedupeSet{name: key, column: i, seed: maphash.MakeSeed(), seen: map[uint64]struct{}{}, maxKeys: maxKeys}, nil
+}
+
+// Whether the row's key was seen before, remembering it if not. Rows with
+// an empty key are never duplicates.
+func (d *dedupeSet) duplicate(record []string) bool {
+	if d.column >= len(record) {
+		return false
+	}
+	key := strings.TrimSpace(record[d.column])
+	if key == "" {
+		return false
+	}
+
+	hash := maphash.String(d.seed, key)
+	if _, ok := d.seen[hash]; ok {
+		return true
+	}
+	if d.maxKeys > 0 && len(d.seen) >= d.maxKeys {
+		if !d.full {
+			d.full = true
+			slog.Warn("Deduplication key limit reached, only earlier keys are checked from here on", "key", d.name, "maxKeys", d.maxKeys)
+		}
+		return false
+	}
+	d.seen[hash] = struct{}{}
+	return false
+}
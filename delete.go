@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Suffix of the file storing the last row of an ID list the delete
+// subcommand finished with
+const deleteProgressFile = "_delete_progress.txt"
+
+// The delete subcommand: read placeIds from CSV_FILE and delete, or with
+// SOFT_DELETE mark as deleted, the matching documents a batch at a time,
+// checkpointing each batch so an interrupted run resumes where it stopped.
+// A dry run only counts the matches.
+func runDelete(cfg Config) error {
+	stats := newRunStats()
+	mapping, err := loadMapping(cfg.MappingFile)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	clientOpts, _, err := clientOptions(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	client, err := mongo.Connect(ctx, clientOpts)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+	if err := pingServer(ctx, client, cfg.ConnectRetries); err != nil {
+		return err
+	}
+	collection := client.Database(cfg.DBName).Collection(cfg.CollectionName)
+
+	audit, err := openAuditLog(cfg, stats.importID)
+	if err != nil {
+		return err
+	}
+	defer audit.Close()
+	audit.record("delete_started", map[string]any{"db": cfg.DBName, "collection": cfg.CollectionName, "soft": cfg.SoftDelete, "dryRun": cfg.DryRun})
+
+	checkpoints, err := openCheckpointStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer checkpoints.Close()
+
+	rows, deleted, err := deleteListed(ctx, cfg, mapping, checkpoints, stats, func(ids bson.A) (int64, error) {
+		filter := bson.D{{Key: "placeId", Value: bson.D{{Key: "$in", Value: ids}}}}
+		switch {
+		case cfg.DryRun:
+			return collection.CountDocuments(ctx, filter)
+		case cfg.SoftDelete:
+			filter = append(filter, bson.E{Key: "isDeleted", Value: bson.D{{Key: "$ne", Value: true}}})
+			result, err := collection.UpdateMany(ctx, filter, bson.D{{Key: "$set", Value: bson.D{
+				{Key: "isDeleted", Value: true},
+				{Key: "deletedAt", Value: time.Now().UTC()},
+			}}})
+			if result == nil {
+				return 0, err
+			}
+			return result.ModifiedCount, err
+		default:
+			result, err := collection.DeleteMany(ctx, filter)
+			if result == nil {
+				return 0, err
+			}
+			return result.DeletedCount, err
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	action := "deleted"
+	switch {
+	case cfg.DryRun:
+		action = "matched"
+	case cfg.SoftDelete:
+		action = "softDeleted"
+	}
+	slog.Info("delete_complete", "rowsRead", rows, action, deleted, "skipped", stats.skipped.Load())
+	audit.record("delete_finished", map[string]any{"rowsRead": rows, action: deleted})
+	return nil
+}
+
+// Read the ID list in CSV_FILE, passing its placeIds to remove a batch at
+// a time, resuming after the checkpointed row. The checkpoint is cleared
+// once the list is done, so the next run at the same path starts at its
+// first row. Returns the rows read and the documents removed.
+func deleteListed(ctx context.Context, cfg Config, mapping Mapping, checkpoints checkpointStore, stats *runStats, remove func(ids bson.A) (int64, error)) (int64, int64, error) {
+	file, err := openSource(cfg, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	reader := newCSVReader(file, cfg)
+	rawHeader, sample, err := reader.readHeader(cfg.SkipColumns)
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading header: %w", err)
+	}
+	header, err := newHeader(rawHeader, cfg.DuplicateHeaders)
+	if err != nil {
+		return 0, 0, err
+	}
+	column, err := deleteIDColumn(cfg.DeleteIDColumn, header, mapping)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	resume, err := getLastProcessedPlaceID(ctx, checkpoints, cfg.outputs.deleteProgress)
+	if err != nil {
+		return 0, 0, err
+	}
+	if resume.Row > 0 {
+		slog.Info("Resuming delete", "row", resume.Row, "placeId", resume.PlaceID)
+	}
+
+	progressBar := newProgress(cfg, file.size, stats)
+	var (
+		ids       bson.A
+		lastID    string
+		rowNumber int64
+		deleted   int64
+	)
+	flush := func() error {
+		if len(ids) == 0 {
+			return nil
+		}
+		n, err := remove(ids)
+		if err != nil {
+			return fmt.Errorf("deleting placeIds up to row %d: %w", rowNumber, err)
+		}
+		deleted += n
+		stats.inserted.Add(n) // Shown as docs/s on the progress bar
+		slog.Info("batch_deleted", "ids", len(ids), "deleted", n)
+		ids = ids[:0]
+
+		if !cfg.DryRun {
+			return updateLastProcessedPlaceID(ctx, checkpoints, cfg.outputs.deleteProgress, resumePoint{PlaceID: lastID, Row: rowNumber})
+		}
+		return nil
+	}
+
+	for {
+		var record []string
+		var offset int64
+		if len(sample) > 0 {
+			record, offset, err = sample[0].record, sample[0].offset, sample[0].err
+			sample = sample[1:]
+		} else {
+			record, err = reader.Read()
+			offset = reader.InputOffset()
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return rowNumber, deleted, err
+		}
+		progressBar.update(file.sourceOffset(offset))
+		stats.rowsRead.Add(1)
+		rowNumber++
+
+		if rowNumber <= resume.Row {
+			stats.skipped.Add(1)
+			continue
+		}
+		id := ""
+		if column < len(record) {
+			id = strings.TrimSpace(record[column])
+		}
+		if id == "" {
+			stats.skipped.Add(1)
+			continue
+		}
+		ids = append(ids, id)
+		lastID = id
+		if len(ids) >= cfg.BatchSize {
+			if err := flush(); err != nil {
+				return rowNumber, deleted, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return rowNumber, deleted, err
+	}
+	progressBar.finish()
+
+	if !cfg.DryRun {
+		if err := checkpoints.remove(ctx, cfg.outputs.deleteProgress); err != nil {
+			return rowNumber, deleted, fmt.Errorf("clearing the delete checkpoint: %w", err)
+		}
+	}
+	return rowNumber, deleted, nil
+}
+
+// The column IDs are read from: the named one, else a placeId column, the
+// only column of a plain list, or the one the mapping reads placeId from
+func deleteIDColumn(name string, header *Header, mapping Mapping) (int, error) {
+	if name != "" {
+		i, ok := header.Index(name)
+		if !ok {
+			return 0, fmt.Errorf("DELETE_ID_COLUMN: column %q not found in header", name)
+		}
+		return i, nil
+	}
+	if i, ok := header.Index("placeId"); ok {
+		return i, nil
+	}
+	if len(header.Names) == 1 {
+		return 0, nil
+	}
+	cols, err := mapping.resolve(header)
+	if err != nil {
+		return 0, err
+	}
+	return cols["placeId"], nil
+}
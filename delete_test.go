@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDeleteListedResumes(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "ids.csv")
+	if err := os.WriteFile(source, []byte("placeId\np1\np2\np3\np4\np5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		CSVFile:          source,
+		ReadMode:         readModeBufio,
+		InputFormat:      inputFormatAuto,
+		Encoding:         encodingAuto,
+		Delimiter:        ',',
+		Quote:            '"',
+		Quotes:           quotesStrict,
+		DuplicateHeaders: duplicateHeadersRename,
+		BatchSize:        2,
+		Quiet:            true,
+		outputs:          newOutputNames(filepath.Join(dir, "ids")),
+	}
+	ctx := context.Background()
+	checkpoints := fileCheckpoints{}
+
+	// Each run returns the IDs passed on, failing after failAfter batches
+	// if it is set
+	run := func(failAfter int) ([]any, error) {
+		var seen []any
+		batches := 0
+		_, _, err := deleteListed(ctx, cfg, Mapping{}, checkpoints, newRunStats(), func(ids bson.A) (int64, error) {
+			if failAfter > 0 && batches == failAfter {
+				return 0, errors.New("connection lost")
+			}
+			batches++
+			seen = append(seen, ids...)
+			return int64(len(ids)), nil
+		})
+		return seen, err
+	}
+
+	seen, err := run(1)
+	if err == nil {
+		t.Fatal("interrupted run succeeded")
+	}
+	if want := []any{"p1", "p2"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("interrupted run deleted %v, want %v", seen, want)
+	}
+
+	seen, err = run(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{"p3", "p4", "p5"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("resumed run deleted %v, want %v", seen, want)
+	}
+	if _, err := os.Stat(cfg.outputs.deleteProgress); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("checkpoint left after a complete run: %v", err)
+	}
+
+	// A new list at the same path starts at its first row
+	if err := os.WriteFile(source, []byte("placeId\nq1\nq2\nq3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seen, err = run(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{"q1", "q2", "q3"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("second complete run deleted %v, want %v", seen, want)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// How quotes are parsed
+const (
+	// Reject any malformed quoting
+	quotesStrict = "strict"
+
+	// Allow quotes inside unquoted fields and unescaped quotes in quoted ones
+	quotesLazy = "lazy"
+
+	// Lazy, with stray quotes escaped so their rows parse as meant (see
+	// quoteRepairer), and rows that still don't parse sent to the rejects
+	// file instead of ending the run
+	quotesRepair = "repair"
+)
+
+// How rows with the wrong number of fields are handled
+const (
+	// Fail the run, or reject the row in repair mode
+	fieldCountStrict = "strict"
+
+	// Pad short rows with empty fields and drop extra fields from long ones
+	fieldCountPad = "pad"
+)
+
+// Names accepted for delimiters that are awkward to pass on a command line
+var delimiterNames = map[string]string{
+	"tab":       "\t",
+	`\t`:        "\t",
+	"pipe":      "|",
+	"semicolon": ";",
+	"comma":     ",",
+}
+
+// Parse a delimiter or quote option into a single character
+func parseDialectChar(name, value string) (rune, error) {
+	if named, ok := delimiterNames[strings.ToLower(value)]; ok {
+		value = named
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if size == 0 || size != len(value) || r == utf8.RuneError || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("%s must be a single character, got %q", name, value)
+	}
+	return r, nil
+}
+
+// csvReader reads records with a configurable delimiter and quote. The csv
+// package only quotes with '"', so another quote character is swapped with
+// '"' on the way in and swapped back in each field.
+type csvReader struct {
+	*csv.Reader
+	quote  byte
+	repair bool
+
+	// Set in repair mode, for the offsets of rows in the file
+	repairer *quoteRepairer
+
+	// Set when rows are read straight from a memory-mapped file
+	mapped *mappedRows
+
+	// Fields every row is padded or truncated to, when set
+	fields int
+
+	// Spreadsheet columns dropped from every row
+	skip columnSkip
+
+	// Input read, when it may be an archive whose members are read one
+	// after another, each starting with the header read first
+	source *input
+	header []string
+
+	// Set when reading NDJSON, a spreadsheet or Parquet instead
+	rows rowSource
+}
+
+// rowSource reads rows from a format other than CSV
+type rowSource interface {
+	Read() ([]string, error)
+	InputOffset() int64
+}
+
+// tableSource is a rowSource read from a file it holds open
+type tableSource interface {
+	rowSource
+	io.Closer
+}
+
+// Make a CSV reader for the configured delimiter and quote
+func newCSVReader(r io.Reader, cfg Config) *csvReader {
+	if source, ok := r.(*input); ok && source.format == inputFormatNDJSON {
+		return &csvReader{Reader: csv.NewReader(source), rows: newNDJSONReader(source), repair: cfg.Quotes == quotesRepair, source: source}
+	}
+	if source, ok := r.(*input); ok && source.table != nil {
+		return &csvReader{Reader: csv.NewReader(source), rows: source.table, source: source}
+	}
+
+	source, _ := r.(*input)
+	quote := byte('"')
+	if cfg.Quote != '"' {
+		quote = byte(cfg.Quote)
+		r = &quoteSwapper{r: r, quote: quote}
+	}
+	var repairer *quoteRepairer
+	if cfg.Quotes == quotesRepair {
+		repairer = newQuoteRepairer(r, cfg.Delimiter)
+		r = repairer
+	}
+	reader := csv.NewReader(r)
+	reader.Comma = cfg.Delimiter
+	reader.LazyQuotes = cfg.Quotes != quotesStrict
+	if cfg.FieldCount == fieldCountPad {
+		reader.FieldsPerRecord = -1
+	}
+	var mapped *mappedRows
+	if source != nil && source.mapped != nil && !source.transformed() && source.archive == nil && repairer == nil {
+		// Repair mode rewrites the text as it goes, so it keeps to streaming
+		source.readMapped = true
+		mapped = newMappedRows(source.mapped, int(source.skipped), cfg, reader.FieldsPerRecord)
+	}
+	return &csvReader{Reader: reader, quote: quote, repair: cfg.Quotes == quotesRepair, repairer: repairer, mapped: mapped, source: source}
+}
+
+// Pad or truncate rows to n fields, when variable field counts are allowed
+func (r *csvReader) padTo(n int) {
+	if r.FieldsPerRecord < 0 {
+		r.fields = n
+	}
+}
+
+// Whether reading can carry on past the error, skipping the malformed row
+func (r *csvReader) tolerates(err error) bool {
+	var parseErr *csv.ParseError
+	return r.repair && errors.As(err, &parseErr)
+}
+
+func (r *csvReader) Read() ([]string, error) {
+	record, err := r.read()
+	for errors.Is(err, io.EOF) && r.source != nil && r.source.archive != nil && r.header != nil {
+		if err = r.source.nextMember(); err != nil {
+			return nil, err
+		}
+		if r.rows != nil {
+			record, err = r.read() // Members have no header line
+			continue
+		}
+		var header []string
+		if header, err = r.read(); errors.Is(err, io.EOF) {
+			continue // Empty member
+		}
+		if err != nil {
+			return nil, fmt.Errorf("archive member %s: %w", r.source.member, err)
+		}
+		if !slices.Equal(header, r.header) {
+			return nil, fmt.Errorf("archive member %s: header differs from the first member's", r.source.member)
+		}
+		record, err = r.read()
+	}
+	if err == nil && r.fields > 0 && len(record) != r.fields {
+		line := r.line()
+		slog.Warn("Row field count adjusted", "line", line, "fields", len(record), "expected", r.fields)
+		if len(record) > r.fields {
+			record = record[:r.fields]
+		} else {
+			record = append(record, make([]string, r.fields-len(record))...)
+		}
+	}
+	return r.skip.apply(record), err
+}
+
+// Line the last row read started on
+func (r *csvReader) line() int {
+	if r.mapped != nil {
+		return r.mapped.recordLine
+	}
+	line, _ := r.FieldPos(0)
+	return line
+}
+
+// Read a record as it is in the file
+func (r *csvReader) read() ([]string, error) {
+	if r.rows != nil {
+		return r.rows.Read()
+	}
+	if r.mapped != nil {
+		return r.mapped.Read()
+	}
+	record, err := r.Reader.Read()
+	if r.quote != '"' {
+		for i, field := range record {
+			record[i] = swapQuote(field, r.quote)
+		}
+	}
+	return record, err
+}
+
+// Byte offset just past the last row read
+func (r *csvReader) InputOffset() int64 {
+	if r.rows != nil {
+		return r.rows.InputOffset()
+	}
+	if r.repairer != nil {
+		return r.repairer.inputOffset(r.Reader.InputOffset())
+	}
+	if r.mapped != nil {
+		return r.mapped.InputOffset()
+	}
+	return r.Reader.InputOffset()
+}
+
+// A reader carrying on with the same rows from another stream of the
+// source, such as one resumed part way through
+func (r *csvReader) continueFrom(src io.Reader, cfg Config) *csvReader {
+	next := newCSVReader(src, cfg)
+	if json, ok := r.rows.(*ndjsonReader); ok {
+		rows := newNDJSONReader(src)
+		rows.keys, rows.index = json.keys, json.index
+		next = &csvReader{Reader: csv.NewReader(src), rows: rows, repair: r.repair}
+	}
+	next.fields, next.skip, next.header = r.fields, r.skip, r.header
+	return next
+}
+
+// quoteSwapper exchanges a quote character and '"' in a stream
+type quoteSwapper struct {
+	r     io.Reader
+	quote byte
+}
+
+func (s *quoteSwapper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	for i := range p[:n] {
+		switch p[i] {
+		case s.quote:
+			p[i] = '"'
+		case '"':
+			p[i] = s.quote
+		}
+	}
+	return n, err
+}
+
+func swapQuote(field string, quote byte) string {
+	if strings.IndexByte(field, quote) < 0 && strings.IndexByte(field, '"') < 0 {
+		return field
+	}
+	b := []byte(field)
+	for i := range b {
+		switch b[i] {
+		case quote:
+			b[i] = '"'
+		case '"':
+			b[i] = quote
+		}
+	}
+	return string(b)
+}
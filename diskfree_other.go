@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// Free disk space isn't checked on this platform
+func diskFree(dir string) (uint64, error) {
+	return 0, errors.New("not supported on this platform")
+}
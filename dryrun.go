@@ -0,0 +1,23 @@
+package main
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Print documents as relaxed Extended JSON until limit have been printed
+func printDryRunDocuments(batch []any, printed *int, limit int) error {
+	for _, doc := range batch {
+		if *printed >= limit {
+			return nil
+		}
+		data, err := bson.MarshalExtJSONWithRegistry(bsonRegistry, doc, false, false)
+		if err != nil {
+			return err
+		}
+		if err := writeStdout(append(data, '\n')); err != nil {
+			return err
+		}
+		*printed++
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// duplicateKey identifies a place by its normalized address and coordinates
+type duplicateKey struct {
+	address     string
+	coordinates [2]float64
+}
+
+func placeDuplicateKey(place *Place) (duplicateKey, bool) {
+	if place.Location == nil || place.Address == "" {
+		return duplicateKey{}, false
+	}
+	return duplicateKey{address: normalizeAddressKey(place.Address), coordinates: place.Location.Coordinates}, true
+}
+
+// Lowercase the address and reduce punctuation and whitespace runs to
+// single spaces, so trivially different spellings compare equal
+func normalizeAddressKey(address string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(address), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// Mark places in the batch that duplicate a different place, either already
+// in the collection or earlier in the batch, as merged into that survivor.
+// Returns the number of places marked.
+func markMergedDuplicates(ctx context.Context, collection *mongo.Collection, batch []*Place) (int, error) {
+	var coordinates bson.A
+	var placeIDs bson.A
+	for _, place := range batch {
+		if place.Location != nil {
+			coordinates = append(coordinates, bson.A{place.Location.Coordinates[0], place.Location.Coordinates[1]})
+		}
+		placeIDs = append(placeIDs, place.PlaceID)
+	}
+	if len(coordinates) == 0 {
+		return 0, nil
+	}
+
+	// Survivors already stored at the same coordinates
+	cursor, err := collection.Find(ctx,
+		bson.D{
+			{Key: "location.coordinates", Value: bson.D{{Key: "$in", Value: coordinates}}},
+			{Key: "placeId", Value: bson.D{{Key: "$nin", Value: placeIDs}}},
+			{Key: "isMerged", Value: bson.D{{Key: "$ne", Value: true}}},
+		},
+		options.Find().SetProjection(bson.D{{Key: "_id", Value: 0}, {Key: "placeId", Value: 1}, {Key: "address", Value: 1}, {Key: "location", Value: 1}}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var existing []Place
+	if err := cursor.All(ctx, &existing); err != nil {
+		return 0, err
+	}
+
+	survivors := map[duplicateKey]string{}
+	for i := range existing {
+		if key, ok := placeDuplicateKey(&existing[i]); ok {
+			survivors[key] = existing[i].PlaceID
+		}
+	}
+
+	merged := 0
+	now := time.Now()
+	for i := range batch {
+		key, ok := placeDuplicateKey(batch[i])
+		if !ok {
+			continue
+		}
+		survivor, found := survivors[key]
+		if !found {
+			survivors[key] = batch[i].PlaceID
+			continue
+		}
+		if survivor == batch[i].PlaceID {
+			continue
+		}
+
+		batch[i].IsMerged = true
+		batch[i].MergedAt = &now
+		batch[i].MergedInto = survivor
+		merged++
+	}
+	return merged, nil
+}
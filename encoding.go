@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Input encodings
+const (
+	encodingAuto        = "auto"
+	encodingUTF8        = "utf-8"
+	encodingUTF16LE     = "utf-16le"
+	encodingUTF16BE     = "utf-16be"
+	encodingLatin1      = "latin1"
+	encodingWindows1252 = "windows-1252"
+)
+
+var encodings = map[string]encoding.Encoding{
+	encodingUTF8:        unicode.UTF8BOM, // Strips a BOM if there is one
+	encodingUTF16LE:     unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	encodingUTF16BE:     unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+	encodingLatin1:      charmap.ISO8859_1,
+	encodingWindows1252: charmap.Windows1252,
+}
+
+// Bytes looked at to detect the encoding
+const encodingSniffSize = 64 << 10
+
+// Decode the input to UTF-8. In auto mode a BOM picks UTF-8 or UTF-16,
+// valid UTF-8 is read as is, and anything else is taken to be
+// Windows-1252, the usual legacy Excel export encoding. Each member of an
+// archive is decoded, and detected, separately.
+func (in *input) decode(name string) error {
+	if in.table != nil {
+		return nil // Workbooks are always Unicode
+	}
+	in.requestedEncoding = name
+	buffered := bufio.NewReaderSize(in.Reader, encodingSniffSize)
+	in.Reader = buffered
+
+	if name == encodingAuto {
+		head, err := buffered.Peek(encodingSniffSize)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return err
+		}
+		name = detectEncoding(head)
+	}
+
+	enc, ok := encodings[name]
+	if !ok {
+		return fmt.Errorf("unknown encoding %q", name)
+	}
+	in.encoding = name
+
+	if name == encodingUTF8 {
+		// Only the BOM needs removing, offsets stay those of the source
+		if head, _ := buffered.Peek(3); bytes.Equal(head, []byte("\xef\xbb\xbf")) {
+			buffered.Discard(3)
+			in.skipped = 3
+		}
+		return nil
+	}
+
+	source := io.Reader(buffered)
+	if in.counter == nil {
+		in.counter = &countingReader{r: buffered}
+		source = in.counter
+	}
+	in.Reader = transform.NewReader(source, enc.NewDecoder())
+	return nil
+}
+
+// Guess the encoding of the start of a file
+func detectEncoding(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\xef\xbb\xbf")):
+		return encodingUTF8
+	case bytes.HasPrefix(head, []byte("\xff\xfe")):
+		return encodingUTF16LE
+	case bytes.HasPrefix(head, []byte("\xfe\xff")):
+		return encodingUTF16BE
+	}
+
+	// The sample may end part way through a character
+	for i := len(head) - 1; i >= 0 && i >= len(head)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(head[i]) {
+			if !utf8.FullRune(head[i:]) {
+				head = head[:i]
+			}
+			break
+		}
+	}
+	if utf8.Valid(head) {
+		return encodingUTF8
+	}
+	return encodingWindows1252
+}
+
+// Whether the input is decompressed, transcoded or a spreadsheet, so
+// reader offsets aren't source offsets
+func (in *input) transformed() bool {
+	return in.counter != nil || in.table != nil
+}
+
+// Position in the source of a reader offset. Decompressed or transcoded
+// input only knows how much of the source has been consumed, which runs
+// ahead of the reader.
+func (in *input) sourceOffset(offset int64) int64 {
+	if in.counter != nil {
+		return in.counter.n
+	}
+	return in.skipped + offset
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of errors a run can stop with, for callers to branch on with
+// errors.Is. Returned errors wrap them with the row or batch involved.
+var (
+	// The checkpoint's PlaceID never appeared in the CSV, so nothing was
+	// processed
+	ErrResumePointNotFound = errors.New("resume point not found")
+
+	// A batch failed to write for a reason other than individual
+	// documents being rejected
+	ErrBatchInsert = errors.New("batch insert failed")
+
+	// The progress file couldn't be read or written
+	ErrCheckpoint = errors.New("checkpoint failed")
+)
+
+// batchError wraps an error writing data rows first to last
+func batchError(first, last int64, err error) error {
+	return fmt.Errorf("%w: rows %d-%d: %w", ErrBatchInsert, first, last, err)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Garbage filter modes
+const (
+	garbageFilterOff    = "off"
+	garbageFilterFlag   = "flag"
+	garbageFilterReject = "reject"
+)
+
+// Reasons a value is considered garbage
+const (
+	garbageWordlist = "wordlist"
+	garbagePattern  = "pattern"
+	garbageControl  = "control_characters"
+	garbageTooLong  = "too_long"
+)
+
+// garbageFilter spots test junk and profanity in free-text fields
+type garbageFilter struct {
+	words             map[string]bool
+	patterns          []*regexp.Regexp
+	maxLength         int
+	maxControlPercent int
+}
+
+// Build the filter from the config, nil when it is off
+func newGarbageFilter(cfg Config) (*garbageFilter, error) {
+	if cfg.GarbageFilter == garbageFilterOff {
+		return nil, nil
+	}
+
+	f := &garbageFilter{
+		words:             map[string]bool{},
+		maxLength:         cfg.GarbageMaxLength,
+		maxControlPercent: cfg.GarbageMaxControlPercent,
+	}
+
+	if cfg.GarbageWordlist != "" {
+		words, err := readListFile(cfg.GarbageWordlist)
+		if err != nil {
+			return nil, fmt.Errorf("reading garbage wordlist: %w", err)
+		}
+		for _, word := range words {
+			f.words[strings.ToLower(word)] = true
+		}
+	}
+
+	if cfg.GarbagePatterns != "" {
+		patterns, err := readListFile(cfg.GarbagePatterns)
+		if err != nil {
+			return nil, fmt.Errorf("reading garbage patterns: %w", err)
+		}
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("garbage pattern %q: %w", pattern, err)
+			}
+			f.patterns = append(f.patterns, re)
+		}
+	}
+
+	return f, nil
+}
+
+// Read the non-empty, non-comment lines of a file
+func readListFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// Reason the value is garbage, or "" when it looks fine
+func (f *garbageFilter) check(value string) string {
+	if f.maxLength > 0 && len([]rune(value)) > f.maxLength {
+		return garbageTooLong
+	}
+
+	if f.maxControlPercent > 0 && value != "" {
+		control, total := 0, 0
+		for _, r := range value {
+			total++
+			if unicode.IsControl(r) || r == unicode.ReplacementChar {
+				control++
+			}
+		}
+		if control*100 > total*f.maxControlPercent {
+			return garbageControl
+		}
+	}
+
+	if len(f.words) > 0 {
+		words := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		for _, word := range words {
+			if f.words[word] {
+				return garbageWordlist
+			}
+		}
+	}
+
+	for _, re := range f.patterns {
+		if re.MatchString(value) {
+			return garbagePattern
+		}
+	}
+
+	return ""
+}
+
+// Check the free-text fields of a place, returning "field:reason" for each
+// one that looks like garbage
+func (f *garbageFilter) checkPlace(place *Place) []string {
+	var flags []string
+	fields := []struct{ name, value string }{
+		{"address", place.Address},
+		{"localArea", place.LocalArea},
+	}
+	for _, field := range fields {
+		if reason := f.check(field.value); reason != "" {
+			flags = append(flags, field.name+":"+reason)
+		}
+	}
+	return flags
+}
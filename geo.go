@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GeoField builds a GeoJSON point field from a latitude/longitude column pair
+type GeoField struct {
+	Field     string `json:"field"`
+	Latitude  string `json:"latitude"`
+	Longitude string `json:"longitude"`
+
+	// What to do when the coordinates are missing or out of range: keep
+	// them as parsed (unparseable values become 0), omit the field, or
+	// reject the row
+	OnInvalid string `json:"onInvalid"`
+
+	// Create a 2dsphere index on the field before seeding
+	Index bool `json:"index"`
+
+	// How the point is written: a GeoJSON Point, a legacy [lon, lat] pair,
+	// separate latitude and longitude fields, or not at all
+	Format string `json:"format"`
+}
+
+// Geo field output formats
+const (
+	geoFormatGeoJSON = "geojson"
+	geoFormatPair    = "pair"
+	geoFormatFields  = "fields"
+	geoFormatNone    = "none"
+)
+
+// Invalid coordinate handling
+const (
+	geoInvalidKeep   = "keep"
+	geoInvalidOmit   = "omit"
+	geoInvalidReject = "reject"
+)
+
+// Place fields that can't be used as extra geo field names
+var placeFields = map[string]bool{
+	"placeId": true, "address": true, "version": true, "isAutoCompleteAddress": true,
+	"types": true, "plusCode": true, "city": true, "division": true, "district": true,
+	"postalCode": true, "sublocality": true, "localArea": true, "location": true,
+	"suggestions": true, "reviews": true, "mergedAt": true, "isMerged": true,
+}
+
+// Handling of coordinates that look swapped
+const (
+	geoSwapOff    = "off"
+	geoSwapFix    = "fix"
+	geoSwapFlag   = "flag"
+	geoSwapReject = "reject"
+)
+
+// geoColumn is a GeoField resolved to record positions
+type geoColumn struct {
+	GeoField
+	latitude  int
+	longitude int
+
+	// How coordinates that look swapped are handled, and the bounding box
+	// that helps tell, if any
+	swap string
+	bbox boundingBox
+}
+
+// Resolve the geo fields against the header. Without any configured, the
+// "location" field is built from the latitude and longitude columns, if
+// both are there.
+// Fields that don't set their own onInvalid or format take the defaults'.
+func (m Mapping) resolveGeo(header *Header, cols columns, defaults GeoField) ([]geoColumn, error) {
+	if len(m.Geo) == 0 {
+		latitude, hasLatitude := cols["latitude"]
+		longitude, hasLongitude := cols["longitude"]
+		if !hasLatitude || !hasLongitude {
+			// An update from a file without coordinates leaves location alone
+			return nil, nil
+		}
+		return []geoColumn{{
+			GeoField:  GeoField{Field: "location", OnInvalid: defaults.OnInvalid, Format: defaults.Format},
+			latitude:  latitude,
+			longitude: longitude,
+		}}, nil
+	}
+
+	seen := map[string]bool{}
+	geo := make([]geoColumn, 0, len(m.Geo))
+	for _, field := range m.Geo {
+		if field.Field == "" {
+			return nil, fmt.Errorf("geo field without a name")
+		}
+		if seen[field.Field] || (field.Field != "location" && placeFields[field.Field]) {
+			return nil, fmt.Errorf("geo field %q clashes with another field", field.Field)
+		}
+		seen[field.Field] = true
+
+		switch field.OnInvalid {
+		case "":
+			field.OnInvalid = defaults.OnInvalid
+		case geoInvalidKeep, geoInvalidOmit, geoInvalidReject:
+		default:
+			return nil, fmt.Errorf("geo field %q: onInvalid must be %q, %q or %q", field.Field, geoInvalidKeep, geoInvalidOmit, geoInvalidReject)
+		}
+
+		switch field.Format {
+		case "":
+			field.Format = defaults.Format
+		case geoFormatGeoJSON, geoFormatPair, geoFormatFields, geoFormatNone:
+		default:
+			return nil, fmt.Errorf("geo field %q: format must be %q, %q, %q or %q", field.Field, geoFormatGeoJSON, geoFormatPair, geoFormatFields, geoFormatNone)
+		}
+		if field.Index && (field.Format == geoFormatFields || field.Format == geoFormatNone) {
+			return nil, fmt.Errorf("geo field %q: a 2dsphere index needs the geojson or pair format", field.Field)
+		}
+
+		latitude, ok := header.Index(field.Latitude)
+		if !ok {
+			return nil, fmt.Errorf("geo field %q: column %q not found in header", field.Field, field.Latitude)
+		}
+		longitude, ok := header.Index(field.Longitude)
+		if !ok {
+			return nil, fmt.Errorf("geo field %q: column %q not found in header", field.Field, field.Longitude)
+		}
+
+		geo = append(geo, geoColumn{GeoField: field, latitude: latitude, longitude: longitude})
+	}
+	return geo, nil
+}
+
+// Build the point for a record, and whether its coordinates looked swapped.
+// A nil Location means the field is omitted, an error means the row is
+// rejected.
+func (g geoColumn) point(record []string) (*Location, bool, error) {
+	latitude, longitude := g.latitude, g.longitude
+	swapped := g.swap != geoSwapOff && g.looksSwapped(record)
+	if swapped {
+		switch g.swap {
+		case geoSwapReject:
+			return nil, true, &rowError{Kind: "swapped_coordinates", Err: fmt.Errorf("%s: latitude and longitude look swapped", g.Field)}
+		case geoSwapFix:
+			latitude, longitude = longitude, latitude
+		}
+	}
+
+	lat, latErr := parseCoordinate(record, latitude, 90)
+	lon, lonErr := parseCoordinate(record, longitude, 180)
+	invalid := latErr
+	if invalid == nil {
+		invalid = lonErr
+	}
+
+	if g.OnInvalid != geoInvalidKeep {
+		if invalid != nil {
+			if g.OnInvalid == geoInvalidOmit {
+				return nil, swapped, nil
+			}
+			return nil, swapped, &rowError{Kind: "invalid_coordinates", Err: fmt.Errorf("%s: %w", g.Field, invalid)}
+		}
+	}
+
+	return &Location{
+		Type:        "Point",
+		Coordinates: [2]float64{lon, lat},
+		format:      g.Format,
+		invalid:     invalid != nil,
+	}, swapped, nil
+}
+
+// Whether the latitude and longitude columns look swapped: the latitude is
+// out of range while the longitude would be a valid latitude, or with a
+// bounding box, only the swapped point is inside it
+func (g geoColumn) looksSwapped(record []string) bool {
+	lat, latErr := parseCoordinate(record, g.latitude, 180)
+	lon, lonErr := parseCoordinate(record, g.longitude, 90)
+	if latErr != nil || lonErr != nil {
+		return false
+	}
+	if math.Abs(lat) > 90 {
+		return true
+	}
+	return g.bbox.set() && !g.bbox.contains(lon, lat) && g.bbox.contains(lat, lon)
+}
+
+// Marshal the point as a GeoJSON Point, or a [lon, lat] pair
+func (l Location) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	if l.format == geoFormatPair {
+		return bson.MarshalValueWithRegistry(bsonRegistry, bson.A{l.Coordinates[0], l.Coordinates[1]})
+	}
+	type location Location // Without the MarshalBSONValue method
+	return bson.MarshalValueWithRegistry(bsonRegistry, location(l))
+}
+
+// Names of the latitude and longitude fields a geo field is written as in
+// the fields format: latitude and longitude for location, else prefixed
+// with the field's name
+func geoFieldNames(field string) (string, string) {
+	if field == "location" {
+		return "latitude", "longitude"
+	}
+	return field + "Latitude", field + "Longitude"
+}
+
+// Set the geo fields of a place from a record, returning those omitted for
+// invalid coordinates
+func setGeoFields(place *Place, geo []geoColumn, record []string) ([]string, error) {
+	var omitted []string
+	for _, g := range geo {
+		point, swapped, err := g.point(record)
+		if err != nil {
+			return nil, err
+		}
+		if swapped {
+			place.SwappedCoordinates = append(place.SwappedCoordinates, g.Field)
+		}
+		// Points not written are still set, for the checks that use them
+		if g.Format == geoFormatNone || (point == nil && g.Format == geoFormatFields) {
+			place.omitFields = append(place.omitFields, g.Field)
+		}
+		if point == nil {
+			omitted = append(omitted, g.Field)
+			continue
+		}
+
+		if g.Field == "location" {
+			place.Location = point
+			continue
+		}
+		if place.Extra == nil {
+			place.Extra = map[string]any{}
+		}
+		place.Extra[g.Field] = point
+	}
+	return omitted, nil
+}
+
+// Parse a coordinate, checking it lies within ±limit
+func parseCoordinate(record []string, i int, limit float64) (float64, error) {
+	if i >= len(record) || strings.TrimSpace(record[i]) == "" {
+		return 0, fmt.Errorf("missing coordinate")
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(record[i]), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid coordinate %q", record[i])
+	}
+	if value < -limit || value > limit {
+		return value, fmt.Errorf("coordinate %v out of range", value)
+	}
+	return value, nil
+}
+
+// Create 2dsphere indexes for the geo fields that ask for one
+func createGeoIndexes(ctx context.Context, collection *mongo.Collection, geo []geoColumn) error {
+	for _, g := range geo {
+		if !g.Index {
+			continue
+		}
+		index := mongo.IndexModel{Keys: bson.D{{Key: g.Field, Value: "2dsphere"}}}
+		if _, err := collection.Indexes().CreateOne(ctx, index); err != nil {
+			return fmt.Errorf("creating 2dsphere index on %s: %w", g.Field, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// seederService is the seeder.v1.Seeder service in seeder.proto, its
+// messages generated into seeder.pb.go
+type seederService interface {
+	StartImport(grpc.ClientStreamingServer[StartImportRequest, Import]) error
+	GetProgress(context.Context, *GetProgressRequest) (*Import, error)
+	Cancel(context.Context, *CancelRequest) (*Import, error)
+	ListRuns(context.Context, *ListRunsRequest) (*ListRunsResponse, error)
+}
+
+var seederServiceDesc = grpc.ServiceDesc{
+	ServiceName: "seeder.v1.Seeder",
+	HandlerType: (*seederService)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetProgress", Handler: unaryHandler("GetProgress", seederService.GetProgress)},
+		{MethodName: "Cancel", Handler: unaryHandler("Cancel", seederService.Cancel)},
+		{MethodName: "ListRuns", Handler: unaryHandler("ListRuns", seederService.ListRuns)},
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName: "StartImport",
+		Handler: func(srv any, stream grpc.ServerStream) error {
+			return srv.(seederService).StartImport(&grpc.GenericServerStream[StartImportRequest, Import]{ServerStream: stream})
+		},
+		ClientStreams: true,
+	}},
+	Metadata: "seeder.proto",
+}
+
+// A method handler decoding the request into a new Req and calling method
+// through the server's interceptor
+func unaryHandler[Req any, PReq interface{ *Req }, Resp any](name string, method func(seederService, context.Context, PReq) (Resp, error)) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		req := PReq(new(Req))
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		call := func(ctx context.Context, req any) (any, error) {
+			return method(srv.(seederService), ctx, req.(PReq))
+		}
+		if interceptor == nil {
+			return call(ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/seeder.v1.Seeder/" + name}
+		return interceptor(ctx, req, info, call)
+	}
+}
+
+// grpcImports serves the importServer's imports over gRPC
+type grpcImports struct {
+	s *importServer
+}
+
+// Serve seeder.v1.Seeder on GRPC_ADDR until the listener fails
+func (s *importServer) serveGRPC() error {
+	listener, err := net.Listen("tcp", s.cfg.GRPCAddr)
+	if err != nil {
+		return fmt.Errorf("gRPC: %w", err)
+	}
+	slog.Info("Serving imports over gRPC", "addr", s.cfg.GRPCAddr)
+	if err := s.newGRPCServer().Serve(listener); err != nil {
+		return fmt.Errorf("gRPC: %w", err)
+	}
+	return nil
+}
+
+// A gRPC server with seeder.v1.Seeder registered behind SERVE_TOKEN
+func (s *importServer) newGRPCServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := s.authorizedGRPC(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authorizedGRPC(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	server.RegisterService(&seederServiceDesc, grpcImports{s})
+	return server
+}
+
+// Require SERVE_TOKEN as a bearer token in the authorization metadata, if set
+func (s *importServer) authorizedGRPC(ctx context.Context) error {
+	if s.cfg.ServeToken != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		got := strings.Join(md.Get("authorization"), "")
+		if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+s.cfg.ServeToken)) != 1 {
+			return status.Error(codes.Unauthenticated, "missing or wrong bearer token")
+		}
+	}
+	return nil
+}
+
+// StartImport saves the CSV streamed up, no more than SERVE_MAX_UPLOAD
+// bytes of it, and queues it like POST /imports
+func (g grpcImports) StartImport(stream grpc.ClientStreamingServer[StartImportRequest, Import]) error {
+	req, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "no options sent")
+	} else if err != nil {
+		return err
+	}
+	options := req.GetOptions()
+
+	job, err := g.s.newJob()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	job.Database = options.GetDatabase()
+	job.Collection = options.GetCollection()
+	job.DryRun = job.DryRun || options.GetDryRun() // Never off when DRY_RUN is set
+	if err := g.saveUpload(job.setFile(options.GetFile()), stream, req); err != nil {
+		os.RemoveAll(job.dir)
+		return err
+	}
+
+	if err := g.s.submit(job); errors.Is(err, errQueueFull) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	} else if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	view, err := g.s.get(job.ID)
+	if err != nil {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return stream.SendAndClose(importMessage(view))
+}
+
+// Write the chunks of the stream to path, starting with the first message's
+func (g grpcImports) saveUpload(path string, stream grpc.ClientStreamingServer[StartImportRequest, Import], req *StartImportRequest) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer f.Close()
+	var size int64
+	for {
+		size += int64(len(req.GetChunk()))
+		if size > g.s.cfg.ServeMaxUpload {
+			return status.Errorf(codes.ResourceExhausted, "CSV larger than %d bytes", g.s.cfg.ServeMaxUpload)
+		}
+		if _, err := f.Write(req.GetChunk()); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if req, err = stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if req.GetOptions() != nil {
+			return status.Error(codes.InvalidArgument, "options must only be sent in the first message")
+		}
+	}
+	if err := f.Close(); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// GetProgress reports the import like GET /imports/{id}
+func (g grpcImports) GetProgress(ctx context.Context, req *GetProgressRequest) (*Import, error) {
+	job, err := g.s.get(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return importMessage(job), nil
+}
+
+// Cancel cancels the import like DELETE /imports/{id}
+func (g grpcImports) Cancel(ctx context.Context, req *CancelRequest) (*Import, error) {
+	job, err := g.s.cancelJob(req.GetId())
+	switch {
+	case errors.Is(err, errNoSuchImport):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return importMessage(job), nil
+}
+
+// ListRuns lists every import like GET /imports
+func (g grpcImports) ListRuns(ctx context.Context, _ *ListRunsRequest) (*ListRunsResponse, error) {
+	var resp ListRunsResponse
+	for _, job := range g.s.list() {
+		resp.Imports = append(resp.Imports, importMessage(job))
+	}
+	return &resp, nil
+}
+
+func importMessage(job importJob) *Import {
+	msg := &Import{
+		Id:         job.ID,
+		Status:     job.Status,
+		Error:      job.Error,
+		File:       job.File,
+		Database:   job.Database,
+		Collection: job.Collection,
+		DryRun:     job.DryRun,
+		QueuedAt:   timestamppb.New(job.QueuedAt),
+		StartedAt:  timestampOrNil(job.StartedAt),
+		FinishedAt: timestampOrNil(job.FinishedAt),
+	}
+	for _, summary := range job.Summaries {
+		msg.Summaries = append(msg.Summaries, &RunSummary{
+			ImportId:        summary.ImportID,
+			Status:          summary.Status,
+			DryRun:          summary.DryRun,
+			Error:           summary.Error,
+			CsvFile:         summary.CSVFile,
+			Target:          summary.Target,
+			StartedAt:       timestamppb.New(summary.StartedAt),
+			FinishedAt:      timestamppb.New(summary.FinishedAt),
+			DurationSeconds: summary.DurationSeconds,
+			Counts: &RunCounts{
+				RowsRead:           summary.RowsRead,
+				Inserted:           summary.Inserted,
+				Rejected:           summary.Rejected,
+				Skipped:            summary.Skipped,
+				Filtered:           summary.Filtered,
+				Duplicates:         summary.Duplicates,
+				NearDuplicates:     summary.NearDuplicates,
+				Existing:           summary.Existing,
+				Unchanged:          summary.Unchanged,
+				Unmatched:          summary.Unmatched,
+				Merged:             summary.Merged,
+				Flagged:            summary.Flagged,
+				BoundaryFilled:     summary.BoundaryFilled,
+				BoundaryMismatched: summary.BoundaryMismatched,
+				PlusCodesDerived:   summary.PlusCodesDerived,
+				RowsPerSecond:      summary.RowsPerSecond,
+				DocsPerSecond:      summary.DocsPerSecond,
+				ErrorsByType:       summary.ErrorsByType,
+			},
+			FirstRow:    summary.FirstRow,
+			LastRow:     summary.LastRow,
+			Checkpoint:  summary.Checkpoint,
+			RejectsFile: summary.RejectsFile,
+		})
+	}
+	for _, progress := range job.Progress {
+		msg.Progress = append(msg.Progress, &RunProgress{
+			File:   progress.File,
+			Target: progress.Target,
+			Counts: &RunCounts{
+				RowsRead:           progress.RowsRead,
+				Inserted:           progress.Inserted,
+				Rejected:           progress.Rejected,
+				Skipped:            progress.Skipped,
+				Filtered:           progress.Filtered,
+				Duplicates:         progress.Duplicates,
+				NearDuplicates:     progress.NearDuplicates,
+				Existing:           progress.Existing,
+				Unchanged:          progress.Unchanged,
+				Unmatched:          progress.Unmatched,
+				Merged:             progress.Merged,
+				Flagged:            progress.Flagged,
+				BoundaryFilled:     progress.BoundaryFilled,
+				BoundaryMismatched: progress.BoundaryMismatched,
+				PlusCodesDerived:   progress.PlusCodesDerived,
+				RowsPerSecond:      progress.RowsPerSecond,
+				DocsPerSecond:      progress.DocsPerSecond,
+				ErrorsByType:       progress.ErrorsByType,
+			},
+			ElapsedSeconds: progress.ElapsedSeconds,
+			Checkpoint:     progress.Checkpoint,
+		})
+	}
+	return msg
+}
+
+func timestampOrNil(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
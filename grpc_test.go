@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// A client of seeder.v1.Seeder served in process by s
+func newTestGRPCClient(t *testing.T, s *importServer) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := s.newGRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Stream a CSV up in the given chunks, the options in the first message
+func startImport(ctx context.Context, conn *grpc.ClientConn, options *ImportOptions, chunks ...string) (*Import, error) {
+	stream, err := conn.NewStream(ctx, &seederServiceDesc.Streams[0], "/seeder.v1.Seeder/StartImport")
+	if err != nil {
+		return nil, err
+	}
+	for i, chunk := range chunks {
+		req := &StartImportRequest{Chunk: []byte(chunk)}
+		if i == 0 {
+			req.Options = options
+		}
+		if err := stream.SendMsg(req); err != nil {
+			return nil, err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	resp := new(Import)
+	return resp, stream.RecvMsg(resp)
+}
+
+func TestGRPCImports(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.ServeToken = "secret"
+	conn := newTestGRPCClient(t, s)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+
+	if _, err := startImport(context.Background(), conn, &ImportOptions{File: "places.csv"}, "placeId\n"); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("StartImport without the token = %v, want Unauthenticated", err)
+	}
+	if err := conn.Invoke(ctx, "/seeder.v1.Seeder/GetProgress", &GetProgressRequest{Id: "missing"}, new(Import)); status.Code(err) != codes.NotFound {
+		t.Errorf("GetProgress of a missing import = %v, want NotFound", err)
+	}
+	if _, err := startImport(ctx, conn, &ImportOptions{File: "big.csv"}, "placeId\n", strings.Repeat("p1\n", 400)); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("StartImport over SERVE_MAX_UPLOAD = %v, want ResourceExhausted", err)
+	}
+	if _, err := startImport(ctx, conn, &ImportOptions{File: "places.csv", Database: "admin"}, "placeId\n"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("StartImport into another database = %v, want InvalidArgument", err)
+	}
+
+	started, err := startImport(ctx, conn, &ImportOptions{File: "places.csv", Collection: "fixes", DryRun: true}, "placeId\n", "p1\n", "p2\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if started.GetStatus() != "queued" || started.GetCollection() != "fixes" || !started.GetDryRun() || started.GetFile() != "places.csv" {
+		t.Errorf("StartImport = %v, want a queued dry run into fixes", started)
+	}
+
+	progress := new(Import)
+	if err := conn.Invoke(ctx, "/seeder.v1.Seeder/GetProgress", &GetProgressRequest{Id: started.GetId()}, progress); err != nil {
+		t.Fatal(err)
+	}
+	if progress.GetId() != started.GetId() || progress.GetStatus() != "queued" {
+		t.Errorf("GetProgress = %v, want the queued import", progress)
+	}
+
+	canceled := new(Import)
+	if err := conn.Invoke(ctx, "/seeder.v1.Seeder/Cancel", &CancelRequest{Id: started.GetId()}, canceled); err != nil {
+		t.Fatal(err)
+	}
+	if canceled.GetStatus() != "canceled" || canceled.GetFinishedAt() == nil {
+		t.Errorf("Cancel = %v, want it canceled", canceled)
+	}
+	if err := conn.Invoke(ctx, "/seeder.v1.Seeder/Cancel", &CancelRequest{Id: started.GetId()}, new(Import)); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("second Cancel = %v, want FailedPrecondition", err)
+	}
+
+	runs := new(ListRunsResponse)
+	if err := conn.Invoke(ctx, "/seeder.v1.Seeder/ListRuns", &ListRunsRequest{}, runs); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs.GetImports()) != 1 || runs.GetImports()[0].GetId() != started.GetId() {
+		t.Errorf("ListRuns = %v, want only the canceled import", runs.GetImports())
+	}
+}
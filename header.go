@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Header holds the CSV column names, with duplicate names disambiguated
+// deterministically as name, name_2, name_3, ...
+type Header struct {
+	Names []string
+
+	// Renamed maps a column position to its original name for every
+	// duplicate column that was given a new name.
+	Renamed map[int]string
+
+	index map[string]int
+}
+
+// Duplicate header handling modes
+const (
+	duplicateHeadersRename = "rename"
+	duplicateHeadersError  = "error"
+)
+
+// Build a Header from the raw header row
+func newHeader(raw []string, mode string) (*Header, error) {
+	h := &Header{
+		Names:   make([]string, len(raw)),
+		Renamed: map[int]string{},
+		index:   make(map[string]int, len(raw)),
+	}
+
+	seen := map[string]int{}
+	for i, name := range raw {
+		name = strings.TrimSpace(name)
+		seen[name]++
+
+		unique := name
+		if seen[name] > 1 {
+			if mode == duplicateHeadersError {
+				return nil, fmt.Errorf("duplicate column %q at position %d", name, i)
+			}
+			// Skip suffixes that collide with a real column further along
+			for n := seen[name]; ; n++ {
+				unique = fmt.Sprintf("%s_%d", name, n)
+				if _, taken := h.index[unique]; !taken && !contains(raw[i+1:], unique) {
+					break
+				}
+			}
+			h.Renamed[i] = name
+		}
+
+		h.Names[i] = unique
+		h.index[unique] = i
+	}
+
+	return h, nil
+}
+
+// Index returns the position of the named column
+func (h *Header) Index(name string) (int, bool) {
+	i, ok := h.index[name]
+	return i, ok
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if strings.TrimSpace(item) == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     []string
+		mode    string
+		want    []string
+		renamed map[int]string
+		err     bool
+	}{
+		{name: "unique", raw: []string{"placeId", "name", "lat"}, want: []string{"placeId", "name", "lat"}},
+		{name: "repeated", raw: []string{"name", "id", "name", "name"}, want: []string{"name", "id", "name_2", "name_3"}, renamed: map[int]string{2: "name", 3: "name"}},
+		{name: "suffix taken further along", raw: []string{"name", "name", "name_2"}, want: []string{"name", "name_3", "name_2"}, renamed: map[int]string{1: "name"}},
+		{name: "suffix taken before", raw: []string{"name_2", "name", "name"}, want: []string{"name_2", "name", "name_3"}, renamed: map[int]string{2: "name"}},
+		{name: "empty", raw: []string{"id", "", "lat"}, want: []string{"id", "", "lat"}},
+		{name: "repeated empty", raw: []string{"", "id", "", " "}, want: []string{"", "id", "_2", "_3"}, renamed: map[int]string{2: "", 3: ""}},
+		{name: "whitespace", raw: []string{" name", "name ", "\tlat"}, want: []string{"name", "name_2", "lat"}, renamed: map[int]string{1: "name"}},
+		{name: "case", raw: []string{"Name", "name", "NAME"}, want: []string{"Name", "name", "NAME"}},
+		{name: "repeated with error mode", raw: []string{"name", "name"}, mode: duplicateHeadersError, err: true},
+		{name: "whitespace with error mode", raw: []string{"name", " name"}, mode: duplicateHeadersError, err: true},
+		{name: "empty with error mode", raw: []string{"", ""}, mode: duplicateHeadersError, err: true},
+		{name: "case with error mode", raw: []string{"Name", "name"}, mode: duplicateHeadersError, want: []string{"Name", "name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode := tt.mode
+			if mode == "" {
+				mode = duplicateHeadersRename
+			}
+			header, err := newHeader(tt.raw, mode)
+			if tt.err {
+				if err == nil {
+					t.Errorf("newHeader(%q) = %q, want an error", tt.raw, header.Names)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newHeader(%q): %v", tt.raw, err)
+			}
+			if !reflect.DeepEqual(header.Names, tt.want) {
+				t.Errorf("names = %q, want %q", header.Names, tt.want)
+			}
+			renamed := tt.renamed
+			if renamed == nil {
+				renamed = map[int]string{}
+			}
+			if !reflect.DeepEqual(header.Renamed, renamed) {
+				t.Errorf("renamed = %v, want %v", header.Renamed, renamed)
+			}
+			for i, name := range tt.want {
+				if got, ok := header.Index(name); !ok || got != i {
+					t.Errorf("Index(%q) = %d, %v, want %d", name, got, ok, i)
+				}
+			}
+		})
+	}
+}
+
+func TestHeaderIndex(t *testing.T) {
+	header, err := newHeader([]string{"name", " Lat ", "name"}, duplicateHeadersRename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want int
+		ok   bool
+	}{
+		{"name", 0, true},
+		{"name_2", 2, true},
+		{"Lat", 1, true},
+		{" Lat ", 0, false},
+		{"lat", 0, false},
+		{"NAME", 0, false},
+		{"name_3", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := header.Index(tt.name); got != tt.want || ok != tt.ok {
+			t.Errorf("Index(%q) = %d, %v, want %d, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
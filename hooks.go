@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Run a hook command with sh -c, its output going to stderr so it can't
+// mix with documents a dry run prints, the run described by env
+func runHook(name, command string, env []string) error {
+	if command == "" {
+		return nil
+	}
+	slog.Info("Running hook", "hook", name, "command", command)
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook: %w", name, err)
+	}
+	return nil
+}
+
+// The environment hooks see the run by: its status (started, completed or
+// failed), what it seeds where, and once it has finished, how long it
+// took, why it failed and the summary files its inputs wrote
+func hookEnv(cfg Config, status string, startedAt time.Time, runErr error, summaries []string) []string {
+	env := []string{
+		"SEED_STATUS=" + status,
+		"SEED_CSV_FILE=" + cfg.CSVFile,
+		"SEED_WATCH=" + cfg.Watch,
+		"SEED_DB_NAME=" + cfg.DBName,
+		"SEED_COLLECTION_NAME=" + cfg.CollectionName,
+		"SEED_TARGETS=" + cfg.Targets,
+		"SEED_WRITE_MODE=" + cfg.WriteMode,
+		"SEED_DRY_RUN=" + strconv.FormatBool(cfg.DryRun),
+		"SEED_SUMMARY_FILES=" + strings.Join(summaries, ","),
+	}
+	if status != "started" {
+		env = append(env, "SEED_DURATION_SECONDS="+strconv.FormatFloat(time.Since(startedAt).Seconds(), 'f', 3, 64))
+	}
+	if runErr != nil {
+		env = append(env, "SEED_ERROR="+runErr.Error())
+	}
+	return env
+}
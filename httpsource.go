@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reconnect attempts after the stream breaks, and retries of a failed
+// request, before giving up
+const httpMaxReconnects = 5
+
+// Backoff between retries: doubling from the base up to the cap, with
+// jitter so many readers of one source don't retry in step
+const (
+	httpRetryBase = time.Second
+	httpRetryCap  = 30 * time.Second
+)
+
+// httpReader streams a URL, reconnecting with a Range request from the
+// current byte offset when the connection drops. The ETag (or
+// Last-Modified) of the first response validates every resumed request
+// through If-Range, so a changed source is never stitched together.
+type httpReader struct {
+	client    *http.Client
+	url       string
+	validator string
+	modified  string // Last-Modified of the first response
+	offset    int64
+	size      int64
+	body      io.ReadCloser
+
+	// Error the stream broke with after a read that returned bytes, to
+	// reconnect on at the next
+	broken error
+
+	// Set for object store sources, presigning a fresh URL for every
+	// request so long runs outlive any one signature
+	presign func() (string, error)
+}
+
+// Whether the path is an HTTP(S) URL
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// Prefix for the progress, rejects and other output files: a local file's
+// path less its extension, e.g. data/places for data/places.csv. URL, object
+// store and SFTP sources write them to the working directory, named after
+// the last path segment.
+func outputPrefix(csvFile string) string {
+	if csvFile == stdinPath {
+		return "stdin"
+	}
+	if isURL(csvFile) || isObjectURL(csvFile) || isSFTPURL(csvFile) {
+		if u, err := url.Parse(csvFile); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+			csvFile = path.Base(u.Path)
+		} else {
+			csvFile = "download"
+		}
+	}
+	// Only the file name loses its extension, so dots in directory names
+	// such as ../uploads or /var/lib/seeder.d are kept
+	dir, name := filepath.Split(csvFile)
+	if base := strings.TrimSuffix(name, filepath.Ext(name)); base != "" {
+		name = base
+	}
+	return dir + name
+}
+
+// Start streaming the URL from the beginning
+func openHTTP(rawURL string) (*httpReader, error) {
+	r := &httpReader{client: &http.Client{}, url: rawURL, size: -1}
+	return r, r.open()
+}
+
+// Send the first request
+func (r *httpReader) open() error {
+	resp, err := r.request(0, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return fmt.Errorf("GET %s: %s", r.source(), resp.Status)
+	}
+
+	r.body = resp.Body
+	r.size = resp.ContentLength
+	r.validator = responseValidator(resp)
+	r.modified = resp.Header.Get("Last-Modified")
+	return nil
+}
+
+// URL to name in errors, without a query that may hold a signature
+func (r *httpReader) source() string {
+	if u, err := url.Parse(r.url); err == nil {
+		u.RawQuery = ""
+		return u.String()
+	}
+	return r.url
+}
+
+// Open the same URL from offset, provided it still has the given validator.
+// Returns nil without an error when the server can't or won't resume there.
+func (r *httpReader) resumeAt(offset int64, validator string) (*httpReader, error) {
+	if validator == "" || validator != r.validator {
+		return nil, nil
+	}
+
+	resp, err := r.request(offset, validator)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, nil
+	}
+
+	return &httpReader{
+		client:    r.client,
+		url:       r.url,
+		validator: validator,
+		offset:    offset,
+		size:      r.size,
+		body:      resp.Body,
+		presign:   r.presign,
+	}, nil
+}
+
+// Send a request, retrying with backoff when it fails to connect, the
+// server answers with a 5xx status, or it is rate limited with 429, after
+// the Retry-After delay if the server gives one
+func (r *httpReader) request(offset int64, validator string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := r.get(offset, validator)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+		delay := retryDelay(attempt)
+		if err == nil {
+			resp.Body.Close()
+			if after, ok := retryAfter(resp); ok {
+				delay = after
+			}
+			err = fmt.Errorf("GET %s: %s", r.source(), resp.Status)
+		}
+		if attempt >= httpMaxReconnects {
+			return nil, err
+		}
+		slog.Warn("Source request failed, retrying", "offset", offset, "error", err, "delay", delay)
+		time.Sleep(delay)
+	}
+}
+
+// Exponential backoff with full jitter for the given retry
+func retryDelay(attempt int) time.Duration {
+	backoff := min(httpRetryBase<<attempt, httpRetryCap)
+	return time.Duration(rand.Int64N(int64(backoff))) + time.Millisecond
+}
+
+// The delay a Retry-After header asks for, in seconds or as an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return min(time.Duration(seconds)*time.Second, httpRetryCap), true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return min(max(time.Until(at), 0), httpRetryCap), true
+	}
+	return 0, false
+}
+
+func (r *httpReader) get(offset int64, validator string) (*http.Response, error) {
+	if r.presign != nil {
+		signed, err := r.presign()
+		if err != nil {
+			return nil, err
+		}
+		r.url = signed
+	}
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Take the stored bytes as they are, so offsets stay byte offsets into
+	// the source; gzip content is decompressed further along
+	req.Header.Set("Accept-Encoding", "identity")
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		req.Header.Set("If-Range", validator)
+		// Stores that ignore If-Range, like Azure Blob, refuse a changed
+		// object instead of sending the range from it
+		if strings.HasPrefix(validator, `"`) {
+			req.Header.Set("If-Match", validator)
+		}
+	}
+	return r.client.Do(req)
+}
+
+func (r *httpReader) Read(p []byte) (int, error) {
+	for attempt := 0; ; attempt++ {
+		err := r.broken
+		if err == nil {
+			var n int
+			n, err = r.body.Read(p)
+			r.offset += int64(n)
+			if err == nil || err == io.EOF {
+				return n, err
+			}
+			if n > 0 {
+				// Hand over the bytes that came with the error, and
+				// reconnect on the next read
+				r.broken = err
+				return n, nil
+			}
+		}
+		r.broken = nil
+		if attempt >= httpMaxReconnects || r.validator == "" {
+			return 0, err
+		}
+
+		slog.Warn("Source stream interrupted, resuming", "offset", r.offset, "error", err)
+		time.Sleep(retryDelay(attempt))
+		if reconnectErr := r.reconnect(); reconnectErr != nil {
+			return 0, reconnectErr
+		}
+	}
+}
+
+// Reopen the stream at the current offset
+func (r *httpReader) reconnect() error {
+	r.body.Close()
+	resp, err := r.request(r.offset, r.validator)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return errors.New("source changed or doesn't support Range requests, cannot resume stream")
+	}
+	r.body = resp.Body
+	return nil
+}
+
+func (r *httpReader) Close() error {
+	return r.body.Close()
+}
+
+// Validator usable in If-Range: a strong ETag, or Last-Modified
+func responseValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	if resp.Header.Get("Accept-Ranges") == "bytes" {
+		return resp.Header.Get("Last-Modified")
+	}
+	return ""
+}
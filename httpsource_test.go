@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestOutputPrefix(t *testing.T) {
+	tests := []struct {
+		csvFile string
+		want    string
+	}{
+		{"places.csv", "places"},
+		{"data/places.csv", "data/places"},
+		{"../a.csv", "../a"},
+		{"../uploads/0123/places.csv", "../uploads/0123/places"},
+		{"/var/lib/seeder.d/0123/places.csv", "/var/lib/seeder.d/0123/places"},
+		{"places.csv.gz", "places.csv"},
+		{"places", "places"},
+		{".csv", ".csv"},
+		{"-", "stdin"},
+		{"https://example.com/exports/places.csv?token=x", "places"},
+		{"s3://bucket/exports/places.csv", "places"},
+		{"https://example.com/", "download"},
+	}
+	for _, tt := range tests {
+		if got := outputPrefix(tt.csvFile); got != tt.want {
+			t.Errorf("outputPrefix(%q) = %q, want %q", tt.csvFile, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// sampledRow is a row read ahead for inference, with the reader's byte
+// offset just past it and the malformed row error tolerated in repair mode
+type sampledRow struct {
+	record []string
+	offset int64
+	err    error
+}
+
+// Read up to n rows to infer the schema from, fewer at the end of the file
+func readSample(reader *csvReader, n int) ([]sampledRow, error) {
+	var sample []sampledRow
+	for len(sample) < n {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !reader.tolerates(err) {
+			return sample, err
+		}
+		sample = append(sample, sampledRow{record: record, offset: reader.InputOffset(), err: err})
+	}
+	return sample, nil
+}
+
+// Build the document schema for the header. Columns declared in the mapping
+// keep their type, and columns with a date layout are dates; the rest are
+// inferred from the sampled rows as int64, double, bool, date, array or
+// string. Null tokens don't count; columns with no values, or with values of
+// conflicting types, are strings.
+func newDocumentSchema(header *Header, mapping Mapping, nulls []nullRule, sample []sampledRow) (documentSchema, error) {
+	declared := map[string]columnType{}
+	for name, layout := range mapping.Dates {
+		declared[name] = columnType{Type: typeDate, Format: layout}
+	}
+	for name, t := range mapping.Types {
+		if layout, ok := mapping.Dates[name]; ok && t.Type == typeDate && t.Format == "" {
+			t.Format = layout
+		}
+		declared[name] = t
+	}
+	for name := range declared {
+		if _, ok := header.Index(name); !ok {
+			return documentSchema{}, fmt.Errorf("type for %q: column not found in header", name)
+		}
+	}
+
+	schema := documentSchema{names: header.Names, types: make([]columnType, len(header.Names)), nulls: nulls}
+	for i, name := range header.Names {
+		if t, ok := declared[name]; ok {
+			schema.types[i] = t
+			continue
+		}
+
+		inferred := ""
+		for _, row := range sample {
+			if row.err != nil || i >= len(row.record) || nulls[i].matches(row.record[i]) || row.record[i] == "" {
+				continue
+			}
+			inferred = widenType(inferred, valueType(row.record[i]))
+		}
+		if inferred == "" {
+			inferred = typeString
+		}
+		schema.types[i] = columnType{Type: inferred}
+	}
+	return schema, nil
+}
+
+// Narrowest inferable type that can hold the value
+func valueType(value string) string {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return typeInt64
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return typeDouble
+	}
+	if _, err := (columnType{}).parseBool(value); err == nil {
+		return typeBool
+	}
+	if _, err := (columnType{}).parseDate(value); err == nil {
+		return typeDate
+	}
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		return typeArray
+	}
+	return typeString
+}
+
+// Type holding values of both types
+func widenType(current, next string) string {
+	switch {
+	case current == "" || current == next:
+		return next
+	case current == typeInt64 && next == typeDouble, current == typeDouble && next == typeInt64:
+		return typeDouble
+	default:
+		return typeString
+	}
+}
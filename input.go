@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Read modes
+const (
+	readModeBufio = "bufio"
+	readModeMmap  = "mmap"
+)
+
+// CSV_FILE naming standard input
+const stdinPath = "-"
+
+// input is an opened CSV source
+type input struct {
+	io.Reader
+	size    int64
+	closers []io.Closer
+
+	// Set when reading from a URL, from a local file, or from stdin
+	http  *httpReader
+	file  *os.File
+	stdin bool
+
+	// The local file's memory mapping in mmap mode, and whether its rows
+	// are read straight from it rather than through Reader
+	mapped     mapping
+	readMapped bool
+
+	// Set when reading a worksheet of a workbook or a Parquet file
+	table tableSource
+
+	// Set when reading an archive, with the name of the member being read
+	archive archiveReader
+	member  string
+
+	// Input format: csv, ndjson, xlsx or parquet
+	format string
+
+	// Detected compression and encoding, the source bytes consumed when the
+	// input is decompressed or transcoded to UTF-8, and the length of a
+	// stripped UTF-8 BOM
+	compression       string
+	requestedEncoding string
+	encoding          string
+	counter           *countingReader
+	skipped           int64
+}
+
+func (in *input) Close() error {
+	var firstErr error
+	for i := len(in.closers) - 1; i >= 0; i-- {
+		if err := in.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Open the CSV file for reading in the given mode. mmap falls back to
+// regular reads where it isn't supported. http:// and https:// paths are
+// streamed from the server, s3://, gs:// and az:// objects from the store,
+// through endpoint if set, sftp:// files over SSH, and - is read from stdin.
+func openInput(path, mode, endpoint string) (*input, error) {
+	if path == stdinPath {
+		return &input{Reader: os.Stdin, size: -1, stdin: true}, nil
+	}
+	if isURL(path) || isObjectURL(path) {
+		var source *httpReader
+		var err error
+		if isObjectURL(path) {
+			source, err = openObject(path, endpoint)
+		} else {
+			source, err = openHTTP(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &input{Reader: source, size: source.size, closers: []io.Closer{source}, http: source}, nil
+	}
+	if isSFTPURL(path) {
+		source, err := openSFTP(path)
+		if err != nil {
+			return nil, err
+		}
+		return &input{Reader: source, size: source.size, closers: []io.Closer{source}}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	in := &input{Reader: file, size: fileInfo.Size(), closers: []io.Closer{file}, file: file}
+
+	if mode == readModeMmap {
+		mapped, err := mmapFile(file, in.size)
+		if err != nil {
+			slog.Warn("mmap unavailable, using buffered reads", "error", err)
+		} else {
+			// Reader only serves to sniff the compression, encoding and
+			// format, unless they rule out reading rows from the mapping
+			in.Reader = bytes.NewReader(mapped)
+			in.mapped = mapped
+			in.closers = append(in.closers, mapped)
+		}
+	}
+
+	return in, nil
+}
+
+// Open CSV_FILE in READ_MODE and get it ready to be read as CSV: decompress
+// it, open the worksheet, Parquet file or archive member holding the rows,
+// transcode it to UTF-8 and detect its format. tee, if not nil, is written
+// the source's bytes as they are read, before any of that.
+func openSource(cfg Config, tee io.Writer) (*input, error) {
+	in, err := openInput(cfg.CSVFile, cfg.ReadMode, cfg.SourceEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	if tee != nil {
+		in.Reader = io.TeeReader(in.Reader, tee)
+	}
+	steps := []func() error{
+		in.decompress,
+		func() error { return in.openSpreadsheet(cfg.InputFormat, cfg.CSVFile, cfg.XLSXSheet) },
+		func() error { return in.openParquet(cfg.InputFormat, cfg.CSVFile, cfg.ParquetColumns) },
+		func() error { return in.openArchive(cfg.ArchiveMembers) },
+		func() error { return in.decode(cfg.Encoding) },
+		func() error { return in.detectFormat(cfg.InputFormat) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			in.Close()
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// Split CSV_FILE into the sources read one after another: a comma-separated
+// list, with glob patterns in local paths expanded in name order. Sources
+// keep their own progress and output files, so no two may share a prefix.
+func expandInputs(csvFile string) ([]string, error) {
+	var inputs []string
+	for _, entry := range strings.Split(csvFile, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+		case isURL(entry) || isObjectURL(entry) || isSFTPURL(entry) || !strings.ContainsAny(entry, "*?["):
+			inputs = append(inputs, entry)
+		default:
+			matches, err := filepath.Glob(entry)
+			if err != nil {
+				return nil, fmt.Errorf("CSV_FILE pattern %q: %w", entry, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("CSV_FILE pattern %q matches no files", entry)
+			}
+			inputs = append(inputs, matches...)
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("CSV_FILE names no files")
+	}
+
+	prefixes := map[string]string{}
+	for _, source := range inputs {
+		prefix := outputPrefix(source)
+		if other, ok := prefixes[prefix]; ok {
+			return nil, fmt.Errorf("CSV_FILE sources %s and %s would share the %s output files", other, source, prefix)
+		}
+		prefixes[prefix] = source
+	}
+	return inputs, nil
+}
+
+// outputNames are the files a run writes, named after its source
+type outputNames struct {
+	progress        string
+	rejects         string
+	previousRejects string
+	dryRunRejects   string
+	summary         string
+	audit           string
+	snapshot        string
+	deleteProgress  string
+
+	nearDuplicates       string
+	dryRunNearDuplicates string
+}
+
+// Output files for the source with the given prefix
+func newOutputNames(prefix string) outputNames {
+	return outputNames{
+		progress:        prefix + progressFile,
+		rejects:         prefix + rejectsFile,
+		previousRejects: prefix + previousRejectsFile,
+		dryRunRejects:   prefix + dryRunRejectsFile,
+		summary:         prefix + summaryFile,
+		audit:           prefix + auditFile,
+		snapshot:        prefix + snapshotFile,
+		deleteProgress:  prefix + deleteProgressFile,
+
+		nearDuplicates:       prefix + nearDuplicatesFile,
+		dryRunNearDuplicates: prefix + dryRunNearDuplicatesFile,
+	}
+}
+
+// The configuration for processing one source, writing its output files
+// with the given prefix, then the target's name
+func (cfg Config) forSource(source, prefix string) Config {
+	if cfg.target != "" {
+		prefix += "_" + cfg.target
+	}
+	cfg.CSVFile = source
+	cfg.outputs = newOutputNames(prefix)
+	return cfg
+}
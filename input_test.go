@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"part-1.csv", "part-2.csv", "part-1.csv.gz", "other.csv"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	in := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		csvFile string
+		want    []string // nil for an error
+	}{
+		{csvFile: "../a.csv,../b.csv", want: []string{"../a.csv", "../b.csv"}},
+		{csvFile: " a.csv , , b.csv ", want: []string{"a.csv", "b.csv"}},
+		{csvFile: "/var/lib/seeder.d/a.csv,/var/lib/seeder.d/b.csv", want: []string{"/var/lib/seeder.d/a.csv", "/var/lib/seeder.d/b.csv"}},
+		{csvFile: in("part-*.csv"), want: []string{in("part-1.csv"), in("part-2.csv")}},
+		{csvFile: in("part-*") + "," + in("other.csv"), want: []string{in("part-1.csv"), in("part-1.csv.gz"), in("part-2.csv"), in("other.csv")}},
+		{csvFile: "https://example.com/a.csv,data/b.csv", want: []string{"https://example.com/a.csv", "data/b.csv"}},
+
+		// Sources sharing output files
+		{csvFile: "a.csv,a.tsv"},
+		{csvFile: "a.csv,a.csv"},
+		{csvFile: "https://example.com/x/a.csv,https://example.com/y/a.csv"},
+		{csvFile: in("part-1.csv") + "," + in("part-*.csv")},
+
+		// Nothing to read
+		{csvFile: ""},
+		{csvFile: " , "},
+		{csvFile: in("missing-*.csv")},
+		{csvFile: in("part-[.csv")},
+	}
+	for _, tt := range tests {
+		got, err := expandInputs(tt.csvFile)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("expandInputs(%q) = %q, want an error", tt.csvFile, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expandInputs(%q): %v", tt.csvFile, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandInputs(%q) = %q, want %q", tt.csvFile, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Log formats
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Set up the default logger. Per-row events are logged at debug level so
+// normal runs stay readable; per-batch events at info.
+func setupLogging(cfg Config) (io.Closer, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return nil, fmt.Errorf("invalid LOG_LEVEL %q", cfg.LogLevel)
+	}
+
+	var output io.WriteCloser = nopCloser{os.Stderr}
+	if cfg.LogFile != "" {
+		file, err := appendRollingFile(cfg.LogFile, cfg.LogCompress, cfg.LogMaxSize, cfg.LogMaxBackups+1)
+		if err != nil {
+			return nil, err
+		}
+		output = &logFile{file: file}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(output, opts)
+	if cfg.LogFormat == logFormatJSON {
+		handler = slog.NewJSONHandler(output, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+
+	return output, nil
+}
+
+// Log an error and exit
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// logFile is the log file, written a record at a time and rolled into a new
+// part between records
+type logFile struct {
+	mu   sync.Mutex
+	file *rollingFile
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, err := l.file.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := l.file.flush(); err != nil {
+		return n, err
+	}
+	if l.file.full() {
+		return n, l.file.roll()
+	}
+	return n, nil
+}
+
+func (l *logFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Parse a positive size such as 512K, 100MB or 1G into bytes
+func parseSize(value string) (int64, error) {
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	multiplier := int64(1)
+	for suffix, m := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if strings.HasSuffix(number, suffix) {
+			multiplier = m
+			number = strings.TrimSuffix(number, suffix)
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q, want a positive whole number of bytes with an optional K, M or G suffix", value)
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size %q is too large", value)
+	}
+	return n * multiplier, nil
+}
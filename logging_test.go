@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		err   bool
+	}{
+		{value: "512", want: 512},
+		{value: "512B", want: 512},
+		{value: "512K", want: 512 << 10},
+		{value: "100M", want: 100 << 20},
+		{value: "100MB", want: 100 << 20},
+		{value: " 1g ", want: 1 << 30},
+		{value: "2GB", want: 2 << 30},
+		{value: "1.5G", err: true},
+		{value: "-1", err: true},
+		{value: "0", err: true},
+		{value: "10x", err: true},
+		{value: "M", err: true},
+		{value: "B", err: true},
+		{value: "100TB", err: true},
+		{value: "9999999999G", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseSize(tt.value)
+			if tt.err {
+				if err == nil {
+					t.Errorf("parseSize(%q) = %d, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parseSize(%q) = %d, %v, want %d", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -2,49 +2,78 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"hash"
+	"io"
+	"log/slog"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/cheggaaa/pb/v3"
-	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Location struct {
 	Type        string     `json:"type"`
 	Coordinates [2]float64 `json:"coordinates"`
+
+	// Output format of the geo field, GeoJSON if empty
+	format string
+
+	// Whether the coordinates were kept despite being missing or invalid
+	invalid bool
 }
 
 type Place struct {
-	PlaceID               string     `json:"placeId" bson:"placeId"`
-	Address               string     `json:"address" bson:"address"`
-	Version               string     `json:"version" bson:"version"`
-	IsAutoCompleteAddress bool       `json:"isAutoCompleteAddress" bson:"isAutoCompleteAddress"`
-	Types                 []string   `json:"types" bson:"types"`
-	PlusCode              string     `json:"plusCode" bson:"plusCode"`
-	City                  string     `json:"city" bson:"city"`
-	Division              string     `json:"division" bson:"division"`
-	District              string     `json:"district" bson:"district"`
-	PostalCode            string     `json:"postalCode" bson:"postalCode"`
-	Sublocality           string     `json:"sublocality" bson:"sublocality"`
-	LocalArea             string     `json:"localArea" bson:"localArea"`
-	Location              *Location  `json:"location" bson:"location"`
-	Suggestions           []any      `json:"suggestions" bson:"suggestions"`
-	Reviews               []any      `json:"reviews" bson:"reviews"`
-	MergedAt              *time.Time `json:"mergedAt" bson:"mergedAt"`
-	IsMerged              bool       `json:"isMerged" bson:"isMerged"`
+	PlaceID               string             `json:"placeId" bson:"placeId"`
+	Address               string             `json:"address" bson:"address"`
+	Version               string             `json:"version" bson:"version"`
+	IsAutoCompleteAddress bool               `json:"isAutoCompleteAddress" bson:"isAutoCompleteAddress"`
+	Types                 []string           `json:"types" bson:"types"`
+	PlusCode              string             `json:"plusCode" bson:"plusCode"`
+	City                  string             `json:"city" bson:"city"`
+	Division              string             `json:"division" bson:"division"`
+	District              string             `json:"district" bson:"district"`
+	PostalCode            string             `json:"postalCode" bson:"postalCode"`
+	Sublocality           string             `json:"sublocality" bson:"sublocality"`
+	LocalArea             string             `json:"localArea" bson:"localArea"`
+	Location              *Location          `json:"location" bson:"location"`
+	Suggestions           []any              `json:"suggestions" bson:"suggestions"`
+	Reviews               []any              `json:"reviews" bson:"reviews"`
+	MergedAt              *time.Time         `json:"mergedAt" bson:"mergedAt"`
+	IsMerged              bool               `json:"isMerged" bson:"isMerged"`
+	MergedInto            string             `json:"mergedInto,omitempty" bson:"mergedInto,omitempty"`
+	GarbageFlags          []string           `json:"garbageFlags,omitempty" bson:"garbageFlags,omitempty"`
+	OutOfBounds           []string           `json:"outOfBounds,omitempty" bson:"outOfBounds,omitempty"`
+	SwappedCoordinates    []string           `json:"swappedCoordinates,omitempty" bson:"swappedCoordinates,omitempty"`
+	InvalidPlusCode       bool               `json:"invalidPlusCode,omitempty" bson:"invalidPlusCode,omitempty"`
+	BoundaryMismatches    []boundaryMismatch `json:"boundaryMismatches,omitempty" bson:"boundaryMismatches,omitempty"`
+
+	// Additional GeoJSON and computed fields from the mapping
+	Extra map[string]any `json:"-" bson:",inline"`
+
+	// Fields that held null tokens: null or omit
+	nullFields map[string]string
+
+	// Geo fields left out of the document
+	omitFields []string
 }
 
-// File to store the last processed PlaceID
-var progressFile = "_progress.txt"
+// Suffix of the file storing the last processed PlaceID
+const progressFile = "_progress.txt"
 
 func parseArrayFromColumn(csv string) []string {
 	// Remove the square brackets and spaces
@@ -53,215 +82,1406 @@ func parseArrayFromColumn(csv string) []string {
 	// Split the string by commas
 	items := strings.Split(cleaned, ",")
 
-	// Trim any surrounding whitespace or quotes from each element
+	// Trim any surrounding whitespace or quotes from each element, single
+	// quoted or double quoted as in JSON
 	for i, item := range items {
-		items[i] = strings.TrimSpace(strings.Trim(item, "'"))
+		items[i] = strings.TrimSpace(strings.Trim(strings.TrimSpace(item), `'"`))
 	}
 
 	return items
 }
 
 // CSV processing and MongoDB insertion
-func processCSV(csvFile string, mongoURI string, dbName string, collectionName string) error {
-	// Connect to MongoDB
-	clientOpts := options.Client().ApplyURI(mongoURI)
-	client, err := mongo.Connect(context.Background(), clientOpts)
+func processCSV(cfg Config) (err error) {
+	stats := newRunStats()
+	cfg.control.track(cfg, stats)
+	defer func() {
+		if summaryErr := writeSummary(newRunSummary(cfg, stats, err), cfg.outputs.summary); summaryErr != nil {
+			slog.Error("Error writing summary", "error", summaryErr)
+		}
+		// Runs last, once the audit log and rejects file are closed
+		uploadReportsIfConfigured(cfg, stats)
+	}()
+
+	ctx, runSpan := tracer.Start(cfg.control.context(), "seed", trace.WithAttributes(
+		attribute.String("seeder.csv_file", cfg.CSVFile),
+		attribute.String("db.name", cfg.DBName),
+		attribute.String("db.mongodb.collection", cfg.CollectionName),
+	))
+	defer func() {
+		if err != nil {
+			runSpan.RecordError(err)
+			runSpan.SetStatus(codes.Error, err.Error())
+		}
+		runSpan.End()
+	}()
+
+	mapping, err := loadMapping(cfg.MappingFile)
+	if err != nil {
+		return err
+	}
+	garbage, err := newGarbageFilter(cfg)
+	if err != nil {
+		return err
+	}
+	bounds, err := loadBoundaries(cfg.BoundariesFile, cfg.BoundariesMode)
+	if err != nil {
+		return err
+	}
+	addresses, err := newAddressNormalizer(cfg.AddressNormalize, cfg.AddressCountrySuffixes)
+	if err != nil {
+		return err
+	}
+	provenance, err := newProvenance(cfg.Provenance, cfg.ProvenanceFields)
 	if err != nil {
 		return err
 	}
-	defer client.Disconnect(context.Background())
 
-	collection := client.Database(dbName).Collection(collectionName)
+	// Generic documents, one field per column, instead of a Place
+	generic := cfg.InferSchema || len(mapping.Types) > 0
+	if option := cfg.placeOnlyOption(); generic && option != "" {
+		return fmt.Errorf("%s needs the Place schema, not the mapping's column types", option)
+	}
 
-	// Open CSV file
-	file, err := os.Open(csvFile)
+	audit, err := openAuditLog(cfg, stats.importID)
+	if err != nil {
+		return err
+	}
+	defer audit.Close()
+	audit.record("run_started", map[string]any{"db": cfg.DBName, "collection": cfg.CollectionName, "dryRun": cfg.DryRun})
+	defer func() {
+		details := map[string]any{"status": "completed"}
+		if err != nil {
+			details = map[string]any{"status": "failed", "error": err.Error()}
+		}
+		audit.record("run_finished", details)
+	}()
+
+	// Connect to MongoDB, again when credentials from the secrets backend
+	// are due to be refreshed
+	var refreshAt time.Time
+	connect := func() (*mongo.Client, error) {
+		clientOpts, refresh, err := clientOptions(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.WarmupConnections > 0 {
+			// Keep the warmed up connections open for the whole run
+			clientOpts.SetMinPoolSize(uint64(cfg.WarmupConnections))
+		}
+		refreshAt = refresh
+		return mongo.Connect(ctx, clientOpts)
+	}
+	client, err := connect()
 	if err != nil {
 		return err
 	}
+	defer func() {
+		client.Disconnect(context.Background())
+	}()
+
+	if !cfg.DryRun {
+		if err := pingServer(ctx, client, cfg.ConnectRetries); err != nil {
+			return err
+		}
+	}
+	if cfg.WarmupConnections > 0 && !cfg.DryRun {
+		if err := warmUpConnections(ctx, client, cfg.WarmupConnections); err != nil {
+			return err
+		}
+	}
+
+	// Encode documents with the configured codecs
+	collectionOpts := options.Collection().SetRegistry(bsonRegistry)
+	collection := client.Database(cfg.DBName).Collection(cfg.CollectionName, collectionOpts)
+
+	// Byte offset of the reader's start within the source, non-zero after
+	// resuming an HTTP source part way through
+	var baseOffset int64
+
+	// Integrity manifest and run record, hashing the source as it is read
+	var file *input
+	var integrity *manifest
+	var sourceHash hash.Hash
+	readWholeSource := false
+	sourceSHA256 := func() string {
+		// An HTTP source resumed part way through wasn't read whole, and a
+		// Parquet file is read by seeking rather than through the hash
+		if file == nil || sourceHash == nil || !readWholeSource || baseOffset != 0 || file.format == inputFormatParquet {
+			return ""
+		}
+		if file.readMapped {
+			// Rows read from the mapping bypass the hash
+			sum := sha256.Sum256(file.mapped)
+			return hex.EncodeToString(sum[:])
+		}
+		return hex.EncodeToString(sourceHash.Sum(nil))
+	}
+	if (cfg.Manifest || cfg.RecordRuns) && !cfg.DryRun {
+		sourceHash = sha256.New()
+	}
+	if cfg.RecordRuns && !cfg.DryRun {
+		defer func() {
+			summary := newRunSummary(cfg, stats, err)
+			if recordErr := recordRun(context.Background(), client.Database(cfg.DBName), cfg, summary, sourceSHA256()); recordErr != nil {
+				slog.Error("Error recording run", "error", recordErr, "collection", runsCollection)
+			}
+		}()
+	}
+	if cfg.Manifest && !cfg.DryRun {
+		integrity = newManifest(cfg, stats)
+		defer func() {
+			if writeErr := integrity.write(context.Background(), client.Database(cfg.DBName), sourceSHA256(), err); writeErr != nil {
+				slog.Error("Error writing manifest", "error", writeErr)
+			}
+		}()
+	}
+
+	// Open CSV file
+	if file, err = openSource(cfg, sourceHash); err != nil {
+		return err
+	}
 	defer file.Close()
+	slog.Info("Reading CSV", "format", file.format, "compression", file.compression, "encoding", file.encoding)
 
-	reader := csv.NewReader(file)
+	reader := newCSVReader(file, cfg)
 
 	// Retrieve last processed PlaceID
-	lastProcessedID, err := getLastProcessedPlaceID()
+	checkpoints, err := openCheckpointStore(ctx, cfg)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", ErrCheckpoint, err)
 	}
+	defer checkpoints.Close()
+	resume, err := getLastProcessedPlaceID(ctx, checkpoints, cfg.outputs.progress)
+	if err != nil {
+		return fmt.Errorf("%w: reading %s: %w", ErrCheckpoint, cfg.outputs.progress, err)
+	}
+	lastProcessedID := resume.PlaceID
+	if cfg.Rows.set() {
+		slog.Info("Processing a row range, ignoring the checkpoint", "rows", cfg.Rows.String())
+		lastProcessedID = ""
+	}
+	if cfg.Recreate || cfg.Truncate {
+		lastProcessedID = ""
+	}
+
+	if cfg.Sample > 0 || cfg.SampleEvery > 0 {
+		slog.Info("Writing a sample of the rows", "fraction", cfg.Sample, "every", cfg.SampleEvery)
+	}
+
+	// Track progress by byte position so the bar shows a real percentage and ETA
+	progressBar := newProgress(cfg, file.size, stats)
 
-	// Track progress
-	totalRecords := 0
-	progressBar := pb.New(totalRecords).Set(pb.Bytes, true).SetWidth(27)
-	progressBar.Start()
+	// Dump stats on SIGUSR2 for inspecting a running import
+	stopStatsDump := dumpStatsOnSignal(stats)
+	defer stopStatsDump()
 
-	batchSize := 1000
-	var batch []interface{}
+	batchSize := cfg.BatchSize
+	var batch []any // *Place, or bson.D for generic documents
+	var batchRecords [][]string
+	var batchTargets []routeTarget // With ROUTE_COLUMN, where each document goes
+	var batchFirstRow int64
+	checkpoint := ""
+	var checkpointRow, checkpointOffset int64
+
+	// Each batch gets a span, with the time spent reading and transforming
+	// its rows recorded as attributes
+	var batchCtx context.Context
+	var batchSpan trace.Span
+	var readTime, transformTime time.Duration
+
+	// Documents printed so far in a dry run
+	dryRunPrinted := 0
 	startProcessing := lastProcessedID == ""
+	var rowNumber int64
 
 	// Set up signal handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Read the header
-	header, err := reader.Read()
+	// Read the header. Rows read ahead, to detect spreadsheet columns or
+	// infer the schema from, are replayed before reading on.
+	rawHeader, sample, err := reader.readHeader(cfg.SkipColumns)
+	if err != nil {
+		slog.Error("Error reading header", "error", err)
+		return err
+	}
+	var schemaErr error
+	if cfg.StrictSchema {
+		schemaErr = checkStrictSchema(rawHeader, mapping)
+	}
+	audit.record("schema_checked", map[string]any{
+		"headerHash": headerHash(rawHeader),
+		"columns":    len(rawHeader),
+		"strict":     cfg.StrictSchema,
+		"matched":    schemaErr == nil,
+	})
+	if schemaErr != nil {
+		return schemaErr
+	}
+
+	header, err := newHeader(rawHeader, cfg.DuplicateHeaders)
+	if err != nil {
+		return err
+	}
+	slog.Info("Header", "columns", header.Names)
+	for i := range header.Names {
+		if name, ok := header.Renamed[i]; ok {
+			slog.Warn("Duplicate column renamed", "column", name, "position", i, "renamedTo", header.Names[i])
+		}
+	}
+
+	cols, err := mapping.resolve(header)
+	if err != nil {
+		return err
+	}
+	var geo []geoColumn
+	if generic {
+		// Resume and retries key on a placeId column, or the first column
+		cols = columns{"placeId": 0}
+		if i, ok := header.Index("placeId"); ok {
+			cols["placeId"] = i
+		}
+	} else {
+		if cfg.WriteMode == writeModeUpdate {
+			cols.provided(header, mapping)
+		}
+		geo, err = mapping.resolveGeo(header, cols, GeoField{OnInvalid: cfg.GeoOnInvalid, Format: cfg.GeoFormat})
+		if err != nil {
+			return err
+		}
+		for i := range geo {
+			geo[i].swap, geo[i].bbox = cfg.GeoSwap, cfg.GeoBBox
+			if cfg.MergeDuplicates && geo[i].Field == "location" && geo[i].Format != geoFormatGeoJSON {
+				return fmt.Errorf("MERGE_DUPLICATES needs location written as geojson")
+			}
+		}
+	}
+
+	// Columns kept out of the documents
+	excluded, err := excludedColumns(cfg, header)
 	if err != nil {
-		fmt.Println("Error reading header:", err)
 		return err
 	}
-	fmt.Println("Header:", header)
+	if excluded != nil && !generic {
+		if geo, err = cols.exclude(excluded, geo); err != nil {
+			return err
+		}
+	}
+	// Updates set only the fields the file has columns for
+	var unprovided []string
+	if cfg.WriteMode == writeModeUpdate && !generic {
+		unprovided = cols.unprovided(geo)
+	}
+	filter, err := newRowFilter(cfg.Where, header, cols)
+	if err != nil {
+		return err
+	}
+	countries, err := newCountryFilter(cfg, header, cols)
+	if err != nil {
+		return err
+	}
+	dedupe, err := newDedupeSet(cfg.DedupeKey, cfg.DedupeMaxKeys, header, cols)
+	if err != nil {
+		return err
+	}
+	router, err := newRouter(cfg, header, cols)
+	if err != nil {
+		return err
+	}
+
+	computed, err := mapping.resolveComputed(header, cols, geo, generic)
+	if err != nil {
+		return err
+	}
+
+	var pacer *writePacer
+	if !cfg.DryRun {
+		if pacer, err = newWritePacer(cfg); err != nil {
+			return err
+		}
+	}
+
+	// Rows rejected by the previous run are retried even if they are behind
+	// the resume point
+	retry, err := loadPreviousRejects(cfg.outputs, cols["placeId"], cfg.DryRun)
+	if err != nil {
+		return err
+	}
+	if len(retry) > 0 {
+		slog.Info("Retrying rows rejected by the previous run", "rows", len(retry))
+	}
+
+	// An HTTP source can skip straight to the checkpoint instead of
+	// re-downloading and scanning everything before it
+	if file.http != nil && !file.transformed() && !startProcessing && len(retry) == 0 && resume.Offset > 0 {
+		resumed, err := file.http.resumeAt(resume.Offset, resume.Validator)
+		if err != nil {
+			return err
+		}
+		if resumed == nil {
+			slog.Warn("Source can't resume from the checkpoint, scanning from the start")
+		} else {
+			slog.Info("Resuming source from checkpoint", "offset", resume.Offset, "row", resume.Row)
+			file.http.Close()
+			file.http = resumed
+			file.closers = []io.Closer{resumed}
+			reader = reader.continueFrom(resumed, cfg)
+			sample = nil
+			baseOffset = resume.Offset
+			file.skipped = 0
+			rowNumber = resume.Row
+			startProcessing = true
+		}
+	}
+
+	// Piped input may not be the same stream as last time, so resume by
+	// counting rows up to the checkpoint rather than looking for its PlaceID
+	resumeByRow := file.stdin && !startProcessing && resume.Row > 0
+	if resumeByRow {
+		slog.Info("Resuming stdin by row count", "row", resume.Row)
+	}
+
+	// Generic documents treat empty cells as null unless configured otherwise;
+	// the Place schema only applies configured null tokens
+	var defaultNullTokens []string
+	if generic {
+		defaultNullTokens = []string{""}
+	}
+	nullRules, err := mapping.Nulls.resolve(header, defaultNullTokens)
+	if err != nil {
+		return err
+	}
+	placeNulls := placeNullRules(nullRules, cols)
+
+	// Layout of the mergedAt column, when it is mapped
+	mergedAtLayout := ""
+	if i, ok := cols["mergedAt"]; ok {
+		mergedAtLayout = mapping.Dates[header.Names[i]]
+	}
+
+	var docSchema *documentSchema
+	if generic {
+		if cfg.InferSchema && len(sample) < cfg.InferSampleRows {
+			more, err := readSample(reader, cfg.InferSampleRows-len(sample))
+			if err != nil {
+				return err
+			}
+			sample = append(sample, more...)
+		}
+		schema, err := newDocumentSchema(header, mapping, nullRules, sample)
+		if err != nil {
+			return err
+		}
+		schema.excluded = excluded
+		docSchema = &schema
+		slog.Info("Document schema", "sampledRows", len(sample), "fields", schema.String())
+		audit.record("schema_resolved", map[string]any{"sampledRows": len(sample), "fields": schema.String()})
+	}
+
+	// Create the collection, as a time-series or capped collection or with
+	// a validator derived from the mapping, before indexes would create it
+	// plainly
+	var validator bson.D
+	if cfg.SchemaValidator {
+		if docSchema != nil {
+			validator = documentValidator(*docSchema, cfg.BSONTimeFormat)
+		} else {
+			validator = placeValidator(geo, cfg.BSONTimeFormat)
+		}
+	}
+	targets := []*mongo.Collection{collection}
+	if router != nil {
+		targets = nil
+		for _, target := range router.targets() {
+			targets = append(targets, client.Database(target.Database).Collection(target.Collection, collectionOpts))
+		}
+	}
+	for _, target := range targets {
+		if err := createCollection(ctx, target, cfg, validator); err != nil {
+			return err
+		}
+		if !cfg.DryRun {
+			if err := createGeoIndexes(ctx, target, geo); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Against Atlas serverless, every document costs a write per index entry;
+	// a dry run counts the _id index and the geo indexes it would create
+	indexes := 1
+	if cfg.Serverless {
+		if cfg.DryRun {
+			for _, g := range geo {
+				if g.Index {
+					indexes++
+				}
+			}
+		} else if indexes, err = countIndexes(ctx, collection); err != nil {
+			return err
+		}
+		indexes = max(indexes, 1)
+	}
+
+	idColumn := -1
+	if cfg.IDField != "" {
+		var ok bool
+		if idColumn, ok = cols[cfg.IDField]; !ok {
+			if idColumn, ok = header.Index(cfg.IDField); !ok {
+				return fmt.Errorf("ID_FIELD: %q is neither a mapped field nor a column", cfg.IDField)
+			}
+		}
+	}
+	rejects := newRejectsWriter(cfg, header.Names)
+	defer rejects.Close()
+	nearDups := newNearDuplicates(cfg, header.Names)
+	if nearDups != nil {
+		defer nearDups.Close()
+	}
+
+	// Rows before the resume point were deduplicated by the run that wrote
+	// them; remember the keys and places of those that got as far, so later
+	// rows repeating one are still skipped or held back
+	rememberSkipped := func(record []string, malformed error) {
+		if dedupe == nil && nearDups == nil || malformed != nil {
+			return
+		}
+		if countries != nil && !countries.keep(record) {
+			return
+		}
+		if filter != nil {
+			if keep, err := filter.keep(record); err != nil || !keep {
+				return
+			}
+		}
+		if dedupe != nil && dedupe.duplicate(record) {
+			return
+		}
+		if nearDups != nil {
+			place := Place{PlaceID: cols.get(record, "placeId"), Address: cols.get(record, "address")}
+			if addresses != nil {
+				place.Address = addresses.normalize(place.Address)
+			}
+			if _, err := setGeoFields(&place, geo, record); err == nil {
+				nearDups.match(&place)
+			}
+		}
+	}
+
+	// Export documents written since the last snapshot every SnapshotInterval
+	var snapshots *snapshotExporter
+	if cfg.SnapshotInterval > 0 && !cfg.DryRun {
+		snapshots = newSnapshotExporter(collection, cfg.outputs.snapshot, cfg.SnapshotInterval)
+	}
+	exportSnapshot := func() error {
+		name, exported, err := snapshots.export(ctx)
+		if err != nil {
+			return fmt.Errorf("exporting snapshot: %w", err)
+		}
+		if name != "" {
+			slog.Info("Snapshot exported", "file", name, "documents", exported)
+			audit.record("snapshot_exported", map[string]any{"file": name, "documents": exported})
+		}
+		return nil
+	}
+
+	// Swap in a client with refreshed credentials between batches
+	reconnect := func() error {
+		fresh, err := connect()
+		if err != nil {
+			return fmt.Errorf("refreshing MongoDB credentials: %w", err)
+		}
+		client.Disconnect(context.Background())
+		client = fresh
+		collection = client.Database(cfg.DBName).Collection(cfg.CollectionName, collectionOpts)
+		if snapshots != nil {
+			snapshots.collection = collection
+		}
+		slog.Info("Reconnected with refreshed credentials", "backend", cfg.SecretsBackend)
+		return nil
+	}
+
+	// Send a row to the rejects file
+	reject := func(record []string, rowErr error) error {
+		kind := errorKind(rowErr)
+		stats.addRejected(kind, rowErr.Error())
+		slog.Debug("row_error", "placeId", cols.get(record, "placeId"), "kind", kind, "error", rowErr)
+		return rejects.write(record, rowErr.Error())
+	}
+
+	// Write the batch to the collection, or to each document's routed one
+	write := func(ctx context.Context) (int64, error) {
+		if router != nil {
+			return router.write(ctx, client, collectionOpts, cfg.WriteMode, batch, batchTargets)
+		}
+		return writeBatch(ctx, collection, cfg.WriteMode, batch)
+	}
+
+	// Insert the batch, sending rows rejected by MongoDB to the rejects file
+	flush := func() error {
+		defer func() {
+			batchSpan.End()
+			batchSpan = nil
+		}()
+		batchSpan.SetAttributes(
+			attribute.Int("seeder.batch.rows", len(batch)),
+			attribute.Int64("seeder.batch.read_ms", readTime.Milliseconds()),
+			attribute.Int64("seeder.batch.transform_ms", transformTime.Milliseconds()),
+		)
+
+		if pacer != nil {
+			if err := pacer.wait(batchCtx, len(batch)); err != nil {
+				return err
+			}
+		}
+		if !refreshAt.IsZero() && time.Now().After(refreshAt) && !cfg.DryRun {
+			if err := reconnect(); err != nil {
+				return err
+			}
+		}
+		// In new mode only places not already stored are written, and in
+		// refresh mode only those whose row changed
+		if (cfg.WriteMode == writeModeNew || cfg.WriteMode == writeModeRefresh) && !cfg.DryRun {
+			stored, err := storedRowHashes(batchCtx, collection, batch, cfg.RowHashField)
+			if err != nil {
+				return batchError(batchFirstRow, rowNumber, err)
+			}
+			var dropped int
+			batch, batchRecords, dropped = dropStored(cfg.WriteMode, cfg.RowHashField, stored, batch, batchRecords)
+			if cfg.WriteMode == writeModeNew {
+				stats.existing.Add(int64(dropped))
+			} else {
+				stats.unchanged.Add(int64(dropped))
+			}
+		}
+		if cfg.Serverless {
+			rpu, wpu := estimateProcessingUnits(batch, indexes, cfg.WriteMode)
+			stats.estimatedRPUs.Add(rpu)
+			stats.estimatedWPUs.Add(wpu)
+		}
+
+		flushStart := time.Now()
+		insertCtx, insertSpan := tracer.Start(batchCtx, "mongo.write", trace.WithAttributes(
+			attribute.String("db.system", "mongodb"),
+			attribute.String("db.operation", cfg.WriteMode),
+			attribute.Int("db.mongodb.documents", len(batch)),
+		))
+		var err error
+		written := len(batch)
+		if cfg.DryRun {
+			err = printDryRunDocuments(batch, &dryRunPrinted, cfg.DryRunPrint)
+		} else if cfg.Transactions {
+			// Any failure aborts the whole batch, rejected documents
+			// included, so the run stops at the last checkpoint
+			var merged int
+			var unmatched int64
+			release := acquireInsertSlot()
+			err = inTransaction(insertCtx, client, func(ctx context.Context) error {
+				var err error
+				if cfg.MergeDuplicates {
+					if merged, err = markMergedDuplicates(ctx, collection, batchPlaces(batch)); err != nil {
+						return err
+					}
+				}
+				unmatched, err = write(ctx)
+				return err
+			})
+			release()
+			if err != nil {
+				insertSpan.RecordError(err)
+				insertSpan.End()
+				return batchError(batchFirstRow, rowNumber, err)
+			}
+			stats.merged.Add(int64(merged))
+			stats.unmatched.Add(unmatched)
+			written -= int(unmatched)
+		} else {
+			if cfg.MergeDuplicates {
+				merged, err := markMergedDuplicates(insertCtx, collection, batchPlaces(batch))
+				if err != nil {
+					insertSpan.RecordError(err)
+					insertSpan.End()
+					return batchError(batchFirstRow, rowNumber, err)
+				}
+				stats.merged.Add(int64(merged))
+			}
+			release := acquireInsertSlot()
+			var unmatched int64
+			unmatched, err = write(insertCtx)
+			stats.unmatched.Add(unmatched)
+			written -= int(unmatched)
+			release()
+		}
+		if err != nil {
+			insertSpan.RecordError(err)
+		}
+		insertSpan.End()
+		var rowErrs map[int]error
+		if err != nil {
+			if rowErrs, err = rejectedDocuments(err); err != nil {
+				return batchError(batchFirstRow, rowNumber, err)
+			}
+			for i, rowErr := range rowErrs {
+				if err := reject(batchRecords[i], rowErr); err != nil {
+					return err
+				}
+			}
+		}
+
+		stats.inserted.Add(int64(written - len(rowErrs)))
+		if integrity != nil {
+			if err := integrity.addChunk(batchFirstRow, rowNumber, batchRecords, batch, rowErrs); err != nil {
+				return err
+			}
+		}
+		if snapshots != nil {
+			for i, doc := range batch {
+				if _, rejected := rowErrs[i]; !rejected {
+					snapshots.add(documentPlaceID(doc))
+				}
+			}
+		}
+		slog.Info("batch_flushed",
+			"rows", len(batch),
+			"inserted", written-len(rowErrs),
+			"rejected", len(rowErrs),
+			"durationMs", time.Since(flushStart).Milliseconds())
+
+		// Update progress after successful batch insert
+		if checkpoint != "" {
+			stats.flushedRow(checkpointRow)
+			if !cfg.DryRun && !cfg.Rows.set() {
+				point := resumePoint{PlaceID: checkpoint, Row: checkpointRow, Offset: checkpointOffset}
+				// Only offsets of untransformed input point into the source
+				if file.http != nil && !file.transformed() {
+					point.Validator = file.http.validator
+				}
+				if err := updateLastProcessedPlaceID(ctx, checkpoints, cfg.outputs.progress, point); err != nil {
+					return err
+				}
+				stats.setCheckpoint(checkpoint)
+				slog.Info("checkpoint_saved", "placeId", checkpoint)
+			}
+		}
+
+		batch = batch[:0] // Clear the batch
+		batchRecords = batchRecords[:0]
+		batchTargets = batchTargets[:0]
+
+		if snapshots != nil && snapshots.due() {
+			return exportSnapshot()
+		}
+		return nil
+	}
 
 	for {
-		record, err := reader.Read()
+		// A run the server cancels stops at the next row
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if batchSpan == nil {
+			batchCtx, batchSpan = tracer.Start(ctx, "batch")
+			readTime, transformTime = 0, 0
+		}
+
+		readStart := time.Now()
+		var record []string
+		var offset int64
+		var err error
+		if len(sample) > 0 {
+			record, offset, err = sample[0].record, sample[0].offset, sample[0].err
+			sample = sample[1:]
+		} else {
+			record, err = reader.Read()
+			offset = reader.InputOffset()
+		}
+		readTime += time.Since(readStart)
+
+		// In repair mode malformed rows are rejected rather than ending the run
+		var malformed error
 		if err != nil {
-			if err.Error() == "EOF" {
+			if errors.Is(err, io.EOF) {
 				// End of file
-				go func() {
-					time.Sleep(10 * time.Millisecond)
-					fmt.Printf("\n> GOT EOF \n")
-				}()
+				slog.Debug("Reached end of file")
+				readWholeSource = true
 
 				break
 			}
-			return err
+			if !reader.tolerates(err) {
+				return err
+			}
+			malformed, err = err, nil
 		}
 
-		if !startProcessing && record[0] == lastProcessedID {
-			startProcessing = true
+		// Update progress
+		progressBar.update(baseOffset + file.sourceOffset(offset))
+		stats.rowsRead.Add(1)
+		rowNumber++
+
+		if !cfg.Rows.contains(rowNumber) {
+			if cfg.Rows.Last > 0 && rowNumber > cfg.Rows.Last {
+				slog.Debug("Reached end of row range")
+				break
+			}
+			stats.skipped.Add(1)
 			continue
 		}
 
-		if !startProcessing {
+		placeID := cols.get(record, "placeId")
+		if !cfg.sampled(rowNumber, placeID) {
+			stats.skipped.Add(1)
+			continue
+		}
+		atResumePoint := placeID == lastProcessedID
+		if resumeByRow {
+			atResumePoint = rowNumber == resume.Row
+			if atResumePoint && placeID != lastProcessedID {
+				slog.Warn("PlaceID at the checkpoint row differs, the piped input may have changed", "row", rowNumber, "placeId", placeID, "checkpoint", lastProcessedID)
+			}
+		}
+		if !startProcessing && atResumePoint {
+			startProcessing = true
+			if !retry[placeID] {
+				stats.skipped.Add(1)
+				rememberSkipped(record, malformed)
+				continue
+			}
+		} else if !startProcessing && !retry[placeID] {
+			stats.skipped.Add(1)
+			rememberSkipped(record, malformed)
 			continue
 		}
+		if startProcessing {
+			stats.processedRow(rowNumber)
+		}
 
-		// Skip non-Bangladesh locations
-		// if record[4] != "Bangladesh" {
-		// 	progressBar.Increment()
-		// 	continue
-		// }
-
-		place := Place{
-			PlaceID:               record[0],
-			Address:               record[2],
-			Version:               record[12],
-			IsAutoCompleteAddress: strings.ToLower(record[3]) == "true",
-			Types:                 parseArrayFromColumn(record[1]),
-			PlusCode:              record[8],
-			City:                  record[5],
-			Division:              record[6],
-			District:              record[7],
-			PostalCode:            record[11],
-			Sublocality:           record[13],
-			LocalArea:             record[14],
-			Location: &Location{
-				Type:        "Point",
-				Coordinates: [2]float64{parseFloat(record[10]), parseFloat(record[9])},
-			},
-
-			Suggestions: []any{},
-			Reviews:     []any{},
-			MergedAt:    nil,
-			IsMerged:    false,
-		}
-
-		batch = append(batch, place)
+		if malformed != nil {
+			if err := reject(record, &rowError{Kind: "malformed_csv", Err: malformed}); err != nil {
+				return err
+			}
+			continue
+		}
 
-		if len(batch) >= batchSize {
-			_, err := collection.InsertMany(context.Background(), batch)
+		// Skip rows from other countries, and those the WHERE expression
+		// doesn't match
+		if countries != nil && !countries.keep(record) {
+			stats.filtered.Add(1)
+			continue
+		}
+		if filter != nil {
+			keep, err := filter.keep(record)
 			if err != nil {
+				if err := reject(record, err); err != nil {
+					return err
+				}
+				continue
+			}
+			if !keep {
+				stats.filtered.Add(1)
+				continue
+			}
+		}
+
+		// Skip rows repeating an earlier row's key
+		if dedupe != nil && dedupe.duplicate(record) {
+			stats.duplicates.Add(1)
+			continue
+		}
+
+		// The _id can't be left for MongoDB to generate once ID_FIELD is set
+		var id string
+		if idColumn >= 0 {
+			if idColumn < len(record) {
+				id = strings.TrimSpace(record[idColumn])
+			}
+			if id == "" {
+				if err := reject(record, &rowError{Kind: "missing_id", Err: fmt.Errorf("%s: no value for the _id", cfg.IDField)}); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		transformStart := time.Now()
+		var doc any
+		var similar *nearMatch
+		if docSchema != nil {
+			var fields bson.D
+			fields, err = docSchema.document(record)
+			if err == nil && len(computed) > 0 {
+				var values bson.D
+				values, err = renderComputed(computed, templateData(header, cols, record))
+				fields = append(fields, values...)
+			}
+			doc = fields
+		} else {
+			place := Place{
+				PlaceID:               cols.get(record, "placeId"),
+				Address:               cols.get(record, "address"),
+				Version:               cols.get(record, "version"),
+				IsAutoCompleteAddress: strings.ToLower(cols.get(record, "isAutoCompleteAddress")) == "true",
+				Types:                 parseArrayFromColumn(cols.get(record, "types")),
+				PlusCode:              cols.get(record, "plusCode"),
+				City:                  cols.get(record, "city"),
+				Division:              cols.get(record, "division"),
+				District:              cols.get(record, "district"),
+				PostalCode:            cols.get(record, "postalCode"),
+				Sublocality:           cols.get(record, "sublocality"),
+				LocalArea:             cols.get(record, "localArea"),
+
+				Suggestions: []any{},
+				Reviews:     []any{},
+				MergedAt:    nil,
+				IsMerged:    false,
+			}
+
+			if addresses != nil {
+				place.Address = addresses.normalize(place.Address)
+			}
+			setNullFields(&place, placeNulls, cols, record)
+			place.omitFields = append(place.omitFields, unprovided...)
+			if cfg.WriteMode == writeModeUpdate && cfg.BSONOmitEmpty {
+				place.omitFields = append(place.omitFields, blankUpdateFields(cols, geo, record)...)
+			}
+			if mergedAt := cols.get(record, "mergedAt"); mergedAt != "" && place.nullFields["mergedAt"] == "" {
+				var parsed time.Time
+				parsed, err = parseDateLayout(mergedAt, mergedAtLayout)
+				if err != nil {
+					err = &rowError{Kind: "invalid_date", Err: fmt.Errorf("mergedAt: %w", err)}
+				}
+				place.MergedAt = &parsed
+			}
+			if err == nil {
+				var omitted []string
+				omitted, err = setGeoFields(&place, geo, record)
+				if len(omitted) > 0 {
+					flags := make([]string, len(omitted))
+					for i, field := range omitted {
+						flags[i] = field + ":invalid_coordinates"
+					}
+					stats.addFlagged(flags)
+				}
+			}
+			if err == nil && len(place.SwappedCoordinates) > 0 {
+				reason := ":swapped"
+				if cfg.GeoSwap == geoSwapFix {
+					reason = ":swap_fixed"
+				}
+				flags := make([]string, len(place.SwappedCoordinates))
+				for i, field := range place.SwappedCoordinates {
+					flags[i] = field + reason
+				}
+				stats.addFlagged(flags)
+			}
+			if err == nil {
+				var derived bool
+				derived, err = checkPlusCode(&place, cfg.PlusCodeCheck, cfg.PlusCodeDerive)
+				if derived {
+					stats.plusCodesDerived.Add(1)
+				}
+				if place.InvalidPlusCode {
+					stats.addFlagged([]string{"plusCode:invalid"})
+				}
+			}
+			if err == nil && cfg.GeoBBox.set() {
+				if fields := cfg.GeoBBox.outside(&place); len(fields) > 0 {
+					if cfg.GeoBBoxMode == bboxModeReject {
+						err = &rowError{Kind: "out_of_bounds", Err: fmt.Errorf("outside the bounding box: %s", strings.Join(fields, ", "))}
+					} else {
+						flags := make([]string, len(fields))
+						for i, field := range fields {
+							flags[i] = field + ":out_of_bounds"
+						}
+						stats.addFlagged(flags)
+						place.OutOfBounds = fields
+					}
+				}
+			}
+			if err == nil && len(computed) > 0 {
+				var values bson.D
+				if values, err = renderComputed(computed, templateData(header, cols, record)); err == nil {
+					if place.Extra == nil {
+						place.Extra = map[string]any{}
+					}
+					for _, value := range values {
+						place.Extra[value.Key] = value.Value
+					}
+				}
+			}
+			if err == nil && bounds != nil {
+				filled, mismatches := bounds.apply(&place)
+				stats.boundaryFilled.Add(int64(filled))
+				if len(mismatches) > 0 {
+					stats.boundaryMismatched.Add(1)
+					place.BoundaryMismatches = mismatches
+				}
+			}
+			if err == nil && garbage != nil {
+				if flags := garbage.checkPlace(&place); len(flags) > 0 {
+					stats.addFlagged(flags)
+					if cfg.GarbageFilter == garbageFilterReject {
+						err = &rowError{Kind: "garbage_text", Err: fmt.Errorf("garbage text: %s", strings.Join(flags, ", "))}
+					} else {
+						place.GarbageFlags = flags
+					}
+				}
+			}
+			if err == nil && nearDups != nil {
+				similar = nearDups.match(&place)
+			}
+			doc = &place
+		}
+		transformTime += time.Since(transformStart)
+		if err != nil {
+			if err := reject(record, err); err != nil {
 				return err
 			}
-			batch = batch[:0] // Clear the batch
+			continue
+		}
 
-			// Update progress after successful batch insert
-			updateLastProcessedPlaceID(place.PlaceID)
+		// Hold near duplicates back for review rather than inserting them
+		if similar != nil {
+			stats.nearDuplicates.Add(1)
+			if err := nearDups.write(record, similar); err != nil {
+				return err
+			}
+			continue
 		}
 
-		// Update progress
-		progressBar.Increment()
+		if id != "" && cfg.IDType == idTypeObjectID {
+			doc = setDocumentField(doc, "_id", keyObjectID(id))
+		} else if id != "" {
+			doc = setDocumentField(doc, "_id", id)
+		}
+		if cfg.RowHashField != "" {
+			doc = setDocumentField(doc, cfg.RowHashField, rowHash(record))
+		}
+		// Updates patch documents other runs wrote, so they aren't tagged
+		if cfg.TagImportID && cfg.WriteMode != writeModeUpdate {
+			doc = setDocumentField(doc, importIDField, stats.importID)
+		}
+		if provenance != nil {
+			doc = provenance.stamp(doc, cfg.CSVFile, rowNumber, stats.importID)
+		}
+
+		if len(batch) == 0 {
+			batchFirstRow = rowNumber
+		}
+		batch = append(batch, doc)
+		batchRecords = append(batchRecords, record)
+		if router != nil {
+			batchTargets = append(batchTargets, router.route(record))
+		}
+
+		// Retried rows behind the resume point must not move the checkpoint back
+		if startProcessing {
+			checkpoint = placeID
+			checkpointRow = rowNumber
+			checkpointOffset = baseOffset + file.sourceOffset(offset)
+		}
+
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Insert remaining batch
 	if len(batch) > 0 {
-		_, err := collection.InsertMany(context.Background(), batch)
-		if err != nil {
+		if err := flush(); err != nil {
 			return err
 		}
-		// Update progress after successful batch insert
-		updateLastProcessedPlaceID(batch[len(batch)-1].(Place).PlaceID)
+	} else if batchSpan != nil {
+		batchSpan.End()
 	}
 
-	progressBar.Finish()
+	if snapshots != nil {
+		if err := exportSnapshot(); err != nil {
+			return err
+		}
+	}
+
+	if !startProcessing && resumeByRow {
+		return fmt.Errorf("%w: stdin ended before row %d from %s", ErrResumePointNotFound, resume.Row, cfg.outputs.progress)
+	}
+	if !startProcessing {
+		return fmt.Errorf("%w: PlaceID %s from %s", ErrResumePointNotFound, lastProcessedID, cfg.outputs.progress)
+	}
+
+	if rejects.count > 0 {
+		slog.Warn("Rows rejected", "rows", rejects.count, "file", cfg.outputs.rejects)
+	}
+	if nearDups != nil && nearDups.count > 0 {
+		slog.Warn("Near duplicates held back for review", "rows", nearDups.count, "file", nearDups.file.name)
+	}
+
+	progressBar.finish()
+
+	if router != nil {
+		for _, target := range router.targets() {
+			slog.Info("Rows routed", "collection", target.String(), "rows", router.counts[target])
+		}
+	}
+
+	snapshot := stats.snapshot()
+	slog.Info("run_complete",
+		"rowsRead", snapshot.RowsRead,
+		"inserted", snapshot.Inserted,
+		"rejected", snapshot.Rejected,
+		"filtered", snapshot.Filtered,
+		"duplicates", snapshot.Duplicates,
+		"existing", snapshot.Existing,
+		"unchanged", snapshot.Unchanged,
+		"unmatched", snapshot.Unmatched,
+		"elapsedSeconds", snapshot.ElapsedSeconds,
+		"checkpoint", snapshot.Checkpoint)
 	return nil
 }
 
-// Helper function to parse float from string
-func parseFloat(val string) float64 {
-	parsedVal, err := strconv.ParseFloat(val, 64)
-	if err != nil {
-		return 0.0
+// resumePoint is what the progress file records about the last flushed
+// batch. The first line is the PlaceID, which is all older progress files
+// hold; the row number, then the byte offset just past that row and the
+// source's validator, follow as key=value lines, so stdin can resume by row
+// count and HTTP sources with a Range request.
+type resumePoint struct {
+	PlaceID   string
+	Row       int64
+	Offset    int64
+	Validator string
+}
+
+// Get the last processed PlaceID from the named progress file
+func getLastProcessedPlaceID(ctx context.Context, checkpoints checkpointStore, name string) (resumePoint, error) {
+	var point resumePoint
+	data, err := checkpoints.load(ctx, name)
+	if err != nil || data == nil {
+		return point, err // No checkpoint, start from the beginning
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	point.PlaceID = strings.TrimSpace(lines[0])
+	for _, line := range lines[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch key {
+		case "row":
+			point.Row, _ = strconv.ParseInt(value, 10, 64)
+		case "offset":
+			point.Offset, _ = strconv.ParseInt(value, 10, 64)
+		case "validator":
+			point.Validator = value
+		}
 	}
-	return parsedVal
+	return point, nil
 }
 
-// Get the last processed PlaceID from file
-func getLastProcessedPlaceID() (string, error) {
-	data, err := os.ReadFile(progressFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return "", nil // File doesn't exist, start from the beginning
+// Update the last processed PlaceID in the named progress file
+func updateLastProcessedPlaceID(ctx context.Context, checkpoints checkpointStore, name string, point resumePoint) error {
+	data := point.PlaceID
+	if point.Row > 0 {
+		data += fmt.Sprintf("\nrow=%d", point.Row)
+	}
+	if point.Validator != "" {
+		data += fmt.Sprintf("\noffset=%d\nvalidator=%s", point.Offset, point.Validator)
+	}
+	if err := checkpoints.save(ctx, name, []byte(data)); err != nil {
+		return fmt.Errorf("%w: writing %s at PlaceID %s: %w", ErrCheckpoint, name, point.PlaceID, err)
+	}
+	return nil
+}
+
+// Seed the inputs into a target, in turn or several at once, each resuming
+// from its own checkpoint. Failures are logged as they happen.
+func seedInputs(cfg Config, inputs []string) error {
+	if cfg.ParallelFiles > 1 && len(inputs) > 1 {
+		if err := runParallel(cfg, inputs); err != nil {
+			slog.Error("Error processing CSV files", "error", err)
+			return err
+		}
+		return nil
+	}
+	for i, source := range inputs {
+		run := cfg.forSource(source, outputPrefix(source))
+		if len(inputs) > 1 {
+			slog.Info("Processing file", "file", source, "number", i+1, "of", len(inputs))
+		}
+
+		if err := processCSV(run); err != nil {
+			slog.Error(failureMessage(err), "error", err, "file", source, "progressFile", run.outputs.progress)
+			return fmt.Errorf("%s: %w", source, err)
 		}
-		return "", err
 	}
-	return strings.TrimSpace(string(data)), nil
+	return nil
 }
 
-// Update the last processed PlaceID to file
-func updateLastProcessedPlaceID(placeID string) {
-	err := os.WriteFile(progressFile, []byte(placeID), 0644)
-	if err != nil {
-		log.Printf("Error updating progress file: %v", err)
+// Message logged for a failed run, with a hint when the progress file is
+// to blame
+func failureMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrResumePointNotFound):
+		return "Error processing CSV, remove the progress file to start from the beginning"
+	case errors.Is(err, ErrCheckpoint):
+		return "Error processing CSV, the progress file may be stale"
 	}
+	return "Error processing CSV"
 }
 
 func main() {
 
-	if err := godotenv.Load(".env"); err != nil {
-		log.Fatalf("Error loading .env file")
+	// Subcommands that don't seed
+	if len(os.Args) > 1 && os.Args[1] == "merge" {
+		if err := runMerge(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fatal("Error merging summaries", "error", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		if err := runReconcile(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fatal("Error reconciling targets", "error", err)
+		}
+		return
+	}
+
+	args := os.Args[1:]
+	validate := len(args) > 0 && args[0] == "validate"
+	remove := len(args) > 0 && args[0] == "delete"
+	undo := len(args) > 0 && args[0] == "undo"
+	serve := len(args) > 0 && args[0] == "serve"
+	if validate || remove || undo || serve {
+		args = args[1:]
+	}
+	var undoImportID string
+	if undo {
+		if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+			fatal("Usage: undo <importId> [flags]")
+		}
+		undoImportID, args = args[0], args[1:]
+	}
+
+	if err := loadEnvFile(args); err != nil {
+		fatal("Error loading env file", "error", err)
+	}
+	if err := loadSecretFiles(); err != nil {
+		fatal("Error reading secret files", "error", err)
 	}
 
 	// Get values from environment variables
-	csvFile := os.Getenv("CSV_FILE")
-	if csvFile == "" {
-		log.Fatalf("CSV_FILE environment variable not set")
+	cfg, err := loadConfig(args, serve)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fatal(err.Error())
 	}
-	mongoURI := os.Getenv("MONGO_URI")
-	if mongoURI == "" {
-		log.Fatalf("MONGO_URI environment variable not set")
+	targets, err := seedTargets(cfg)
+	if err != nil {
+		fatal(err.Error())
 	}
-	dbName := os.Getenv("DB_NAME")
-	if dbName == "" {
-		log.Fatalf("DB_NAME environment variable not set")
+	postImport, err := loadPostImport(cfg.PostImportFile)
+	if err != nil {
+		fatal("Error loading post-import steps", "error", err)
 	}
-	collectionName := os.Getenv("COLLECTION_NAME")
-	if collectionName == "" {
-		log.Fatalf("COLLECTION_NAME environment variable not set")
+	logFile, err := setupLogging(cfg)
+	if err != nil {
+		fatal("Error setting up logging", "error", err)
+	}
+	defer logFile.Close()
+
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		fatal("Error setting up tracing", "error", err)
 	}
+	defer shutdownTracing(context.Background())
 
-	progressFile = strings.Split(csvFile, ".")[0] + progressFile
+	// Writes to a production cluster need confirming; validate only reads
+	if !validate {
+		action := "seed"
+		switch {
+		case undo:
+			action = "undo an import in"
+		case remove:
+			action = "delete from"
+		}
+		for _, target := range targets {
+			if err := confirmProduction(target, action); err != nil {
+				fatal("Production run not confirmed", "error", err, "target", target.target)
+			}
+		}
+	}
+
+	if undo {
+		for _, target := range targets {
+			if err := runUndo(target, undoImportID); err != nil {
+				fatal("Error undoing run", "error", err, "importId", undoImportID, "target", target.target)
+			}
+		}
+		return
+	}
+
+	var inputs []string
+	if cfg.Watch != "" && validate {
+		fatal("validate doesn't take a watched directory, validate its files by CSV_FILE")
+	}
+	if cfg.Watch != "" && remove {
+		fatal("delete doesn't take a watched directory, give the ID lists by CSV_FILE")
+	}
+	if cfg.Watch == "" && !serve {
+		if inputs, err = expandInputs(cfg.CSVFile); err != nil {
+			fatal(err.Error())
+		}
+	}
 
-	// Handle interruption signals
+	if validate {
+		for _, target := range targets {
+			for _, source := range inputs {
+				if err := runValidate(target.forSource(source, outputPrefix(source))); err != nil {
+					fatal("Validation failed", "error", err, "file", source, "target", target.target)
+				}
+			}
+		}
+		return
+	}
+
+	if err := setupBSONRegistry(cfg); err != nil {
+		fatal("Error setting up BSON codecs", "error", err)
+	}
+
+	if remove {
+		for _, target := range targets {
+			for _, source := range inputs {
+				run := target.forSource(source, outputPrefix(source))
+				if err := runDelete(run); err != nil {
+					fatal("Error deleting documents", "error", err, "file", source, "progressFile", run.outputs.deleteProgress)
+				}
+			}
+		}
+		return
+	}
+
+	// Handle interruption signals, failing the run in progress
 	go func() {
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 		<-sigChan
-		fmt.Printf("\nInterrupt received, stopping...\n")
+		slog.Warn("Interrupt received, stopping...")
+		if runFailed := interruptedRun.Load(); runFailed != nil {
+			(*runFailed)(errors.New("interrupted"))
+		}
 		os.Exit(1)
 	}()
 
-	err := processCSV(csvFile, mongoURI, dbName, collectionName)
-	if err != nil {
-		log.Fatalf("Error processing CSV: %v", err)
+	// The server and scheduled runs keep going until interrupted
+	if serve {
+		if err := runServe(cfg, targets, postImport); err != nil {
+			fatal("Error serving imports", "error", err, "addr", cfg.ServeAddr)
+		}
+		return
 	}
+	if cfg.Schedule != "" {
+		if err := runSchedule(cfg, targets, postImport); err != nil {
+			fatal("Error scheduling runs", "error", err)
+		}
+		return
+	}
+
+	if err := seedRun(cfg, targets, inputs, postImport); err != nil {
+		shutdownTracing(context.Background())
+		logFile.Close()
+		os.Exit(1)
+	}
+
+	if cfg.DryRun {
+		slog.Info("Dry run complete, nothing was written to MongoDB")
+		return
+	}
+	slog.Info("CSV data inserted successfully!")
+}
 
-	fmt.Println("CSV data inserted successfully!")
+// Called when interrupted during a run, to run its failure hook and send
+// its notifications
+var interruptedRun atomic.Pointer[func(error)]
+
+// Seed the inputs into each target, or watch for them, running the hooks
+// before seeding and after it succeeds or fails, when notifications are
+// sent too. Failures are logged as they happen.
+func seedRun(cfg Config, targets []Config, inputs []string, postImport []postImportStep) error {
+	startedAt := time.Now()
+	var summaries []string
+	for _, target := range targets {
+		for _, source := range inputs {
+			summaries = append(summaries, target.forSource(source, outputPrefix(source)).outputs.summary)
+		}
+	}
+	if err := runHook("pre", cfg.HookPre, hookEnv(cfg, "started", startedAt, nil, summaries)); err != nil {
+		slog.Error("Error running hook", "error", err)
+		return err
+	}
+	runFailed := func(runErr error) {
+		if err := runHook("failure", cfg.HookFailure, hookEnv(cfg, "failed", startedAt, runErr, summaries)); err != nil {
+			slog.Error("Error running hook", "error", err)
+		}
+		notifyRun(cfg, newRunNotification(cfg, startedAt, runErr, summaries))
+	}
+	interruptedRun.Store(&runFailed)
+	defer interruptedRun.Store(nil)
+
+	// Start from an empty collection, once for all the inputs
+	if cfg.Recreate || cfg.Truncate {
+		for _, target := range targets {
+			if err := emptyCollection(target); err != nil {
+				runFailed(err)
+				slog.Error("Error emptying the collection", "error", err, "target", target.target)
+				return err
+			}
+		}
+	}
+
+	// Watch mode runs until interrupted
+	if cfg.Watch != "" {
+		err := runWatch(cfg, postImport)
+		if err != nil {
+			runFailed(err)
+			slog.Error("Error watching directory", "error", err, "dir", cfg.Watch)
+		}
+		return err
+	}
+
+	// Each target is seeded in turn, one failing not stopping the rest
+	var failed []string
+	var errs []error
+	for i, target := range targets {
+		if target.target != "" {
+			slog.Info("Seeding target", "target", target.target, "database", target.DBName, "number", i+1, "of", len(targets))
+		}
+		err := seedInputs(target, inputs)
+		if err == nil {
+			if err = runPostImport(target, postImport); err != nil {
+				slog.Error("Error running post-import steps", "error", err, "target", target.target)
+			}
+		}
+		if err != nil {
+			if target.target == "" {
+				runFailed(err)
+				return err
+			}
+			slog.Error("Error seeding target", "target", target.target, "error", err)
+			failed = append(failed, target.target)
+			errs = append(errs, fmt.Errorf("%s: %w", target.target, err))
+		}
+	}
+	if len(failed) > 0 {
+		err := errors.Join(errs...)
+		runFailed(err)
+		slog.Error("Error seeding targets", "failed", strings.Join(failed, ","), "of", len(targets))
+		return err
+	}
+
+	if err := runHook("success", cfg.HookSuccess, hookEnv(cfg, "completed", startedAt, nil, summaries)); err != nil {
+		runFailed(err)
+		slog.Error("Error running hook", "error", err)
+		return err
+	}
+	notifyRun(cfg, newRunNotification(cfg, startedAt, nil, summaries))
+	return nil
 }
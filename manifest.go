@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Collection the integrity manifests are written to, in the target database
+const manifestCollection = "_seeder_manifests"
+
+// manifestChunk is one flushed batch: the data rows it spans, a hash of
+// those rows as read and one of the documents stored from them
+type manifestChunk struct {
+	FirstRow        int64  `bson:"firstRow"`
+	LastRow         int64  `bson:"lastRow"`
+	Rows            int    `bson:"rows"`
+	Inserted        int    `bson:"inserted"`
+	RowsSHA256      string `bson:"rowsSha256"`
+	DocumentsSHA256 string `bson:"documentsSha256"`
+}
+
+// manifest records what a run read and wrote, for later audits. The source
+// hash covers every byte of the source and is only set when all of it was
+// read.
+type manifest struct {
+	ImportID     string          `bson:"importId"`
+	CSVFile      string          `bson:"csvFile"`
+	Database     string          `bson:"database"`
+	Collection   string          `bson:"collection"`
+	Status       string          `bson:"status"`
+	Error        string          `bson:"error,omitempty"`
+	StartedAt    time.Time       `bson:"startedAt"`
+	FinishedAt   time.Time       `bson:"finishedAt"`
+	SourceSHA256 string          `bson:"sourceSha256,omitempty"`
+	Inserted     int64           `bson:"inserted"`
+	Chunks       []manifestChunk `bson:"chunks"`
+}
+
+func newManifest(cfg Config, stats *runStats) *manifest {
+	return &manifest{
+		ImportID:   stats.importID,
+		CSVFile:    cfg.CSVFile,
+		Database:   cfg.DBName,
+		Collection: cfg.CollectionName,
+		StartedAt:  stats.startedAt,
+		Chunks:     []manifestChunk{},
+	}
+}
+
+// Record a flushed batch, rejected holding the positions of documents
+// MongoDB refused
+func (m *manifest) addChunk(firstRow, lastRow int64, records [][]string, batch []any, rejected map[int]error) error {
+	rows := sha256.New()
+	w := csv.NewWriter(rows)
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+
+	docs := sha256.New()
+	inserted := 0
+	for i, doc := range batch {
+		if _, ok := rejected[i]; ok {
+			continue
+		}
+		data, err := bson.MarshalWithRegistry(bsonRegistry, doc)
+		if err != nil {
+			return err
+		}
+		docs.Write(data)
+		inserted++
+	}
+
+	m.Inserted += int64(inserted)
+	m.Chunks = append(m.Chunks, manifestChunk{
+		FirstRow:        firstRow,
+		LastRow:         lastRow,
+		Rows:            len(records),
+		Inserted:        inserted,
+		RowsSHA256:      hex.EncodeToString(rows.Sum(nil)),
+		DocumentsSHA256: hex.EncodeToString(docs.Sum(nil)),
+	})
+	return w.Error()
+}
+
+// Write the manifest, with how the run ended
+func (m *manifest) write(ctx context.Context, db *mongo.Database, sourceSHA256 string, runErr error) error {
+	m.Status = "completed"
+	if runErr != nil {
+		m.Status = "failed"
+		m.Error = runErr.Error()
+	}
+	m.FinishedAt = time.Now()
+	m.SourceSHA256 = sourceSHA256
+	_, err := db.Collection(manifestCollection).InsertOne(ctx, m)
+	return err
+}
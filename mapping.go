@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Column position of each Place field in the standard location export
+var defaultColumns = map[string]int{
+	"placeId":               0,
+	"types":                 1,
+	"address":               2,
+	"isAutoCompleteAddress": 3,
+	"country":               4,
+	"city":                  5,
+	"division":              6,
+	"district":              7,
+	"plusCode":              8,
+	"latitude":              9,
+	"longitude":             10,
+	"postalCode":            11,
+	"version":               12,
+	"sublocality":           13,
+	"localArea":             14,
+}
+
+// Mapping describes how CSV columns become document fields. Columns are
+// addressed by header name, duplicates by their disambiguated name (e.g.
+// "name_2"). A flat {"field": "column"} object is accepted as Fields.
+type Mapping struct {
+	// Expected header, in order, enforced in strict schema mode
+	Columns []string `json:"columns"`
+
+	// Place field -> CSV column name
+	Fields map[string]string `json:"fields"`
+
+	// GeoJSON point fields, defaults to "location" from the latitude and
+	// longitude columns
+	Geo []GeoField `json:"geo"`
+
+	// CSV column name -> BSON type. Declaring types writes generic
+	// documents, one field per column, instead of a Place.
+	Types map[string]columnType `json:"types"`
+
+	// Cell values stored as null or omitted instead of as strings
+	Nulls NullTokens `json:"nulls"`
+
+	// CSV column name -> date layout (rfc3339, unix, unixms or a Go layout)
+	// for date columns: mergedAt, or date columns of generic documents
+	Dates map[string]string `json:"dates"`
+
+	// Field name -> Go template rendering it from the row's columns, e.g.
+	// "{{.address}}, {{.city}}, {{.division}}"
+	Computed map[string]string `json:"computed"`
+}
+
+func (m *Mapping) UnmarshalJSON(data []byte) error {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+
+	_, hasColumns := keys["columns"]
+	_, hasFields := keys["fields"]
+	_, hasGeo := keys["geo"]
+	_, hasTypes := keys["types"]
+	_, hasNulls := keys["nulls"]
+	_, hasDates := keys["dates"]
+	_, hasComputed := keys["computed"]
+	if !hasColumns && !hasFields && !hasGeo && !hasTypes && !hasNulls && !hasDates && !hasComputed {
+		return json.Unmarshal(data, &m.Fields)
+	}
+
+	type mapping Mapping // Without the UnmarshalJSON method
+	return json.Unmarshal(data, (*mapping)(m))
+}
+
+// Load a mapping file, an empty path means the default mapping
+func loadMapping(path string) (Mapping, error) {
+	var mapping Mapping
+	if path == "" {
+		return mapping, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return mapping, err
+	}
+
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return mapping, fmt.Errorf("parsing mapping file %s: %w", path, err)
+	}
+	for column, t := range mapping.Types {
+		if err := t.validate(); err != nil {
+			return mapping, fmt.Errorf("mapping file %s: column %q: %w", path, column, err)
+		}
+	}
+	if err := mapping.Nulls.validate(); err != nil {
+		return mapping, fmt.Errorf("mapping file %s: %w", path, err)
+	}
+	return mapping, nil
+}
+
+// Place fields read from the CSV only when mapped to a column
+var optionalColumns = map[string]bool{
+	"mergedAt": true,
+}
+
+// columns resolves Place fields to record positions
+type columns map[string]int
+
+// Resolve the mapping against the header, falling back to the default
+// positions for unmapped fields
+func (m Mapping) resolve(header *Header) (columns, error) {
+	cols := columns{}
+	for field, i := range defaultColumns {
+		cols[field] = i
+	}
+
+	for field, name := range m.Fields {
+		if _, known := defaultColumns[field]; !known && !optionalColumns[field] {
+			return nil, fmt.Errorf("mapping for unknown field %q", field)
+		}
+		i, ok := header.Index(name)
+		if !ok {
+			return nil, fmt.Errorf("mapping for %q: column %q not found in header", field, name)
+		}
+		cols[field] = i
+	}
+	return cols, nil
+}
+
+// Narrow the columns to those a correction file provides, for updates:
+// fields mapped to a column or named by one, found by name rather than at
+// their default positions. placeId keeps its default position when no
+// column is named after it, as updates and resume key on it.
+func (c columns) provided(header *Header, m Mapping) {
+	for field := range c {
+		if _, mapped := m.Fields[field]; mapped {
+			continue
+		}
+		if i, ok := header.Index(field); ok {
+			c[field] = i
+		} else if field != "placeId" {
+			delete(c, field)
+		}
+	}
+}
+
+// Place fields read from the CSV that have no column, with location when no
+// geo column builds it, left out of updates rather than set empty
+func (c columns) unprovided(geo []geoColumn) []string {
+	var fields []string
+	for field := range placeFields {
+		_, known := defaultColumns[field]
+		if _, ok := c[field]; (known || optionalColumns[field]) && !ok {
+			fields = append(fields, field)
+		}
+	}
+	if !slices.ContainsFunc(geo, func(g geoColumn) bool { return g.Field == "location" }) {
+		fields = append(fields, "location")
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// Get the value of a field from a record, empty if the record is too short
+func (c columns) get(record []string, field string) string {
+	i, ok := c[field]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shardRecord is one merged run summary
+type shardRecord struct {
+	File       string   `json:"file"`
+	CSVFile    string   `json:"csvFile"`
+	Status     string   `json:"status"`
+	Rows       rowRange `json:"rows"` // Rows flushed by the run
+	Checkpoint string   `json:"checkpoint"`
+}
+
+// fileRowRange is a gap or overlap in the rows of one CSV file
+type fileRowRange struct {
+	CSVFile string `json:"csvFile"`
+	rowRange
+}
+
+// rowCounts is the expected number of data rows of each CSV file, given to
+// merge as -rows N for every file or -rows file=N for one
+type rowCounts map[string]int64
+
+func (c rowCounts) String() string {
+	return ""
+}
+
+func (c rowCounts) Set(value string) error {
+	file, count := "", value
+	if i := strings.LastIndex(value, "="); i >= 0 {
+		file, count = value[:i], value[i+1:]
+	}
+	n, err := strconv.ParseInt(count, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("rows %q must be N or file=N", value)
+	}
+	c[file] = n
+	return nil
+}
+
+// The rows expected of the file, 0 if unknown
+func (c rowCounts) of(file string) int64 {
+	if n, ok := c[file]; ok {
+		return n
+	}
+	return c[""]
+}
+
+// completionRecord consolidates the summaries of sharded or multi-machine runs
+type completionRecord struct {
+	Complete        bool             `json:"complete"`
+	MergedAt        time.Time        `json:"mergedAt"`
+	CSVFiles        []string         `json:"csvFiles"`
+	Shards          []shardRecord    `json:"shards"`
+	Gaps            []fileRowRange   `json:"gaps"`
+	Overlaps        []fileRowRange   `json:"overlaps"`
+	Failed          []string         `json:"failed"`
+	StartedAt       time.Time        `json:"startedAt"`
+	FinishedAt      time.Time        `json:"finishedAt"`
+	DurationSeconds float64          `json:"durationSeconds"`
+	RowsRead        int64            `json:"rowsRead"`
+	Inserted        int64            `json:"inserted"`
+	Skipped         int64            `json:"skipped"`
+	Filtered        int64            `json:"filtered"`
+	Duplicates      int64            `json:"duplicates"`
+	Existing        int64            `json:"existing"`
+	Unchanged       int64            `json:"unchanged"`
+	Unmatched       int64            `json:"unmatched"`
+	Rejected        int64            `json:"rejected"`
+	ErrorsByType    map[string]int64 `json:"errorsByType"`
+}
+
+// The merge subcommand: consolidate run summaries into one completion record
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	output := fs.String("o", "", "write the completion record to this file as well as stdout")
+	totalRows := rowCounts{}
+	fs.Var(totalRows, "rows", "expected number of data rows, N for every CSV file or file=N for one, to detect a missing tail (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s merge [-o file] [-rows [file=]N]... summary.json...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no summary files given")
+	}
+
+	summaries := make([]runSummary, 0, fs.NArg())
+	files := make([]string, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var summary runSummary
+		if err := json.Unmarshal(data, &summary); err != nil {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+		summaries = append(summaries, summary)
+		files = append(files, path)
+	}
+
+	record := mergeSummaries(files, summaries, totalRows)
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	os.Stdout.Write(data)
+	if *output != "" {
+		if err := os.WriteFile(*output, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	if !record.Complete {
+		return fmt.Errorf("dataset incomplete: %d gaps, %d overlaps", len(record.Gaps), len(record.Overlaps))
+	}
+	return nil
+}
+
+// Merge summaries, detecting gaps and overlaps between the row ranges of
+// those of each CSV file
+func mergeSummaries(files []string, summaries []runSummary, totalRows rowCounts) completionRecord {
+	record := completionRecord{
+		MergedAt:     time.Now(),
+		Gaps:         []fileRowRange{},
+		Overlaps:     []fileRowRange{},
+		Failed:       []string{},
+		ErrorsByType: map[string]int64{},
+	}
+
+	csvFiles := map[string]bool{}
+	for i, summary := range summaries {
+		record.Shards = append(record.Shards, shardRecord{
+			File:       files[i],
+			CSVFile:    summary.CSVFile,
+			Status:     summary.Status,
+			Rows:       rowRange{First: summary.FirstRow, Last: summary.LastRow},
+			Checkpoint: summary.Checkpoint,
+		})
+		if summary.Status != "completed" {
+			record.Failed = append(record.Failed, files[i])
+		}
+		if !csvFiles[summary.CSVFile] {
+			csvFiles[summary.CSVFile] = true
+			record.CSVFiles = append(record.CSVFiles, summary.CSVFile)
+		}
+
+		if record.StartedAt.IsZero() || summary.StartedAt.Before(record.StartedAt) {
+			record.StartedAt = summary.StartedAt
+		}
+		if summary.FinishedAt.After(record.FinishedAt) {
+			record.FinishedAt = summary.FinishedAt
+		}
+		record.RowsRead += summary.RowsRead
+		record.Inserted += summary.Inserted
+		record.Skipped += summary.Skipped
+		record.Filtered += summary.Filtered
+		record.Duplicates += summary.Duplicates
+		record.Existing += summary.Existing
+		record.Unchanged += summary.Unchanged
+		record.Unmatched += summary.Unmatched
+		record.Rejected += summary.Rejected
+		for kind, n := range summary.ErrorsByType {
+			record.ErrorsByType[kind] += n
+		}
+	}
+	record.DurationSeconds = record.FinishedAt.Sub(record.StartedAt).Seconds()
+
+	// Walk each file's shards in row order; shards that processed nothing
+	// have no range
+	for _, csvFile := range record.CSVFiles {
+		var ranges []rowRange
+		for _, shard := range record.Shards {
+			if shard.CSVFile == csvFile && shard.Rows.First > 0 && shard.Rows.Last >= shard.Rows.First {
+				ranges = append(ranges, shard.Rows)
+			}
+		}
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i].First < ranges[j].First })
+
+		covered := int64(0) // Last row covered so far
+		for _, r := range ranges {
+			if r.First > covered+1 {
+				record.Gaps = append(record.Gaps, fileRowRange{csvFile, rowRange{First: covered + 1, Last: r.First - 1}})
+			}
+			if r.First <= covered {
+				record.Overlaps = append(record.Overlaps, fileRowRange{csvFile, rowRange{First: r.First, Last: min(r.Last, covered)}})
+			}
+			covered = max(covered, r.Last)
+		}
+		if total := totalRows.of(csvFile); total > covered {
+			record.Gaps = append(record.Gaps, fileRowRange{csvFile, rowRange{First: covered + 1, Last: total}})
+		}
+	}
+
+	// A failed shard only covers the rows it flushed, so a resumed run can
+	// complete its range
+	record.Complete = len(record.Gaps) == 0 && len(record.Overlaps) == 0
+	return record
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeSummaries(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	shard := func(csvFile, status string, first, last int64) runSummary {
+		rows := int64(0)
+		if first > 0 {
+			rows = last - first + 1
+		}
+		return runSummary{
+			CSVFile:      csvFile,
+			Status:       status,
+			StartedAt:    start.Add(time.Duration(first) * time.Second),
+			FinishedAt:   start.Add(time.Duration(last) * time.Second),
+			FirstRow:     first,
+			LastRow:      last,
+			RowsRead:     rows,
+			Inserted:     rows,
+			ErrorsByType: map[string]int64{"invalid_geo": 1},
+		}
+	}
+	tests := []struct {
+		name      string
+		summaries []runSummary
+		totalRows rowCounts
+		gaps      []fileRowRange
+		overlaps  []fileRowRange
+		failed    []string
+		complete  bool
+	}{
+		{
+			name:      "contiguous",
+			summaries: []runSummary{shard("a.csv", "completed", 1, 100), shard("a.csv", "completed", 101, 200)},
+			totalRows: rowCounts{"": 200},
+			complete:  true,
+		},
+		{
+			name:      "out of order",
+			summaries: []runSummary{shard("a.csv", "completed", 101, 200), shard("a.csv", "completed", 1, 100)},
+			complete:  true,
+		},
+		{
+			name:      "gap",
+			summaries: []runSummary{shard("a.csv", "completed", 1, 100), shard("a.csv", "completed", 151, 200)},
+			gaps:      []fileRowRange{{"a.csv", rowRange{First: 101, Last: 150}}},
+		},
+		{
+			name:      "missing start",
+			summaries: []runSummary{shard("a.csv", "completed", 51, 100)},
+			gaps:      []fileRowRange{{"a.csv", rowRange{First: 1, Last: 50}}},
+		},
+		{
+			name:      "missing end",
+			summaries: []runSummary{shard("a.csv", "completed", 1, 100)},
+			totalRows: rowCounts{"": 120},
+			gaps:      []fileRowRange{{"a.csv", rowRange{First: 101, Last: 120}}},
+		},
+		{
+			name:      "overlap",
+			summaries: []runSummary{shard("a.csv", "completed", 1, 100), shard("a.csv", "completed", 91, 200)},
+			overlaps:  []fileRowRange{{"a.csv", rowRange{First: 91, Last: 100}}},
+		},
+		{
+			name:      "contained",
+			summaries: []runSummary{shard("a.csv", "completed", 1, 200), shard("a.csv", "completed", 50, 60)},
+			overlaps:  []fileRowRange{{"a.csv", rowRange{First: 50, Last: 60}}},
+		},
+		{
+			name:      "files apart",
+			summaries: []runSummary{shard("a.csv", "completed", 1, 100), shard("b.csv", "completed", 1, 50)},
+			totalRows: rowCounts{"a.csv": 100, "b.csv": 80},
+			gaps:      []fileRowRange{{"b.csv", rowRange{First: 51, Last: 80}}},
+		},
+		{
+			// A failed shard covers what it flushed, and doesn't itself make
+			// the dataset incomplete
+			name:      "failed shard",
+			summaries: []runSummary{shard("a.csv", "completed", 1, 100), shard("a.csv", "failed", 101, 150)},
+			totalRows: rowCounts{"": 150},
+			failed:    []string{"shard1.json"},
+			complete:  true,
+		},
+		{
+			name:      "empty shard",
+			summaries: []runSummary{shard("a.csv", "completed", 1, 100), shard("a.csv", "completed", 0, 0)},
+			complete:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files []string
+			for i := range tt.summaries {
+				files = append(files, fmt.Sprintf("shard%d.json", i))
+			}
+			record := mergeSummaries(files, tt.summaries, tt.totalRows)
+
+			if !reflect.DeepEqual(record.Gaps, append([]fileRowRange{}, tt.gaps...)) {
+				t.Errorf("gaps = %v, want %v", record.Gaps, tt.gaps)
+			}
+			if !reflect.DeepEqual(record.Overlaps, append([]fileRowRange{}, tt.overlaps...)) {
+				t.Errorf("overlaps = %v, want %v", record.Overlaps, tt.overlaps)
+			}
+			if !reflect.DeepEqual(record.Failed, append([]string{}, tt.failed...)) {
+				t.Errorf("failed = %v, want %v", record.Failed, tt.failed)
+			}
+			if record.Complete != tt.complete {
+				t.Errorf("complete = %v, want %v", record.Complete, tt.complete)
+			}
+			if len(record.Shards) != len(tt.summaries) {
+				t.Errorf("%d shards, want %d", len(record.Shards), len(tt.summaries))
+			}
+
+			var rows int64
+			for _, summary := range tt.summaries {
+				rows += summary.RowsRead
+			}
+			if record.RowsRead != rows || record.Inserted != rows {
+				t.Errorf("rowsRead %d, inserted %d, want %d", record.RowsRead, record.Inserted, rows)
+			}
+			if got := record.ErrorsByType["invalid_geo"]; got != int64(len(tt.summaries)) {
+				t.Errorf("invalid_geo errors = %d, want %d", got, len(tt.summaries))
+			}
+		})
+	}
+}
+
+func TestMergeSummariesTimes(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	summaries := []runSummary{
+		{CSVFile: "a.csv", Status: "completed", StartedAt: start.Add(time.Minute), FinishedAt: start.Add(5 * time.Minute), FirstRow: 101, LastRow: 200},
+		{CSVFile: "a.csv", Status: "completed", StartedAt: start, FinishedAt: start.Add(3 * time.Minute), FirstRow: 1, LastRow: 100},
+		{CSVFile: "b.csv", Status: "completed", StartedAt: start.Add(2 * time.Minute), FinishedAt: start.Add(4 * time.Minute), FirstRow: 1, LastRow: 10},
+	}
+	record := mergeSummaries([]string{"1.json", "2.json", "3.json"}, summaries, rowCounts{})
+	if !record.StartedAt.Equal(start) || !record.FinishedAt.Equal(start.Add(5*time.Minute)) {
+		t.Errorf("ran %v to %v, want %v to %v", record.StartedAt, record.FinishedAt, start, start.Add(5*time.Minute))
+	}
+	if record.DurationSeconds != 300 {
+		t.Errorf("durationSeconds = %v, want 300", record.DurationSeconds)
+	}
+	if want := []string{"a.csv", "b.csv"}; !reflect.DeepEqual(record.CSVFiles, want) {
+		t.Errorf("csvFiles = %v, want %v", record.CSVFiles, want)
+	}
+}
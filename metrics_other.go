@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// SIGUSR2 doesn't exist on this platform
+func dumpStatsOnSignal(stats *runStats) (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Dump the current stats as JSON to stderr on every SIGUSR2 until stop is
+// called. Processing carries on undisturbed.
+func dumpStatsOnSignal(stats *runStats) (stop func()) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR2)
+
+	done := make(chan struct{})
+	go func() {
+		encoder := json.NewEncoder(os.Stderr)
+		for {
+			select {
+			case <-sigChan:
+				encoder.Encode(stats.snapshot())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigChan)
+		close(done)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// mapping is a read-only memory mapping of a whole file
+type mapping []byte
+
+// Memory-mapped reads are only implemented on unix platforms
+func mmapFile(file *os.File, size int64) (mapping, error) {
+	return nil, errors.New("not supported on this platform")
+}
+
+func (mapping) Close() error { return nil }
@@ -0,0 +1,34 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapping is a read-only memory mapping of a whole file
+type mapping []byte
+
+// Map the whole file into memory, hinting the kernel that it is read sequentially
+func mmapFile(file *os.File, size int64) (mapping, error) {
+	if size == 0 {
+		return mapping{}, nil
+	}
+
+	data, err := unix.Mmap(int(file.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	_ = unix.Madvise(data, unix.MADV_SEQUENTIAL)
+
+	return mapping(data), nil
+}
+
+func (m mapping) Close() error {
+	if len(m) == 0 {
+		return nil
+	}
+	return unix.Munmap(m)
+}
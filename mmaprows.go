@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+)
+
+// mappedRows reads CSV records straight out of a memory-mapped file,
+// finding record boundaries and splitting fields in the mapping itself
+// rather than copying it through a bufio.Reader. Quoting follows the csv
+// package's rules, records it would reject or treat specially being handed
+// to it on their own, so errors read the same as with buffered reads.
+type mappedRows struct {
+	data   []byte
+	start  int // Offset of the data past any BOM
+	offset int // Offset of the next record
+	comma  string
+	quote  byte
+	lazy   bool
+
+	// Fields each record must have: 0 until the first record sets it, or
+	// -1 for any number
+	fields int
+
+	// Lines read so far, and the line the last record started on
+	line, recordLine int
+}
+
+func newMappedRows(data []byte, start int, cfg Config, fields int) *mappedRows {
+	return &mappedRows{
+		data:   data,
+		start:  start,
+		offset: start,
+		comma:  string(cfg.Delimiter),
+		quote:  byte(cfg.Quote),
+		lazy:   cfg.Quotes != quotesStrict,
+		fields: fields,
+	}
+}
+
+func (m *mappedRows) Read() ([]string, error) {
+	for m.offset < len(m.data) {
+		start := m.offset
+		m.recordLine = m.line + 1
+
+		// Nearly every record is a line of its own, split as it is
+		end, next := m.lineEnd(start)
+		lines := 1
+		text := string(m.data[start:end])
+		var fields []string
+		var err error
+		ok := true
+		if strings.IndexByte(text, m.quote) < 0 {
+			fields = strings.Split(text, m.comma)
+		} else {
+			fields, ok = m.splitQuoted(text)
+		}
+		if !ok {
+			// A quoted field runs over lines, or the csv package has a say
+			end, next, lines = m.boundary(start)
+			fields, err = m.parseQuoted(m.data[start:next])
+		}
+		m.offset = next
+		m.line += lines
+		if end == start {
+			continue // Blank lines are skipped, as by the csv package
+		}
+
+		// The first record sets the field count even when it doesn't parse
+		if m.fields == 0 {
+			m.fields = len(fields)
+		} else if m.fields > 0 && len(fields) != m.fields && err == nil {
+			err = &csv.ParseError{StartLine: m.recordLine, Line: m.recordLine, Column: 1, Err: csv.ErrFieldCount}
+		}
+		return fields, err
+	}
+	return nil, io.EOF
+}
+
+// Byte offset just past the last record read, from the start of the data
+// past any BOM like a csv.Reader's
+func (m *mappedRows) InputOffset() int64 {
+	return int64(m.offset - m.start)
+}
+
+// End of the line starting at start, less its line ending, and where the
+// next one starts
+func (m *mappedRows) lineEnd(start int) (end, next int) {
+	end, next = len(m.data), len(m.data)
+	if i := bytes.IndexByte(m.data[start:], '\n'); i >= 0 {
+		end, next = start+i, start+i+1
+	}
+	if end > start && m.data[end-1] == '\r' {
+		end--
+	}
+	return end, next
+}
+
+// Find the end of the record starting at start, less its line ending, where
+// the next one starts and the lines it takes. Line breaks inside a quoted
+// field don't end the record; a quote only opens one at the start of a
+// field, and in lazy mode only closes it before a delimiter or line ending.
+func (m *mappedRows) boundary(start int) (end, next, lines int) {
+	data, comma := m.data, []byte(m.comma)
+	lines = 1
+	fieldStart, quoted := true, false
+	for i := start; i < len(data); {
+		c := data[i]
+		switch {
+		case quoted && c == m.quote:
+			rest := data[i+1:]
+			switch {
+			case len(rest) > 0 && rest[0] == m.quote:
+				i += 2 // Escaped quote
+				continue
+			case !m.lazy || len(rest) == 0 || rest[0] == '\n' || bytes.HasPrefix(rest, []byte("\r\n")) || bytes.HasPrefix(rest, comma):
+				quoted = false
+			}
+		case quoted:
+			if c == '\n' {
+				lines++
+			}
+		case c == '\n':
+			end = i
+			if end > start && data[end-1] == '\r' {
+				end--
+			}
+			return end, i + 1, lines
+		case fieldStart && c == m.quote:
+			quoted = true
+		case bytes.HasPrefix(data[i:], comma):
+			fieldStart = true
+			i += len(m.comma)
+			continue
+		}
+		if !quoted || c != m.quote {
+			fieldStart = false
+		}
+		i++
+	}
+	end = len(data)
+	if end > start && data[end-1] == '\r' {
+		end--
+	}
+	return end, len(data), lines
+}
+
+// Split a record holding quotes, or report that it takes the csv package:
+// one with malformed quoting outside lazy mode, a quoted field left open or
+// a carriage return, which the csv package drops before a line feed
+func (m *mappedRows) splitQuoted(text string) ([]string, bool) {
+	if strings.IndexByte(text, '\r') >= 0 {
+		return nil, false
+	}
+	fields := make([]string, 0, max(m.fields, 0))
+	for {
+		if len(text) > 0 && text[0] == m.quote {
+			end := strings.IndexByte(text[1:], m.quote) + 1
+			if end > 0 && (end+1 == len(text) || strings.HasPrefix(text[end+1:], m.comma)) {
+				// No quotes inside, the field is as it is in the text
+				fields = append(fields, text[1:end])
+				text = text[end+1:]
+			} else {
+				var field strings.Builder
+				for text = text[1:]; ; {
+					i := strings.IndexByte(text, m.quote)
+					if i < 0 {
+						return nil, false
+					}
+					field.WriteString(text[:i])
+					rest := text[i+1:]
+					if len(rest) > 0 && rest[0] == m.quote {
+						field.WriteByte(m.quote) // Escaped quote
+						text = rest[1:]
+						continue
+					}
+					if rest == "" || strings.HasPrefix(rest, m.comma) {
+						text = rest
+						break
+					}
+					if !m.lazy {
+						return nil, false
+					}
+					field.WriteByte(m.quote) // Stray quote, kept in lazy mode
+					text = rest
+				}
+				fields = append(fields, field.String())
+			}
+			if text == "" {
+				return fields, true
+			}
+			text = text[len(m.comma):]
+			continue
+		}
+
+		end := strings.Index(text, m.comma)
+		field := text
+		if end >= 0 {
+			field = text[:end]
+		}
+		if !m.lazy && strings.IndexByte(field, m.quote) >= 0 {
+			return nil, false
+		}
+		fields = append(fields, field)
+		if end < 0 {
+			return fields, true
+		}
+		text = text[end+len(m.comma):]
+	}
+}
+
+// Split a record holding quotes, with its line ending, with the csv package,
+// numbering the lines of parse errors from the record's line in the file
+func (m *mappedRows) parseQuoted(record []byte) ([]string, error) {
+	var r io.Reader = bytes.NewReader(record)
+	if m.quote != '"' {
+		r = &quoteSwapper{r: r, quote: m.quote}
+	}
+	reader := csv.NewReader(r)
+	reader.Comma = []rune(m.comma)[0]
+	reader.LazyQuotes = m.lazy
+	reader.FieldsPerRecord = -1
+	fields, err := reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		parseErr.StartLine += m.recordLine - 1
+		parseErr.Line += m.recordLine - 1
+	}
+	if m.quote != '"' {
+		for i, field := range fields {
+			fields[i] = swapQuote(field, m.quote)
+		}
+	}
+	return fields, err
+}
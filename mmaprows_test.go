@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// Records, errors and offsets read by mappedRows, which must match the csv
+// package's up to the first error
+func TestMappedRows(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		quotes string
+	}{
+		{name: "plain", data: "a,b,c\n1,2,3\n4,5,6\n"},
+		{name: "no trailing newline", data: "a,b,c\n1,2,3\n4,5,6"},
+		{name: "CRLF", data: "a,b,c\r\n1,2,3\r\n4,5,6\r\n"},
+		{name: "CRLF without trailing newline", data: "a,b,c\r\n1,2,3\r\n4,5,6"},
+		{name: "blank lines", data: "a,b\n\n1,2\r\n\r\n\n3,4\n"},
+		{name: "quoted", data: "a,b\n\"x,y\",\"say \"\"hi\"\"\"\n\"\",z\n"},
+		{name: "quoted newline", data: "a,b\n1,\"two\nlines\"\n2,\"three\n\nlines\"\n3,x\n"},
+		{name: "quoted CRLF", data: "a,b\r\n1,\"two\r\nlines\"\r\n2,x\r\n"},
+		{name: "quoted carriage return", data: "a,b\n1,\"x\ry\"\n"},
+		{name: "quoted newline at end", data: "a,b\n1,\"two\nlines\""},
+		{name: "field count", data: "a,b\n1,2,3\n4,5\n"},
+		{name: "bare quote", data: "a,b\n1,ab\"c\n2,x\n"},
+		{name: "quote after quoted field", data: "a,b\n1,\"x\"y\n2,x\n"},
+		{name: "left open", data: "a,b\n1,\"open\n2,x\n"},
+		{name: "lazy bare quote", data: "a,b\n1,ab\"c\n\"x\"y\",2\n", quotes: quotesLazy},
+		{name: "lazy quoted newline", data: "a,b\n1,\"two\"\" \nlines\"\n2,x", quotes: quotesLazy},
+		{name: "lazy left open", data: "a,b\n1,\"open\n2,x\n", quotes: quotesLazy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotes := tt.quotes
+			if quotes == "" {
+				quotes = quotesStrict
+			}
+			cfg := Config{Delimiter: ',', Quote: '"', Quotes: quotes}
+
+			reader := csv.NewReader(bytes.NewReader([]byte(tt.data)))
+			reader.LazyQuotes = quotes != quotesStrict
+			want := readRows(reader, reader.InputOffset)
+			rows := newMappedRows([]byte(tt.data), 0, cfg, 0)
+			got := readRows(rows, rows.InputOffset)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("mapped rows\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+// The offset of a file's first row is past its BOM, as with a csv.Reader
+// reading on from it
+func TestMappedRowsBOM(t *testing.T) {
+	data := "\xef\xbb\xbfa,b\r\n1,\"x\r\ny\"\r\n2,z"
+	reader := csv.NewReader(bytes.NewReader([]byte(data[3:])))
+	want := readRows(reader, reader.InputOffset)
+	rows := newMappedRows([]byte(data), 3, Config{Delimiter: ',', Quote: '"', Quotes: quotesStrict}, 0)
+	if got := readRows(rows, rows.InputOffset); !reflect.DeepEqual(got, want) {
+		t.Errorf("mapped rows\n%s\nwant\n%s", got, want)
+	}
+}
+
+// Each record with its error and the offset after it, up to the first error
+func readRows(reader interface{ Read() ([]string, error) }, offset func() int64) []string {
+	var rows []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows
+		}
+		rows = append(rows, fmt.Sprintf("%q %v %d", record, err, offset()))
+		if err != nil {
+			return rows
+		}
+	}
+}
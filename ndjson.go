@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Input formats
+const (
+	inputFormatAuto    = "auto"
+	inputFormatCSV     = "csv"
+	inputFormatNDJSON  = "ndjson"
+	inputFormatXLSX    = "xlsx"
+	inputFormatParquet = "parquet"
+)
+
+// Pick the input format; auto takes input starting with '{' to be NDJSON
+func (in *input) detectFormat(format string) error {
+	if in.table != nil {
+		return nil
+	}
+	in.format = format
+	if format != inputFormatAuto {
+		return nil
+	}
+
+	buffered := bufio.NewReader(in.Reader)
+	in.Reader = buffered
+	in.format = inputFormatCSV
+	for i := 1; ; i++ {
+		head, err := buffered.Peek(i)
+		if len(head) < i {
+			if err != nil && err != io.EOF {
+				return err
+			}
+			return nil
+		}
+		switch c := head[i-1]; {
+		case c == '{':
+			in.format = inputFormatNDJSON
+			return nil
+		case c != ' ' && c != '\t' && c != '\r' && c != '\n':
+			return nil
+		}
+	}
+}
+
+// ndjsonReader reads newline-delimited JSON objects, such as mongoexport
+// output, as rows. The keys of the first object are the header, in order;
+// values become their text, Extended JSON types included, and nested
+// documents and arrays their relaxed Extended JSON.
+type ndjsonReader struct {
+	r      *bufio.Reader
+	offset int64
+	line   int
+
+	keys    []string
+	index   map[string]int
+	pending []string // First row, read along with the header
+	ignored map[string]bool
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	return &ndjsonReader{r: bufio.NewReader(r), ignored: map[string]bool{}}
+}
+
+// Read the header on the first call, then a row per object. Malformed
+// lines are returned as *csv.ParseError, so repair mode can skip them.
+func (j *ndjsonReader) Read() ([]string, error) {
+	if j.pending != nil {
+		record := j.pending
+		j.pending = nil
+		return record, nil
+	}
+
+	doc, err := j.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if j.keys == nil {
+		j.index = make(map[string]int, len(doc))
+		for _, elem := range doc {
+			j.index[elem.Key] = len(j.keys)
+			j.keys = append(j.keys, elem.Key)
+		}
+		if j.pending, err = j.record(doc); err != nil {
+			return nil, err
+		}
+		return j.keys, nil
+	}
+	return j.record(doc)
+}
+
+// Byte offset just past the last line read
+func (j *ndjsonReader) InputOffset() int64 {
+	return j.offset
+}
+
+// The next non-empty line as a document
+func (j *ndjsonReader) next() (bson.D, error) {
+	for {
+		line, err := j.r.ReadBytes('\n')
+		j.offset += int64(len(line))
+		if len(line) > 0 {
+			j.line++
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			var doc bson.D
+			if parseErr := bson.UnmarshalExtJSON(trimmed, false, &doc); parseErr != nil {
+				return nil, &csv.ParseError{StartLine: j.line, Line: j.line, Err: parseErr}
+			}
+			return doc, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Lay out a document's values in header order
+func (j *ndjsonReader) record(doc bson.D) ([]string, error) {
+	record := make([]string, len(j.keys))
+	for _, elem := range doc {
+		i, ok := j.index[elem.Key]
+		if !ok {
+			if !j.ignored[elem.Key] {
+				j.ignored[elem.Key] = true
+				slog.Warn("NDJSON key not in the first object ignored", "key", elem.Key, "line", j.line)
+			}
+			continue
+		}
+		value, err := ndjsonText(elem.Value)
+		if err != nil {
+			return nil, &csv.ParseError{StartLine: j.line, Line: j.line, Err: fmt.Errorf("%s: %w", elem.Key, err)}
+		}
+		record[i] = value
+	}
+	return record, nil
+}
+
+// The text of a JSON value, as a CSV cell would hold it. null is empty.
+func ndjsonText(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case primitive.ObjectID:
+		return v.Hex(), nil
+	case primitive.DateTime:
+		return v.Time().UTC().Format(time.RFC3339Nano), nil
+	case primitive.Decimal128:
+		return v.String(), nil
+	case bson.D, bson.A:
+		data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: v}}, false, false)
+		if err != nil {
+			return "", err
+		}
+		// Unwrap {"v":...}
+		return strings.TrimSuffix(strings.TrimPrefix(string(data), `{"v":`), "}"), nil
+	}
+	return "", fmt.Errorf("unsupported value type %T", value)
+}
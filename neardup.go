@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/csv"
+	"log/slog"
+	"math"
+	"strconv"
+)
+
+// Suffix of the file near-duplicate rows are written to for review instead
+// of being inserted, with the place they resemble in trailing columns
+const nearDuplicatesFile = "_near_duplicates.csv"
+
+// Near duplicates found by a dry run, kept apart like its rejects
+const dryRunNearDuplicatesFile = "_dryrun_near_duplicates.csv"
+
+// Meters per degree of latitude
+const metersPerDegree = 111_320
+
+// nearPlace is a place kept for comparison with later rows
+type nearPlace struct {
+	placeID  string
+	address  string
+	lat, lon float64
+}
+
+// nearMatch is an earlier place a row resembles
+type nearMatch struct {
+	placeID    string
+	meters     float64
+	similarity float64
+}
+
+// nearDuplicates finds places within meters of an earlier place in the file
+// whose normalized address is at least similarity alike, indexing places
+// on a grid of cells meters wide so only neighbouring cells are compared.
+// Once maxPlaces places are held, or maxPerCell in a cell, no more are
+// added, and later rows are only compared with those.
+type nearDuplicates struct {
+	meters     float64
+	similarity float64
+	cells      map[[2]int64][]nearPlace
+	places     int
+	maxPlaces  int
+	maxPerCell int
+	full       bool
+	cellFull   bool
+
+	file       *rollingFile
+	writer     *csv.Writer
+	header     []string
+	needHeader bool
+	count      int
+}
+
+// Nil when meters is 0
+func newNearDuplicates(cfg Config, header []string) *nearDuplicates {
+	if cfg.NearDuplicateMeters <= 0 {
+		return nil
+	}
+	name := cfg.outputs.nearDuplicates
+	if cfg.DryRun {
+		name = cfg.outputs.dryRunNearDuplicates
+	}
+	file := newRollingFile(name, false, 0, 0)
+	return &nearDuplicates{
+		meters:     cfg.NearDuplicateMeters,
+		similarity: cfg.NearDuplicateSimilarity,
+		cells:      map[[2]int64][]nearPlace{},
+		maxPlaces:  cfg.NearDuplicateMaxPlaces,
+		maxPerCell: cfg.NearDuplicateMaxPerCell,
+		file:       file,
+		writer:     csv.NewWriter(file),
+		header:     header,
+		needHeader: true,
+	}
+}
+
+func (d *nearDuplicates) cell(lat, lon float64) [2]int64 {
+	size := d.meters / metersPerDegree
+	return [2]int64{int64(math.Floor(lat / size)), int64(math.Floor(lon / size))}
+}
+
+// Find an earlier place the place resembles, or else remember it. Places
+// without an address or a valid location are never near duplicates.
+func (d *nearDuplicates) match(place *Place) *nearMatch {
+	if place.Location == nil || place.Location.invalid || place.Address == "" {
+		return nil
+	}
+	candidate := nearPlace{
+		placeID: place.PlaceID,
+		address: normalizeAddressKey(place.Address),
+		lon:     place.Location.Coordinates[0],
+		lat:     place.Location.Coordinates[1],
+	}
+
+	// Cells are narrower in meters away from the equator, so more of them
+	// are searched east and west
+	center := d.cell(candidate.lat, candidate.lon)
+	span := int64(math.Ceil(1 / math.Max(math.Cos(candidate.lat*math.Pi/180), 0.01)))
+	var best *nearMatch
+	for dLat := int64(-1); dLat <= 1; dLat++ {
+		for dLon := -span; dLon <= span; dLon++ {
+			for _, other := range d.cells[[2]int64{center[0] + dLat, center[1] + dLon}] {
+				meters := haversineMeters(candidate.lat, candidate.lon, other.lat, other.lon)
+				if meters > d.meters {
+					continue
+				}
+				similarity := addressSimilarity(candidate.address, other.address)
+				if similarity >= d.similarity && (best == nil || similarity > best.similarity) {
+					best = &nearMatch{placeID: other.placeID, meters: meters, similarity: similarity}
+				}
+			}
+		}
+	}
+	if best == nil {
+		d.remember(center, candidate)
+	}
+	return best
+}
+
+// Keep a place for comparison with later rows, within the limits
+func (d *nearDuplicates) remember(cell [2]int64, place nearPlace) {
+	switch {
+	case d.maxPlaces > 0 && d.places >= d.maxPlaces:
+		if !d.full {
+			d.full = true
+			slog.Warn("Near-duplicate place limit reached, only earlier places are compared from here on", "maxPlaces", d.maxPlaces)
+		}
+	case d.maxPerCell > 0 && len(d.cells[cell]) >= d.maxPerCell:
+		if !d.cellFull {
+			d.cellFull = true
+			slog.Warn("Near-duplicate cell limit reached, places in full cells are only compared with earlier ones", "maxPerCell", d.maxPerCell)
+		}
+	default:
+		d.cells[cell] = append(d.cells[cell], place)
+		d.places++
+	}
+}
+
+// Write a near-duplicate row for review, with the place it resembles
+func (d *nearDuplicates) write(record []string, match *nearMatch) error {
+	if d.needHeader {
+		header := append(append([]string{}, d.header...), "nearPlaceId", "distanceMeters", "addressSimilarity")
+		if err := d.writer.Write(header); err != nil {
+			return err
+		}
+		d.needHeader = false
+	}
+	d.count++
+	return d.writer.Write(append(append([]string{}, record...),
+		match.placeID,
+		strconv.FormatFloat(match.meters, 'f', 1, 64),
+		strconv.FormatFloat(match.similarity, 'f', 3, 64),
+	))
+}
+
+func (d *nearDuplicates) Close() error {
+	d.writer.Flush()
+	if err := d.writer.Error(); err != nil {
+		d.file.Close()
+		return err
+	}
+	return d.file.Close()
+}
+
+// Great-circle distance between two points
+func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6_371_000
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// How alike two strings are, from 0 to 1: one less their edit distance as
+// a fraction of the longer one's length
+func addressSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return 1 - float64(previous[len(rb)])/float64(longest)
+}
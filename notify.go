@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runNotification is what a finished or failed run sends to WEBHOOK_URL,
+// and what Slack and email messages are written from
+type runNotification struct {
+	Status          string       `json:"status"` // completed or failed
+	Error           string       `json:"error,omitempty"`
+	DryRun          bool         `json:"dryRun"`
+	CSVFile         string       `json:"csvFile,omitempty"`
+	Watch           string       `json:"watch,omitempty"`
+	Database        string       `json:"database"`
+	Collection      string       `json:"collection"`
+	Targets         string       `json:"targets,omitempty"`
+	Host            string       `json:"host"`
+	StartedAt       time.Time    `json:"startedAt"`
+	FinishedAt      time.Time    `json:"finishedAt"`
+	DurationSeconds float64      `json:"durationSeconds"`
+	Summaries       []runSummary `json:"summaries"` // One per input, and target, the run got to
+}
+
+// Describe a run that started at startedAt, runErr being what it failed
+// with, if anything, from the summary files the run itself wrote
+func newRunNotification(cfg Config, startedAt time.Time, runErr error, summaryFiles []string) runNotification {
+	host, _ := os.Hostname()
+	notification := runNotification{
+		Status:          "completed",
+		DryRun:          cfg.DryRun,
+		CSVFile:         cfg.CSVFile,
+		Watch:           cfg.Watch,
+		Database:        cfg.DBName,
+		Collection:      cfg.CollectionName,
+		Targets:         cfg.Targets,
+		Host:            host,
+		StartedAt:       startedAt,
+		FinishedAt:      time.Now(),
+		DurationSeconds: time.Since(startedAt).Seconds(),
+		Summaries:       readSummaries(summaryFiles, startedAt),
+	}
+	if runErr != nil {
+		notification.Status = "failed"
+		notification.Error = runErr.Error()
+	}
+	return notification
+}
+
+// How bad a run's outcome is, in increasing order: it succeeded, it
+// finished with rejected rows, or it failed
+const (
+	severitySuccess = "success"
+	severityWarning = "warning"
+	severityFailure = "failure"
+)
+
+var severityRanks = map[string]int{severitySuccess: 0, severityWarning: 1, severityFailure: 2}
+
+func (n runNotification) severity() string {
+	if n.Status != "completed" {
+		return severityFailure
+	}
+	for _, summary := range n.Summaries {
+		if summary.Rejected > 0 {
+			return severityWarning
+		}
+	}
+	return severitySuccess
+}
+
+// One line saying how the run went, e.g. for an email subject
+func (n runNotification) headline() string {
+	what := n.Database + "." + n.Collection
+	if n.Targets != "" {
+		what = n.Collection + " on " + n.Targets
+	}
+	dryRun := ""
+	if n.DryRun {
+		dryRun = " (dry run)"
+	}
+	return fmt.Sprintf("Seeding %s %s%s: %s", what, n.Status, dryRun, n.severity())
+}
+
+// The run summary in plain text: its counts, duration and errors, and
+// where to find the rejected rows
+func (n runNotification) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", n.headline())
+	fmt.Fprintf(&b, "Host %s, took %s\n", n.Host, (time.Duration(n.DurationSeconds * float64(time.Second))).Round(time.Second))
+	if n.Error != "" {
+		fmt.Fprintf(&b, "Error: %s\n", n.Error)
+	}
+	for _, s := range n.Summaries {
+		input := s.CSVFile
+		if s.Target != "" {
+			input += " to " + s.Target
+		}
+		fmt.Fprintf(&b, "\n%s: %s, %d rows read, %d inserted, %d rejected, %d skipped, %d filtered, %d duplicates\n",
+			input, s.Status, s.RowsRead, s.Inserted, s.Rejected, s.Skipped, s.Filtered, s.Duplicates)
+		if s.Error != "" {
+			fmt.Fprintf(&b, "  Error: %s\n", s.Error)
+		}
+		kinds := make([]string, 0, len(s.ErrorsByType))
+		for kind := range s.ErrorsByType {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			fmt.Fprintf(&b, "  %s: %d\n", kind, s.ErrorsByType[kind])
+		}
+		if s.RejectsFile != "" {
+			rejects := s.RejectsFile
+			if s.ReportsURL != "" {
+				rejects = s.ReportsURL + filepath.Base(s.RejectsFile)
+			}
+			fmt.Fprintf(&b, "  Rejected rows: %s\n", rejects)
+		}
+	}
+	return b.String()
+}
+
+// Send the notification wherever the run is configured to. Notifying is
+// best effort: failures are logged, not returned, so they can't fail an
+// import that succeeded.
+func notifyRun(cfg Config, notification runNotification) {
+	if cfg.WebhookURL != "" {
+		if err := postWebhook(cfg.WebhookURL, cfg.WebhookTimeout, notification); err != nil {
+			slog.Warn("Webhook notification failed", "error", err)
+		}
+	}
+	severity := severityRanks[notification.severity()]
+	if cfg.SlackWebhookURL != "" && severity >= severityRanks[cfg.SlackMinSeverity] {
+		if err := postWebhook(cfg.SlackWebhookURL, cfg.WebhookTimeout, slackMessage{Text: notification.text()}); err != nil {
+			slog.Warn("Slack notification failed", "error", err)
+		}
+	}
+	if cfg.EmailTo != "" && severity >= severityRanks[cfg.EmailMinSeverity] {
+		if err := sendEmail(cfg, notification.headline(), notification.text()); err != nil {
+			slog.Warn("Email notification failed", "error", err)
+		}
+	}
+}
+
+// slackMessage is the body of a message to a Slack incoming webhook
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// POST the payload as JSON
+func postWebhook(url string, timeout time.Duration, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Email the message to EMAIL_TO over SMTP_HOST, with STARTTLS when the
+// server offers it, and authenticating when SMTP_USERNAME is set
+func sendEmail(cfg Config, subject, body string) error {
+	var to []string
+	for _, address := range strings.Split(cfg.EmailTo, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			to = append(to, address)
+		}
+	}
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.EmailFrom)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	addr := net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort))
+	return smtp.SendMail(addr, auth, cfg.EmailFrom, to, msg.Bytes())
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// What a null token becomes
+const (
+	nullAsNull = "null"
+	nullAsOmit = "omit"
+	nullAsKeep = "keep"
+)
+
+// Place fields read from a single column that null tokens apply to
+var nullablePlaceFields = []string{
+	"address", "version", "isAutoCompleteAddress", "types", "plusCode", "city",
+	"division", "district", "postalCode", "sublocality", "localArea", "mergedAt",
+}
+
+// nullRule says which cell values are nulls and whether they are stored as
+// null, omitted, or kept as they are
+type nullRule struct {
+	Tokens []string `json:"tokens"`
+	As     string   `json:"as"`
+}
+
+// NullTokens configures null tokens for every column, with per-column
+// overrides keyed by header name
+type NullTokens struct {
+	nullRule
+	Columns map[string]nullRule `json:"columns"`
+}
+
+func (r nullRule) validate() error {
+	switch r.As {
+	case "", nullAsNull, nullAsOmit, nullAsKeep:
+		return nil
+	}
+	return fmt.Errorf("null tokens must be stored as %q, %q or %q, not %q", nullAsNull, nullAsOmit, nullAsKeep, r.As)
+}
+
+func (n NullTokens) validate() error {
+	if err := n.nullRule.validate(); err != nil {
+		return err
+	}
+	for column, rule := range n.Columns {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("column %q: %w", column, err)
+		}
+	}
+	return nil
+}
+
+// Whether the value is one of the rule's null tokens
+func (r nullRule) matches(value string) bool {
+	if r.As == nullAsKeep {
+		return false
+	}
+	for _, token := range r.Tokens {
+		if value == token {
+			return true
+		}
+	}
+	return false
+}
+
+// Rule for each header column. Unconfigured tokens default to
+// defaultTokens, stored as null.
+func (n NullTokens) resolve(header *Header, defaultTokens []string) ([]nullRule, error) {
+	for column := range n.Columns {
+		if _, ok := header.Index(column); !ok {
+			return nil, fmt.Errorf("null tokens for %q: column not found in header", column)
+		}
+	}
+
+	base := n.nullRule
+	if base.Tokens == nil {
+		base.Tokens = defaultTokens
+	}
+	if base.As == "" {
+		base.As = nullAsNull
+	}
+
+	rules := make([]nullRule, len(header.Names))
+	for i, name := range header.Names {
+		rule, ok := n.Columns[name]
+		if !ok {
+			rules[i] = base
+			continue
+		}
+		if rule.Tokens == nil {
+			rule.Tokens = base.Tokens
+		}
+		if rule.As == "" {
+			rule.As = base.As
+		}
+		rules[i] = rule
+	}
+	return rules, nil
+}
+
+// Null rules for the Place fields, by field name
+func placeNullRules(rules []nullRule, cols columns) map[string]nullRule {
+	byField := map[string]nullRule{}
+	for _, field := range nullablePlaceFields {
+		if i, ok := cols[field]; ok && i < len(rules) && len(rules[i].Tokens) > 0 {
+			byField[field] = rules[i]
+		}
+	}
+	return byField
+}
+
+// Record which of the place's fields held null tokens in the row
+func setNullFields(place *Place, rules map[string]nullRule, cols columns, record []string) {
+	for field, rule := range rules {
+		if rule.matches(cols.get(record, field)) {
+			if place.nullFields == nil {
+				place.nullFields = map[string]string{}
+			}
+			place.nullFields[field] = rule.As
+		}
+	}
+}
+
+// Marshal the place, storing fields that held null tokens as null or
+// omitting them, and writing geo fields in the fields format as separate
+// latitude and longitude
+func (p *Place) MarshalBSON() ([]byte, error) {
+	type place Place // Without the MarshalBSON method
+	data, err := bson.MarshalWithRegistry(bsonRegistry, (*place)(p))
+	split := p.splitGeoFields()
+	if err != nil || (len(p.nullFields) == 0 && len(p.omitFields) == 0 && len(split) == 0) {
+		return data, err
+	}
+
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	kept := make(bson.D, 0, len(doc)+len(split))
+	for _, e := range doc {
+		if slices.Contains(p.omitFields, e.Key) {
+			continue
+		}
+		if loc, ok := split[e.Key]; ok {
+			lat, lon := geoFieldNames(e.Key)
+			kept = append(kept, bson.E{Key: lat, Value: loc.Coordinates[1]}, bson.E{Key: lon, Value: loc.Coordinates[0]})
+			continue
+		}
+		switch p.nullFields[e.Key] {
+		case nullAsOmit:
+			continue
+		case nullAsNull:
+			e.Value = nil
+		}
+		kept = append(kept, e)
+	}
+	return bson.MarshalWithRegistry(bsonRegistry, kept)
+}
+
+// Geo fields of the place written in the fields format, by name
+func (p *Place) splitGeoFields() map[string]*Location {
+	var split map[string]*Location
+	add := func(name string, loc *Location) {
+		if loc != nil && loc.format == geoFormatFields {
+			if split == nil {
+				split = map[string]*Location{}
+			}
+			split[name] = loc
+		}
+	}
+	add("location", p.Location)
+	for name, value := range p.Extra {
+		if loc, ok := value.(*Location); ok {
+			add(name, loc)
+		}
+	}
+	return split
+}
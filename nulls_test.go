@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNullTokens(t *testing.T) {
+	header, err := newHeader([]string{"placeId", "address", "city", "postalCode"}, duplicateHeadersRename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols := columns{"placeId": 0, "address": 1, "city": 2, "postalCode": 3}
+	tests := []struct {
+		name     string
+		nulls    string // The mapping's "nulls" object
+		record   []string
+		want     bson.M // Stored address, city and postalCode; a missing key is omitted
+		parseErr bool
+		err      bool
+	}{
+		{
+			name:   "none configured",
+			nulls:  `{}`,
+			record: []string{"p1", "", "NULL", "-"},
+			want:   bson.M{"address": "", "city": "NULL", "postalCode": "-"},
+		},
+		{
+			name:   "null tokens",
+			nulls:  `{"tokens": ["", "NULL", "N/A"]}`,
+			record: []string{"p1", "", "NULL", "-"},
+			want:   bson.M{"address": nil, "city": nil, "postalCode": "-"},
+		},
+		{
+			name:   "omitted",
+			nulls:  `{"tokens": ["NULL"], "as": "omit"}`,
+			record: []string{"p1", "", "NULL", "NULL"},
+			want:   bson.M{"address": ""},
+		},
+		{
+			name:   "per column",
+			nulls:  `{"tokens": ["NULL"], "columns": {"postalCode": {"tokens": ["-"], "as": "omit"}, "city": {"as": "keep"}}}`,
+			record: []string{"p1", "NULL", "NULL", "-"},
+			want:   bson.M{"address": nil, "city": "NULL"},
+		},
+		{
+			name:   "per column tokens, default storage",
+			nulls:  `{"as": "omit", "columns": {"address": {"tokens": ["N/A"]}}}`,
+			record: []string{"p1", "N/A", "", ""},
+			want:   bson.M{"postalCode": "", "city": ""},
+		},
+		{
+			name:     "unknown storage",
+			nulls:    `{"tokens": ["NULL"], "as": "drop"}`,
+			parseErr: true,
+		},
+		{
+			name:  "unknown column",
+			nulls: `{"columns": {"zip": {"tokens": ["-"]}}}`,
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mapping Mapping
+			if err := json.Unmarshal([]byte(`{"nulls": `+tt.nulls+`}`), &mapping); err != nil {
+				t.Fatal(err)
+			}
+			if err := mapping.Nulls.validate(); (err != nil) != tt.parseErr {
+				t.Fatalf("validate = %v, want error = %v", err, tt.parseErr)
+			} else if err != nil {
+				return
+			}
+			rules, err := mapping.Nulls.resolve(header, nil)
+			if tt.err {
+				if err == nil {
+					t.Errorf("resolve(%s) succeeded, want an error", tt.nulls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			place := Place{
+				PlaceID:    cols.get(tt.record, "placeId"),
+				Address:    cols.get(tt.record, "address"),
+				City:       cols.get(tt.record, "city"),
+				PostalCode: cols.get(tt.record, "postalCode"),
+			}
+			setNullFields(&place, placeNullRules(rules, cols), cols, tt.record)
+			data, err := bson.Marshal(&place)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stored bson.M
+			if err := bson.Unmarshal(data, &stored); err != nil {
+				t.Fatal(err)
+			}
+			got := bson.M{}
+			for _, field := range []string{"address", "city", "postalCode"} {
+				if value, ok := stored[field]; ok {
+					got[field] = value
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stored %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// How long each presigned GET of an object store source is valid for
+const objectSourceExpiry = 15 * time.Minute
+
+// Endpoint of Google Cloud Storage's S3-compatible XML API, used for gs://
+// URLs with HMAC keys as the access key and secret
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// objectStore is a bucket and key prefix in S3, GCS or another
+// S3-compatible store
+type objectStore struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// Connect to the store for an s3://bucket/prefix or gs://bucket/prefix URL.
+// Credentials come from the standard AWS sources (environment, shared
+// config, instance roles). endpoint overrides the S3 endpoint, for
+// S3-compatible stores like MinIO.
+func newObjectStore(ctx context.Context, rawURL, endpoint string) (*objectStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("object store URL %q has no bucket", rawURL)
+	}
+
+	var opts []func(*awsconfig.LoadOptions) error
+	switch u.Scheme {
+	case "s3":
+	case "gs":
+		if endpoint == "" {
+			endpoint = gcsEndpoint
+		}
+		opts = append(opts, awsconfig.WithRegion("auto"))
+	default:
+		return nil, fmt.Errorf("object store URL %q must start with s3:// or gs://", rawURL)
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("loading object store credentials: %w", err)
+	}
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	return &objectStore{client: client, bucket: u.Host, prefix: strings.Trim(u.Path, "/")}, nil
+}
+
+// Key for a name under the store's prefix
+func (s *objectStore) key(name ...string) string {
+	return path.Join(append([]string{s.prefix}, name...)...)
+}
+
+// Upload a local file under the given key
+func (s *objectStore) putFile(ctx context.Context, key, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          f,
+		ContentLength: aws.Int64(info.Size()),
+	})
+	if err != nil {
+		return fmt.Errorf("uploading %s to %s/%s: %w", file, s.bucket, key, err)
+	}
+	return nil
+}
+
+// Whether the path is an s3://, gs:// or az:// URL naming an object to read
+func isObjectURL(path string) bool {
+	return strings.HasPrefix(path, "s3://") || strings.HasPrefix(path, "gs://") || strings.HasPrefix(path, "az://")
+}
+
+// Stream an s3://bucket/key, gs://bucket/key or az://account/container/blob
+// object, through presigned GET requests so it resumes with Range requests
+// like an HTTP source
+func openObject(rawURL, endpoint string) (*httpReader, error) {
+	if strings.HasPrefix(rawURL, "az://") {
+		return openAzureBlob(rawURL, endpoint)
+	}
+
+	store, err := newObjectStore(context.Background(), rawURL, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if store.prefix == "" {
+		return nil, fmt.Errorf("object URL %q has no key", rawURL)
+	}
+
+	presigner := s3.NewPresignClient(store.client)
+	r := &httpReader{client: &http.Client{}, size: -1}
+	r.presign = func() (string, error) {
+		req, err := presigner.PresignGetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String(store.bucket),
+			Key:    aws.String(store.prefix),
+		}, s3.WithPresignExpires(objectSourceExpiry))
+		if err != nil {
+			return "", fmt.Errorf("presigning %s: %w", rawURL, err)
+		}
+		return req.URL, nil
+	}
+	return r, r.open()
+}
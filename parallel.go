@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+// Bar counting the files finished, above the bars of those in progress
+const filesProgressTemplate pb.ProgressBarTemplate = `{{counters . }} files {{bar . }} {{etime . }}`
+
+// Batches being written at once across files processed in parallel, nil
+// for no limit
+var insertSlots chan struct{}
+
+// Pool the progress bars of files processed in parallel are drawn in, nil
+// when they aren't
+var progressPool *pb.Pool
+
+// Wait for a free insert slot, returning the function that frees it
+func acquireInsertSlot() func() {
+	if insertSlots == nil {
+		return func() {}
+	}
+	insertSlots <- struct{}{}
+	return func() { <-insertSlots }
+}
+
+// Process the sources up to cfg.ParallelFiles at a time, each resuming from
+// its own checkpoint. Once one fails no more are started; those already
+// running finish, and the failures are returned together.
+func runParallel(cfg Config, inputs []string) error {
+	if cfg.MaxConcurrentInserts > 0 {
+		insertSlots = make(chan struct{}, cfg.MaxConcurrentInserts)
+	}
+
+	var files *pb.ProgressBar
+	switch {
+	case cfg.Quiet || !showBars():
+	case cfg.Dashboard:
+		progressDashboard = startDashboard(cfg, len(inputs))
+		defer func() {
+			progressDashboard.close()
+			progressDashboard = nil
+		}()
+	default:
+		files = filesProgressTemplate.New(len(inputs))
+		progressPool = pb.NewPool(files)
+		if err := progressPool.Start(); err != nil {
+			return err
+		}
+		defer func() {
+			files.Finish()
+			progressPool.Stop()
+		}()
+	}
+	slog.Info("Processing files in parallel", "files", len(inputs), "parallel", cfg.ParallelFiles, "maxConcurrentInserts", cfg.MaxConcurrentInserts)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		errs    []error
+		running = make(chan struct{}, cfg.ParallelFiles)
+	)
+	for _, source := range inputs {
+		running <- struct{}{}
+		mu.Lock()
+		failed := len(errs) > 0
+		mu.Unlock()
+		if failed {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-running }()
+
+			run := cfg.forSource(source, outputPrefix(source))
+			slog.Info("Processing file", "file", source)
+			err := processCSV(run)
+			if files != nil {
+				files.Increment()
+			}
+			if progressDashboard != nil {
+				progressDashboard.done(source, err)
+			}
+			if err != nil {
+				slog.Error(failureMessage(err), "error", err, "file", source, "progressFile", run.outputs.progress)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", source, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
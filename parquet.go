@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// Rows read from each column at a time
+const parquetChunkRows = 1000
+
+// parquetReader reads the rows of a Parquet file, column chunk by column
+// chunk. Columns are named by their dotted path, list wrappers left out;
+// repeated columns become JSON arrays.
+type parquetReader struct {
+	pr      *reader.ParquetReader
+	columns []parquetColumn
+	total   int64
+	read    int64
+
+	header bool       // Whether the header has been returned
+	rows   [][]string // Rows of the current chunk not yet returned
+}
+
+type parquetColumn struct {
+	name     string
+	path     string // Internal path the column is read by
+	element  *parquet.SchemaElement
+	repeated bool
+	defined  int32 // Definition level of a present value
+}
+
+// If the input is a Parquet file, by format or, in auto mode, by its
+// .parquet extension, read it instead, keeping only the comma-separated
+// columns if any are named. The file is read by seeking, so it has to be a local,
+// uncompressed one.
+func (in *input) openParquet(format, source, columns string) error {
+	if format != inputFormatParquet && (format != inputFormatAuto || !strings.EqualFold(sourceExt(source), ".parquet")) {
+		return nil
+	}
+	if in.file == nil || in.compression != compressionNone {
+		return errors.New("parquet input must be an uncompressed local file")
+	}
+
+	pr, err := reader.NewParquetColumnReader(parquetFile{in.file}, 1)
+	if err != nil {
+		return fmt.Errorf("opening parquet file: %w", err)
+	}
+	p := &parquetReader{pr: pr, total: pr.GetNumRows()}
+	var names []string
+	for _, name := range strings.Split(columns, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if p.columns, err = parquetColumns(pr, names); err != nil {
+		pr.ReadStop()
+		return err
+	}
+
+	// Progress counts rows
+	in.size = p.total
+	in.table = p
+	in.closers = append(in.closers, p)
+	in.format = inputFormatParquet
+	in.encoding = encodingUTF8
+	return nil
+}
+
+// The file's leaf columns, or those of them named, in the order named
+func parquetColumns(pr *reader.ParquetReader, names []string) ([]parquetColumn, error) {
+	sh := pr.SchemaHandler
+	root := sh.GetRootExName() + "."
+
+	var all []parquetColumn
+	byName := map[string]parquetColumn{}
+	for _, path := range sh.ValueColumns {
+		name := strings.TrimPrefix(sh.InPathToExPath[path], root)
+		name = strings.TrimSuffix(strings.TrimSuffix(name, ".list.element"), ".list.item")
+
+		column := parquetColumn{name: name, path: path, element: sh.SchemaElements[sh.MapIndex[path]]}
+		repeated, err := sh.MaxRepetitionLevel(common.StrToPath(path))
+		if err != nil {
+			return nil, err
+		}
+		if column.defined, err = sh.MaxDefinitionLevel(common.StrToPath(path)); err != nil {
+			return nil, err
+		}
+		column.repeated = repeated > 0
+		all = append(all, column)
+		byName[name] = column
+	}
+	if len(names) == 0 {
+		return all, nil
+	}
+
+	selected := make([]parquetColumn, 0, len(names))
+	for _, name := range names {
+		column, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("parquet column %q not found", name)
+		}
+		selected = append(selected, column)
+	}
+	return selected, nil
+}
+
+// Read the header on the first call, then a row at a time
+func (p *parquetReader) Read() ([]string, error) {
+	if !p.header {
+		p.header = true
+		header := make([]string, len(p.columns))
+		for i, column := range p.columns {
+			header[i] = column.name
+		}
+		return header, nil
+	}
+
+	if len(p.rows) == 0 {
+		if p.read >= p.total {
+			return nil, io.EOF
+		}
+		if err := p.readChunk(min(parquetChunkRows, p.total-p.read)); err != nil {
+			return nil, err
+		}
+	}
+	record := p.rows[0]
+	p.rows = p.rows[1:]
+	p.read++
+	return record, nil
+}
+
+// Read the next n rows of every column
+func (p *parquetReader) readChunk(n int64) error {
+	rows := make([][]string, n)
+	for i := range rows {
+		rows[i] = make([]string, len(p.columns))
+	}
+
+	for c, column := range p.columns {
+		values, rls, dls, err := p.pr.ReadColumnByPath(column.path, n)
+		if err != nil {
+			return fmt.Errorf("parquet column %s: %w", column.name, err)
+		}
+
+		row := -1
+		var list []any
+		done := func() error {
+			if row < 0 || !column.repeated || list == nil {
+				return nil
+			}
+			data, err := json.Marshal(list)
+			rows[row][c] = string(data)
+			return err
+		}
+		for i, value := range values {
+			// A new row starts at repetition level 0
+			if !column.repeated || rls[i] == 0 {
+				if err := done(); err != nil {
+					return err
+				}
+				row, list = row+1, nil
+				if row >= len(rows) {
+					return fmt.Errorf("parquet column %s has more rows than the file", column.name)
+				}
+			}
+			if value == nil || dls[i] < column.defined {
+				continue
+			}
+			text := parquetText(value, column.element)
+			if column.repeated {
+				list = append(list, text)
+			} else {
+				rows[row][c] = text
+			}
+		}
+		if err := done(); err != nil {
+			return err
+		}
+		if row != len(rows)-1 {
+			return fmt.Errorf("parquet column %s ended after %d of %d rows", column.name, p.read+int64(row)+1, p.total)
+		}
+	}
+
+	p.rows = rows
+	return nil
+}
+
+// Rows read, standing in for a byte offset
+func (p *parquetReader) InputOffset() int64 {
+	return p.read
+}
+
+func (p *parquetReader) Close() error {
+	p.pr.ReadStop()
+	return nil
+}
+
+// The text of a Parquet value, as a CSV cell would hold it. Dates and
+// timestamps are formatted as RFC 3339.
+func parquetText(value any, element *parquet.SchemaElement) string {
+	logical := element.GetLogicalType()
+	converted := parquet.ConvertedType(-1)
+	if element.IsSetConvertedType() {
+		converted = element.GetConvertedType()
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case int32:
+		if converted == parquet.ConvertedType_DATE || logical != nil && logical.IsSetDATE() {
+			return time.Unix(int64(v)*24*60*60, 0).UTC().Format(time.DateOnly)
+		}
+		if converted == parquet.ConvertedType_DECIMAL {
+			return parquetDecimal(big.NewInt(int64(v)), element.GetScale())
+		}
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		switch {
+		case converted == parquet.ConvertedType_TIMESTAMP_MILLIS:
+			return time.UnixMilli(v).UTC().Format(time.RFC3339Nano)
+		case converted == parquet.ConvertedType_TIMESTAMP_MICROS:
+			return time.UnixMicro(v).UTC().Format(time.RFC3339Nano)
+		case logical != nil && logical.IsSetTIMESTAMP():
+			unit := logical.GetTIMESTAMP().GetUnit()
+			switch {
+			case unit.IsSetMILLIS():
+				return time.UnixMilli(v).UTC().Format(time.RFC3339Nano)
+			case unit.IsSetMICROS():
+				return time.UnixMicro(v).UTC().Format(time.RFC3339Nano)
+			default:
+				return time.Unix(0, v).UTC().Format(time.RFC3339Nano)
+			}
+		case converted == parquet.ConvertedType_DECIMAL:
+			return parquetDecimal(big.NewInt(v), element.GetScale())
+		}
+		return strconv.FormatInt(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		switch {
+		case element.GetType() == parquet.Type_INT96 && len(v) == 12:
+			return parquetINT96(v).Format(time.RFC3339Nano)
+		case converted == parquet.ConvertedType_DECIMAL:
+			// Big-endian two's complement
+			unscaled := new(big.Int).SetBytes([]byte(v))
+			if len(v) > 0 && v[0]&0x80 != 0 {
+				unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(8*len(v))))
+			}
+			return parquetDecimal(unscaled, element.GetScale())
+		}
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// An INT96 timestamp: nanoseconds into the day, then the Julian day, both
+// little-endian
+func parquetINT96(v string) time.Time {
+	nanos := binary.LittleEndian.Uint64([]byte(v[:8]))
+	day := int64(binary.LittleEndian.Uint32([]byte(v[8:])))
+	return time.Unix((day-2440588)*24*60*60, int64(nanos)).UTC()
+}
+
+// An unscaled decimal as text
+func parquetDecimal(unscaled *big.Int, scale int32) string {
+	return new(big.Rat).SetFrac(unscaled, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)).FloatString(int(scale))
+}
+
+// parquetFile reads a Parquet file through a local file. The reader opens
+// the file again for every column it reads.
+type parquetFile struct {
+	*os.File
+}
+
+func (f parquetFile) Open(name string) (source.ParquetFile, error) {
+	if name == "" {
+		name = f.Name()
+	} else {
+		name = filepath.Join(filepath.Dir(f.Name()), name)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return parquetFile{file}, nil
+}
+
+func (f parquetFile) Create(string) (source.ParquetFile, error) {
+	return nil, errors.New("parquet input is read-only")
+}
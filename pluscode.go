@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Plus code checking
+const (
+	plusCodeCheckOff    = "off"
+	plusCodeCheckFlag   = "flag"
+	plusCodeCheckReject = "reject"
+)
+
+// Open Location Code digits, in value order
+const plusCodeAlphabet = "23456789CFGHJMPQRVWX"
+
+// Digits in derived codes, about 14m square; the separator comes after 8
+const (
+	plusCodeLength       = 10
+	plusCodeSeparatorPos = 8
+)
+
+// Whether code is a valid full or short plus code. Only its first word is
+// checked, so compound codes like "X3QF+4V Dhaka, Bangladesh" are valid.
+func validPlusCode(code string) error {
+	if fields := strings.Fields(code); len(fields) > 0 {
+		code = fields[0]
+	}
+	code = strings.ToUpper(code)
+
+	separator := strings.IndexByte(code, '+')
+	if separator < 0 || separator != strings.LastIndexByte(code, '+') {
+		return fmt.Errorf("%q needs exactly one +", code)
+	}
+	if separator > plusCodeSeparatorPos || separator%2 != 0 {
+		return fmt.Errorf("%q has its + in the wrong place", code)
+	}
+	if len(code)-separator-1 == 1 {
+		return fmt.Errorf("%q has a single digit after the +", code)
+	}
+
+	// Padding, as in "7MMC0000+", is only allowed in full codes, as whole
+	// pairs ending at the separator
+	if padding := strings.IndexByte(code, '0'); padding >= 0 {
+		end := strings.LastIndexByte(code, '0') + 1
+		if separator < plusCodeSeparatorPos || padding%2 != 0 || end != separator ||
+			strings.Trim(code[padding:end], "0") != "" || separator != len(code)-1 {
+			return fmt.Errorf("%q is padded wrongly", code)
+		}
+		code = code[:padding] + code[end:]
+	}
+
+	for i, c := range strings.Replace(code, "+", "", 1) {
+		if !strings.ContainsRune(plusCodeAlphabet, c) {
+			return fmt.Errorf("%q has an invalid character %q at %d", code, c, i)
+		}
+	}
+
+	// The first pair of a full code is limited to 180 degrees of latitude
+	// and 360 of longitude
+	if separator == plusCodeSeparatorPos {
+		if strings.IndexByte(plusCodeAlphabet, code[0]) >= 9 || strings.IndexByte(plusCodeAlphabet, code[1]) >= 18 {
+			return fmt.Errorf("%q is outside the globe", code)
+		}
+	}
+	return nil
+}
+
+// Encode a point as a 10 digit plus code, e.g. 7MMG7CQ6+HV
+func encodePlusCode(lat, lon float64) string {
+	lat = math.Max(-90, math.Min(90, lat))
+	lon = math.Mod(lon+180, 360)
+	if lon < 0 {
+		lon += 360
+	}
+
+	// Each pair narrows the cell twentyfold: 20 degrees, then 1, down to
+	// 1/8000 of a degree for the fifth
+	precision := math.Pow(20, plusCodeLength/2-2)
+	latValue := int64(math.Floor(math.Round((lat+90)*precision*1e6) / 1e6))
+	lonValue := int64(math.Floor(math.Round(lon*precision*1e6) / 1e6))
+	latValue = min(latValue, int64(180*precision)-1) // The north pole is in the top cell
+	lonValue = min(lonValue, int64(360*precision)-1)
+
+	digits := make([]byte, plusCodeLength)
+	for i := plusCodeLength - 2; i >= 0; i -= 2 {
+		digits[i] = plusCodeAlphabet[latValue%20]
+		digits[i+1] = plusCodeAlphabet[lonValue%20]
+		latValue /= 20
+		lonValue /= 20
+	}
+	return string(digits[:plusCodeSeparatorPos]) + "+" + string(digits[plusCodeSeparatorPos:])
+}
+
+// Check a place's plus code, and fill an empty one from a valid location
+// when derive is set. Returns whether one was derived; an invalid code is
+// flagged on the place, or an error with the reject mode.
+func checkPlusCode(place *Place, mode string, derive bool) (bool, error) {
+	if place.PlusCode == "" {
+		if !derive || place.Location == nil || place.Location.invalid {
+			return false, nil
+		}
+		place.PlusCode = encodePlusCode(place.Location.Coordinates[1], place.Location.Coordinates[0])
+		delete(place.nullFields, "plusCode")
+		return true, nil
+	}
+
+	if mode == plusCodeCheckOff {
+		return false, nil
+	}
+	if err := validPlusCode(place.PlusCode); err != nil {
+		if mode == plusCodeCheckReject {
+			return false, &rowError{Kind: "invalid_plus_code", Err: fmt.Errorf("plusCode: %w", err)}
+		}
+		place.InvalidPlusCode = true
+	}
+	return false, nil
+}
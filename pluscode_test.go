@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+func TestValidPlusCode(t *testing.T) {
+	tests := []struct {
+		code  string
+		valid bool
+	}{
+		// Full codes
+		{"7FG49QCJ+2V", true},
+		{"8FVC9G8F+6X", true},
+		{"7fg49qcj+2v", true},
+		{"7MMG7CQ6+HV Dhaka, Bangladesh", true},
+		{"7FG49QCJ+", true},
+		{"7FG49QCJ+2VX", true},
+
+		// Padded codes
+		{"7FG40000+", true},
+		{"7F000000+", true},
+		{"7FG49Q00+", true},
+		{"7FG4900+", false},
+		{"7FG40000+2V", false},
+		{"7FG00Q00+", false},
+		{"7F0G0000+", false},
+
+		// Short codes
+		{"9QCJ+2V", true},
+		{"CJ+2V", true},
+		{"QCJ+2V", false},
+		{"9Q00+", false},
+
+		// Malformed
+		{"", false},
+		{"7FG49QCJ2V", false},
+		{"7FG4+9QCJ+2V", false},
+		{"7FG49QCJ2+2V", false},
+		{"7FG49QCJ+2", false},
+		{"7FG49QCA+2V", false},
+		{"7FG49QCJ+2U", false},
+
+		// Outside the globe
+		{"CFX3X2X2+X2", true},
+		{"FFX3X2X2+X2", false},
+		{"7XG49QCJ+2V", false},
+	}
+	for _, tt := range tests {
+		err := validPlusCode(tt.code)
+		if (err == nil) != tt.valid {
+			t.Errorf("validPlusCode(%q) = %v, want valid %v", tt.code, err, tt.valid)
+		}
+	}
+}
+
+func TestEncodePlusCode(t *testing.T) {
+	tests := []struct {
+		lat, lon float64
+		want     string
+	}{
+		{20.3700625, 2.7821875, "7FG49QCJ+2V"},
+		{47.0000625, 8.0000625, "8FVC2222+22"},
+		{-41.2730625, 174.7859375, "4VCPPQGP+Q9"},
+		{23.8103, 90.4125, "7MMGRC67+42"},
+		{-90, -180, "22222222+22"},
+
+		// The north pole is in the top row of cells, and longitudes wrap
+		{90, 1, "CFX3X2X2+X2"},
+		{1, 180, "62H22222+22"},
+		{1, 540, "62H22222+22"},
+		{100, 1, "CFX3X2X2+X2"},
+	}
+	for _, tt := range tests {
+		got := encodePlusCode(tt.lat, tt.lon)
+		if got != tt.want {
+			t.Errorf("encodePlusCode(%v, %v) = %q, want %q", tt.lat, tt.lon, got, tt.want)
+		}
+		if err := validPlusCode(got); err != nil {
+			t.Errorf("encodePlusCode(%v, %v) = %q, which isn't valid: %v", tt.lat, tt.lon, got, err)
+		}
+	}
+}
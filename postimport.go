@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// postImportStep is follow-up work run once an import succeeds: an
+// aggregation Pipeline over Collection, COLLECTION_NAME by default, e.g.
+// ending in $merge or $out, or a database Command such as createIndexes or
+// collMod
+type postImportStep struct {
+	Name       string   `bson:"name"`
+	Collection string   `bson:"collection"`
+	Pipeline   []bson.D `bson:"pipeline"`
+	Command    bson.D   `bson:"command"`
+}
+
+// Load the steps from a JSON array in MongoDB Extended JSON, e.g.
+// [{"name": "counts", "pipeline": [{"$group": {"_id": "$division", "places": {"$sum": 1}}}, {"$merge": "division_counts"}]}]
+func loadPostImport(path string) ([]postImportStep, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing post-import file %s: %w", path, err)
+	}
+
+	steps := make([]postImportStep, len(raw))
+	for i, r := range raw {
+		step := &steps[i]
+		if err := bson.UnmarshalExtJSON(r, false, step); err != nil {
+			return nil, fmt.Errorf("post-import file %s: step %d: %w", path, i+1, err)
+		}
+		if (step.Pipeline == nil) == (step.Command == nil) {
+			return nil, fmt.Errorf("post-import file %s: step %d needs either a pipeline or a command", path, i+1)
+		}
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step %d", i+1)
+		}
+	}
+	return steps, nil
+}
+
+// Run the steps in order against the target database, stopping at the
+// first that fails. A dry run only logs them.
+func runPostImport(cfg Config, steps []postImportStep) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	if cfg.DryRun {
+		for _, step := range steps {
+			slog.Info("Dry run, post-import step not run", "step", step.Name)
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	clientOpts, _, err := clientOptions(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	client, err := mongo.Connect(ctx, clientOpts)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+	if err := pingServer(ctx, client, cfg.ConnectRetries); err != nil {
+		return err
+	}
+	db := client.Database(cfg.DBName)
+
+	for _, step := range steps {
+		start := time.Now()
+		if step.Command != nil {
+			if err := db.RunCommand(ctx, step.Command).Err(); err != nil {
+				return fmt.Errorf("post-import %s: %w", step.Name, err)
+			}
+			slog.Info("Post-import step done", "step", step.Name, "elapsed", time.Since(start).Round(time.Millisecond))
+			continue
+		}
+
+		collection := step.Collection
+		if collection == "" {
+			collection = cfg.CollectionName
+		}
+		cursor, err := db.Collection(collection).Aggregate(ctx, step.Pipeline)
+		if err != nil {
+			return fmt.Errorf("post-import %s: %w", step.Name, err)
+		}
+		// $merge and $out return nothing; other pipelines are only drained
+		documents := 0
+		for cursor.Next(ctx) {
+			documents++
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return fmt.Errorf("post-import %s: %w", step.Name, err)
+		}
+		slog.Info("Post-import step done", "step", step.Name, "collection", collection, "documents", documents, "elapsed", time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// Ask for confirmation before action, e.g. "seed", writes to a production
+// cluster, one PRODUCTION_URI_PATTERN matches
+func confirmProduction(cfg Config, action string) error {
+	if cfg.ProductionURIPattern == "" || cfg.Yes || cfg.DryRun {
+		return nil
+	}
+	pattern := regexp.MustCompile(cfg.ProductionURIPattern)
+	if !pattern.MatchString(cfg.MongoURI) && (cfg.SecretsBackend == "" || !pattern.MatchString(cfg.MongoURISecret)) {
+		return nil
+	}
+	return confirm(fmt.Sprintf("%s %s.%s, which matches PRODUCTION_URI_PATTERN", action, cfg.DBName, cfg.CollectionName))
+}
+
+// Ask for "yes" on the terminal before doing what, e.g. "drop db.places".
+// Without a terminal to ask on, the run needs --yes.
+func confirm(what string) error {
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		return fmt.Errorf("pass --yes to %s", what)
+	}
+	fmt.Fprintf(os.Stderr, "About to %s. Type yes to continue: ", what)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != "yes" {
+		return fmt.Errorf("not confirmed, nothing was written")
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/mattn/go-isatty"
+)
+
+// Progress bar showing row and insert throughput, elapsed time and the
+// byte-based ETA
+const progressTemplate pb.ProgressBarTemplate = `{{counters . }} {{bar . }} {{percent . }} {{rates . }} {{etime . }} {{rtime . "ETA %s"}}`
+
+// The same bar labelled with its file, for files processed in parallel
+const fileProgressTemplate = `{{string . "file"}} ` + progressTemplate
+
+func init() {
+	pb.RegisterElement("rates", pb.ElementFunc(func(state *pb.State, args ...string) string {
+		stats, ok := state.Get("stats").(*runStats)
+		if !ok {
+			return ""
+		}
+		return fmt.Sprintf("%.0f rows/s %.0f docs/s", stats.rate(stats.rowsRead.Load()), stats.rate(stats.inserted.Load()))
+	}), false)
+}
+
+// progress reports how far through the input the run is
+type progress interface {
+	// Update with the current byte offset in the input
+	update(offset int64)
+	finish()
+}
+
+// Pick a progress display: a bar on terminals, periodic log lines
+// otherwise, nothing when quiet. Files processed in parallel are labelled,
+// or drawn on the dashboard when there is one.
+func newProgress(cfg Config, total int64, stats *runStats) progress {
+	file := ""
+	if cfg.ParallelFiles > 1 {
+		file = cfg.CSVFile
+	}
+	switch {
+	case cfg.Quiet:
+		return quietProgress{}
+	case progressDashboard != nil:
+		return progressDashboard.add(cfg.CSVFile, total, stats)
+	case showBars():
+		return newBarProgress(total, stats, file)
+	default:
+		return &logProgress{
+			file:      file,
+			total:     total,
+			stats:     stats,
+			interval:  cfg.ProgressInterval,
+			everyRows: cfg.ProgressEveryRows,
+			lastAt:    time.Now(),
+		}
+	}
+}
+
+// barProgress draws a progress bar over the number of bytes read
+type barProgress struct {
+	bar *pb.ProgressBar
+}
+
+// Whether progress is drawn as bars, when stderr is a terminal
+func showBars() bool {
+	return isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd())
+}
+
+// Start a bar, labelled with the file if set, in the pool of parallel
+// files' bars when there is one
+func newBarProgress(total int64, stats *runStats, file string) *barProgress {
+	template := progressTemplate
+	if file != "" {
+		template = fileProgressTemplate
+	}
+	bar := template.New(0).
+		SetTotal(total).
+		Set(pb.Bytes, true).
+		Set("stats", stats).
+		Set("file", file)
+	if progressPool != nil {
+		progressPool.Add(bar)
+	} else {
+		bar.Start()
+	}
+	return &barProgress{bar: bar}
+}
+
+func (p *barProgress) update(offset int64) {
+	p.bar.SetCurrent(offset)
+}
+
+func (p *barProgress) finish() {
+	p.bar.SetCurrent(p.bar.Total())
+	p.bar.Finish()
+}
+
+// logProgress prints a progress line every interval and/or every N rows,
+// for CI, cron and container logs where a bar would be noise
+type logProgress struct {
+	file      string
+	total     int64
+	stats     *runStats
+	interval  time.Duration
+	everyRows int64
+
+	offset   int64
+	lastAt   time.Time
+	lastRows int64
+}
+
+func (p *logProgress) update(offset int64) {
+	p.offset = offset
+	rows := p.stats.rowsRead.Load()
+
+	due := p.interval > 0 && time.Since(p.lastAt) >= p.interval
+	if p.everyRows > 0 && rows-p.lastRows >= p.everyRows {
+		due = true
+	}
+	if due {
+		p.print()
+	}
+}
+
+func (p *logProgress) finish() {
+	p.offset = p.total
+	p.print()
+}
+
+func (p *logProgress) print() {
+	p.lastAt = time.Now()
+	p.lastRows = p.stats.rowsRead.Load()
+
+	elapsed := time.Since(p.stats.startedAt)
+	percent, eta := 0.0, "?"
+	if p.total > 0 && p.offset > 0 {
+		percent = float64(p.offset) / float64(p.total) * 100
+		remaining := time.Duration(float64(elapsed) * float64(p.total-p.offset) / float64(p.offset))
+		eta = remaining.Round(time.Second).String()
+	}
+
+	args := []any{
+		"percent", math.Round(percent*10) / 10,
+		"rowsRead", p.lastRows,
+		"inserted", p.stats.inserted.Load(),
+		"rejected", p.stats.rejected.Load(),
+		"rowsPerSecond", math.Round(p.stats.rate(p.lastRows)),
+		"docsPerSecond", math.Round(p.stats.rate(p.stats.inserted.Load())),
+		"elapsed", elapsed.Round(time.Second).String(),
+		"eta", eta,
+	}
+	if p.file != "" {
+		args = append([]any{"file", p.file}, args...)
+	}
+	slog.Info("Progress", args...)
+}
+
+// quietProgress shows nothing
+type quietProgress struct{}
+
+func (quietProgress) update(int64) {}
+func (quietProgress) finish()      {}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Header positions kept out of documents: every column not in
+// INCLUDE_COLUMNS, or those in EXCLUDE_COLUMNS. Nil when neither is set.
+func excludedColumns(cfg Config, header *Header) (map[int]bool, error) {
+	list, option := cfg.ExcludeColumns, "EXCLUDE_COLUMNS"
+	if cfg.IncludeColumns != "" {
+		list, option = cfg.IncludeColumns, "INCLUDE_COLUMNS"
+	}
+	if list == "" {
+		return nil, nil
+	}
+
+	listed := map[int]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		i, ok := header.Index(name)
+		if !ok {
+			return nil, fmt.Errorf("%s: column %q not found in header", option, name)
+		}
+		listed[i] = true
+	}
+	if option == "EXCLUDE_COLUMNS" {
+		return listed, nil
+	}
+
+	excluded := map[int]bool{}
+	for i := range header.Names {
+		if !listed[i] {
+			excluded[i] = true
+		}
+	}
+	return excluded, nil
+}
+
+// Leave the Place fields read from excluded columns empty, and drop geo
+// fields built from them. The placeId column can't be excluded, as resume
+// and retries key on it.
+func (c columns) exclude(excluded map[int]bool, geo []geoColumn) ([]geoColumn, error) {
+	for field, i := range c {
+		if !excluded[i] {
+			continue
+		}
+		if field == "placeId" {
+			return nil, fmt.Errorf("the placeId column can't be excluded")
+		}
+		delete(c, field)
+	}
+
+	kept := geo[:0]
+	for _, g := range geo {
+		if !excluded[g.latitude] && !excluded[g.longitude] {
+			kept = append(kept, g)
+		}
+	}
+	return kept, nil
+}
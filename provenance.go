@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// provenance names the fields documents are stamped with to trace them
+// back to their source row. Empty names aren't written.
+type provenance struct {
+	sourceFile  string
+	sourceLine  string
+	importRunID string
+	importedAt  string
+}
+
+// Parse the PROVENANCE_FIELDS renames, e.g. "sourceFile=_file,importedAt="
+// to rename one field and leave another out. Nil when provenance is off.
+func newProvenance(enabled bool, renames string) (*provenance, error) {
+	if !enabled {
+		return nil, nil
+	}
+	p := &provenance{sourceFile: "sourceFile", sourceLine: "sourceLine", importRunID: "importRunId", importedAt: "importedAt"}
+	fields := map[string]*string{
+		"sourceFile":  &p.sourceFile,
+		"sourceLine":  &p.sourceLine,
+		"importRunId": &p.importRunID,
+		"importedAt":  &p.importedAt,
+	}
+	for _, rename := range strings.Split(renames, ",") {
+		if strings.TrimSpace(rename) == "" {
+			continue
+		}
+		field, name, ok := strings.Cut(rename, "=")
+		target, known := fields[strings.TrimSpace(field)]
+		if !ok || !known {
+			return nil, fmt.Errorf("PROVENANCE_FIELDS: %q must be sourceFile, sourceLine, importRunId or importedAt=name", rename)
+		}
+		*target = strings.TrimSpace(name)
+	}
+
+	seen := map[string]bool{}
+	for _, name := range []string{p.sourceFile, p.sourceLine, p.importRunID, p.importedAt} {
+		if name == "" {
+			continue
+		}
+		if seen[name] || placeFields[name] || name == importIDField {
+			return nil, fmt.Errorf("PROVENANCE_FIELDS: %q clashes with another field", name)
+		}
+		seen[name] = true
+	}
+	return p, nil
+}
+
+// Stamp a batch document with where it came from, rowNumber being its data
+// row, 1 for the row after the header
+func (p *provenance) stamp(doc any, sourceFile string, rowNumber int64, importID string) any {
+	if p.sourceFile != "" {
+		doc = setDocumentField(doc, p.sourceFile, sourceFile)
+	}
+	if p.sourceLine != "" {
+		doc = setDocumentField(doc, p.sourceLine, rowNumber)
+	}
+	if p.importRunID != "" {
+		doc = setDocumentField(doc, p.importRunID, importID)
+	}
+	if p.importedAt != "" {
+		doc = setDocumentField(doc, p.importedAt, time.Now().UTC())
+	}
+	return doc
+}
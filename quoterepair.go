@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Lines a quoted field may run over before its opening quote is taken to be
+// a stray one
+const repairMaxLines = 100
+
+// quoteRepairer escapes stray quotes in records on their way to the csv
+// package, so rows with them parse: a quote in an unquoted field, or one in
+// a quoted field that isn't followed by the delimiter or the end of the
+// line, is doubled, quoting the field if it wasn't. A quoted field still
+// open after repairMaxLines lines or at the end of the input, or one running
+// over lines with stray quotes in it, is taken to start with a stray quote
+// and end at its delimiter. Records needing no repair pass through byte for
+// byte.
+type quoteRepairer struct {
+	r     *bufio.Reader
+	comma string
+	err   error
+
+	lines  []string // Lines read ahead of the next record
+	out    []byte   // Repaired text not read yet
+	line   int      // Lines taken so far
+	in     int64    // Bytes of input taken so far
+	outLen int64    // Bytes of output produced so far
+
+	// Offsets in the output from which on the input lags it by delta
+	shifts []offsetShift
+}
+
+type offsetShift struct {
+	at    int64
+	delta int64
+}
+
+func newQuoteRepairer(r io.Reader, comma rune) *quoteRepairer {
+	return &quoteRepairer{r: bufio.NewReaderSize(r, 64<<10), comma: string(comma)}
+}
+
+func (q *quoteRepairer) Read(p []byte) (int, error) {
+	for len(q.out) == 0 {
+		if err := q.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, q.out)
+	q.out = q.out[n:]
+	return n, nil
+}
+
+// Offset in the input of an offset between records in the output. Offsets
+// must be asked for in order.
+func (q *quoteRepairer) inputOffset(offset int64) int64 {
+	for len(q.shifts) > 1 && q.shifts[1].at <= offset {
+		q.shifts = q.shifts[1:]
+	}
+	if len(q.shifts) > 0 && q.shifts[0].at <= offset {
+		return offset - q.shifts[0].delta
+	}
+	return offset
+}
+
+// Repair the next record into out
+func (q *quoteRepairer) next() error {
+	text, err := q.nextLine()
+	if text == "" {
+		return err
+	}
+	lines := []string{text}
+	repaired, open := repairRecord(text, q.comma, false)
+	for open && len(lines) < repairMaxLines {
+		line, _ := q.nextLine()
+		if line == "" {
+			break
+		}
+		lines = append(lines, line)
+		text += line
+		repaired, open = repairRecord(text, q.comma, false)
+	}
+	// A quoted field left open, or running over lines but needing repair,
+	// more likely starts with a stray quote than holds line breaks: give
+	// back the lines after the first and repair it on its own
+	if open || len(lines) > 1 && repaired != text {
+		q.lines = append(lines[1:], q.lines...)
+		lines, text = lines[:1], lines[0]
+		repaired, _ = repairRecord(text, q.comma, true)
+	}
+
+	if repaired != text {
+		slog.Warn("Stray quotes escaped", "line", q.line+1)
+	}
+	q.line += len(lines)
+	q.in += int64(len(text))
+	q.outLen += int64(len(repaired))
+	last := int64(0)
+	if len(q.shifts) > 0 {
+		last = q.shifts[len(q.shifts)-1].delta
+	}
+	if delta := q.outLen - q.in; delta != last {
+		q.shifts = append(q.shifts, offsetShift{at: q.outLen, delta: delta})
+	}
+	q.out = []byte(repaired)
+	return nil
+}
+
+// The next line with its line ending, from those read ahead first; "" once
+// the input is used up
+func (q *quoteRepairer) nextLine() (string, error) {
+	if len(q.lines) > 0 {
+		line := q.lines[0]
+		q.lines = q.lines[1:]
+		return line, nil
+	}
+	if q.err != nil {
+		return "", q.err
+	}
+	line, err := q.r.ReadString('\n')
+	q.err = err
+	if line == "" {
+		return "", err
+	}
+	return line, nil
+}
+
+// The record with its stray quotes escaped, or open when it ends inside a
+// quoted field and may go on over the next line. With closeAtEnd a quoted
+// field left open is read as an unquoted one instead.
+func repairRecord(text, comma string, closeAtEnd bool) (repaired string, open bool) {
+	body := text
+	if strings.HasSuffix(body, "\n") {
+		body = strings.TrimSuffix(strings.TrimSuffix(body, "\n"), "\r")
+	}
+
+	var fields []string
+	var quoted []bool
+	stray := false
+	rest := body
+	for {
+		field, isQuoted, closed := "", false, false
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			for i := 1; ; {
+				q := strings.IndexByte(rest[i:], '"')
+				if q < 0 {
+					break
+				}
+				q += i
+				after := rest[q+1:]
+				switch {
+				case strings.HasPrefix(after, `"`):
+					b.WriteString(rest[i : q+1])
+					i = q + 2
+					continue
+				case after == "" || strings.HasPrefix(after, comma):
+					b.WriteString(rest[i:q])
+					field, isQuoted, closed, rest = b.String(), true, true, after
+				default:
+					b.WriteString(rest[i : q+1])
+					i = q + 1
+					stray = true
+					continue
+				}
+				break
+			}
+			if !closed && !closeAtEnd {
+				return "", true
+			}
+			if !closed {
+				stray = true
+			}
+		}
+		if !closed {
+			end := strings.Index(rest, comma)
+			if end < 0 {
+				end = len(rest)
+			}
+			field, rest = rest[:end], rest[end:]
+			if strings.Contains(field, `"`) {
+				stray = true
+			}
+		}
+		fields, quoted = append(fields, field), append(quoted, isQuoted)
+		if rest == "" {
+			break
+		}
+		rest = rest[len(comma):]
+	}
+	if !stray {
+		return text, false
+	}
+
+	var b strings.Builder
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteString(comma)
+		}
+		if quoted[i] || strings.ContainsAny(field, "\"\r\n") || strings.Contains(field, comma) {
+			b.WriteString(`"` + strings.ReplaceAll(field, `"`, `""`) + `"`)
+		} else {
+			b.WriteString(field)
+		}
+	}
+	b.WriteString(text[len(body):])
+	return b.String(), false
+}
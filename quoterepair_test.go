@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRepairRecord(t *testing.T) {
+	tests := []struct {
+		text       string
+		closeAtEnd bool
+		want       string
+		open       bool
+	}{
+		// Nothing to repair
+		{text: "1,plain\n", want: "1,plain\n"},
+		{text: "1,\"a, b\"\r\n", want: "1,\"a, b\"\r\n"},
+		{text: "1,\"say \"\"hi\"\"\"\n", want: "1,\"say \"\"hi\"\"\"\n"},
+		{text: "1,\"\"", want: "1,\"\""},
+
+		// Stray quotes
+		{text: "1,Joe \"The Boss\" Smith\n", want: "1,\"Joe \"\"The Boss\"\" Smith\"\n"},
+		{text: "1,\"Joe \"The Boss\" Smith\"\n", want: "1,\"Joe \"\"The Boss\"\" Smith\"\n"},
+		{text: "1,5\" pipe\r\n", want: "1,\"5\"\" pipe\"\r\n"},
+		{text: "\"a\"b,c\n", open: true},
+		{text: "\"a\"b,c\n", closeAtEnd: true, want: "\"\"\"a\"\"b\",c\n"},
+
+		// A quoted field running on past the line
+		{text: "1,\"two\n", open: true},
+		{text: "1,\"two\nlines\"\n", want: "1,\"two\nlines\"\n"},
+		{text: "1,\"open\n", closeAtEnd: true, want: "1,\"\"\"open\"\n"},
+	}
+	for _, tt := range tests {
+		got, open := repairRecord(tt.text, ",", tt.closeAtEnd)
+		if got != tt.want || open != tt.open {
+			t.Errorf("repairRecord(%q, %v) = %q, %v, want %q, %v", tt.text, tt.closeAtEnd, got, open, tt.want, tt.open)
+		}
+	}
+}
+
+func TestQuoteRepairer(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    [][]string
+		errLine []int // Lines of rows rejected
+	}{
+		{
+			name:  "clean",
+			input: "id,name\n1,plain\n2,\"a, b\"\n",
+			want:  [][]string{{"id", "name"}, {"1", "plain"}, {"2", "a, b"}},
+		},
+		{
+			name:  "stray quotes",
+			input: "id,name\n1,Joe \"The Boss\" Smith\n2,\"Joe \"The Boss\" Smith\"\n3,5\" pipe\r\n",
+			want:  [][]string{{"id", "name"}, {"1", "Joe \"The Boss\" Smith"}, {"2", "Joe \"The Boss\" Smith"}, {"3", "5\" pipe"}},
+		},
+		{
+			name:  "quoted line break",
+			input: "id,name\n1,\"two\nlines\"\n2,x\n",
+			want:  [][]string{{"id", "name"}, {"1", "two\nlines"}, {"2", "x"}},
+		},
+		{
+			// A field running over lines with stray quotes in it is taken
+			// to open with a stray quote, leaving its next line on its own
+			name:    "stray quotes over lines",
+			input:   "id,name\n1,\"two\n\"lines\" here\"\n2,x\n",
+			want:    [][]string{{"id", "name"}, {"1", "\"two"}, {"2", "x"}},
+			errLine: []int{3},
+		},
+		{
+			name:  "left open",
+			input: "id,name\n1,\"open\n2,x\n",
+			want:  [][]string{{"id", "name"}, {"1", "\"open"}, {"2", "x"}},
+		},
+		{
+			// Taking the quote as stray splits the field at its delimiter,
+			// leaving the row a field too many to be repaired
+			name:    "unrepairable",
+			input:   "id,name\n1,\"a,b\n2,x\n",
+			want:    [][]string{{"id", "name"}, {"2", "x"}},
+			errLine: []int{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := csv.NewReader(newQuoteRepairer(strings.NewReader(tt.input), ','))
+			var got [][]string
+			var errLines []int
+			for {
+				record, err := reader.Read()
+				if err == io.EOF {
+					break
+				}
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) {
+					errLines = append(errLines, parseErr.Line)
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, record)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("records = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(errLines, tt.errLine) {
+				t.Errorf("rejected lines %v, want %v", errLines, tt.errLine)
+			}
+		})
+	}
+}
+
+// Offsets after each record map back to where the next one starts in the
+// input, repaired records being longer than their text
+func TestQuoteRepairerOffsets(t *testing.T) {
+	input := "id,name\n1,Joe \"The Boss\" Smith\n2,plain\n3,5\" pipe\n4,\"two\nlines\"\n"
+	want := []int64{8, 31, 39, 49, int64(len(input))}
+
+	repairer := newQuoteRepairer(strings.NewReader(input), ',')
+	reader := csv.NewReader(repairer)
+	var got []int64
+	for {
+		if _, err := reader.Read(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, repairer.inputOffset(reader.InputOffset()))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("offsets %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// targetRecord is what one target holds of the dataset
+type targetRecord struct {
+	Target     string   `json:"target"` // URI with the password redacted
+	Database   string   `json:"database"`
+	Collection string   `json:"collection"`
+	Count      int64    `json:"count"`
+	Checksum   string   `json:"checksum"` // Over the sampled documents
+	Missing    []string `json:"missing"`
+	Mismatched []string `json:"mismatched"`
+}
+
+// reconciliationRecord compares the datasets held by several targets
+type reconciliationRecord struct {
+	Consistent   bool           `json:"consistent"`
+	ReconciledAt time.Time      `json:"reconciledAt"`
+	Key          string         `json:"key"`
+	Sampled      int            `json:"sampled"`
+	Targets      []targetRecord `json:"targets"`
+	Divergences  []string       `json:"divergences"`
+}
+
+// The reconcile subcommand: check that every target received the same
+// dataset by comparing document counts and checksums of sampled documents
+func runReconcile(args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	output := fs.String("o", "", "write the reconciliation record to this file as well as stdout")
+	collection := fs.String("collection", "locations", "collection to compare in each target")
+	key := fs.String("key", "placeId", "field identifying a document across targets")
+	sample := fs.Int("sample", 1000, "number of documents, sampled from the first target, to compare by checksum")
+	ignore := fs.String("ignore", "_id,mergedAt,importId", "comma separated fields left out of checksums, e.g. ones set at write time")
+	timeout := fs.Duration("timeout", 5*time.Minute, "time allowed for the whole reconciliation")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s reconcile [flags] mongodb://host/db...\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Each target is a MongoDB URI whose path names the database.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return fmt.Errorf("at least two targets are needed")
+	}
+
+	ignored := map[string]bool{}
+	for _, field := range strings.Split(*ignore, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			ignored[field] = true
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var collections []*mongo.Collection
+	record := reconciliationRecord{ReconciledAt: time.Now(), Key: *key, Divergences: []string{}}
+	for _, target := range fs.Args() {
+		uri, err := url.Parse(target)
+		if err != nil {
+			return fmt.Errorf("target %q: %w", target, err)
+		}
+		database := strings.TrimPrefix(uri.Path, "/")
+		if database == "" {
+			return fmt.Errorf("target %s: no database in the URI path", uri.Redacted())
+		}
+
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(target))
+		if err != nil {
+			return fmt.Errorf("target %s: %w", uri.Redacted(), err)
+		}
+		defer client.Disconnect(context.Background())
+
+		collections = append(collections, client.Database(database).Collection(*collection))
+		record.Targets = append(record.Targets, targetRecord{Target: uri.Redacted(), Database: database, Collection: *collection})
+	}
+
+	// Counts
+	for i, coll := range collections {
+		count, err := coll.CountDocuments(ctx, bson.D{})
+		if err != nil {
+			return fmt.Errorf("counting %s: %w", record.Targets[i].Target, err)
+		}
+		record.Targets[i].Count = count
+		if count != record.Targets[0].Count {
+			record.Divergences = append(record.Divergences, fmt.Sprintf("%s has %d documents, %s has %d",
+				record.Targets[i].Target, count, record.Targets[0].Target, record.Targets[0].Count))
+		}
+	}
+
+	// Checksums of the same sampled documents in every target
+	keys, err := sampleKeys(ctx, collections[0], *key, *sample)
+	if err != nil {
+		return fmt.Errorf("sampling %s: %w", record.Targets[0].Target, err)
+	}
+	record.Sampled = len(keys)
+
+	var reference map[string]string
+	for i, coll := range collections {
+		hashes, err := documentHashes(ctx, coll, *key, keys, ignored)
+		if err != nil {
+			return fmt.Errorf("checksumming %s: %w", record.Targets[i].Target, err)
+		}
+		target := &record.Targets[i]
+		target.Checksum = combinedChecksum(keys, hashes)
+		target.Missing, target.Mismatched = []string{}, []string{}
+		if i == 0 {
+			reference = hashes
+			continue
+		}
+
+		for _, k := range keys {
+			hash, ok := hashes[k]
+			switch {
+			case !ok:
+				target.Missing = append(target.Missing, k)
+			case hash != reference[k]:
+				target.Mismatched = append(target.Mismatched, k)
+			}
+		}
+		if len(target.Missing) > 0 || len(target.Mismatched) > 0 {
+			record.Divergences = append(record.Divergences, fmt.Sprintf("%s is missing %d and differs in %d of %d sampled documents",
+				target.Target, len(target.Missing), len(target.Mismatched), len(keys)))
+		}
+	}
+	record.Consistent = len(record.Divergences) == 0
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	os.Stdout.Write(data)
+	if *output != "" {
+		if err := os.WriteFile(*output, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	if !record.Consistent {
+		return fmt.Errorf("targets diverge: %s", strings.Join(record.Divergences, "; "))
+	}
+	return nil
+}
+
+// Key values of up to n randomly sampled documents, sorted
+func sampleKeys(ctx context.Context, coll *mongo.Collection, key string, n int) ([]string, error) {
+	cursor, err := coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: key, Value: bson.D{{Key: "$exists", Value: true}}}}}},
+		{{Key: "$sample", Value: bson.D{{Key: "size", Value: n}}}},
+		{{Key: "$project", Value: bson.D{{Key: "_id", Value: 0}, {Key: key, Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	keys := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		k := fmt.Sprint(doc[key])
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// SHA-256 of each document with one of the given keys, by key. Keys are
+// compared as strings, so only string key fields are matched.
+func documentHashes(ctx context.Context, coll *mongo.Collection, key string, keys []string, ignored map[string]bool) (map[string]string, error) {
+	cursor, err := coll.Find(ctx, bson.D{{Key: key, Value: bson.D{{Key: "$in", Value: keys}}}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	hashes := make(map[string]string, len(keys))
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+
+		var k string
+		kept := doc[:0]
+		for _, elem := range doc {
+			if elem.Key == key {
+				k = fmt.Sprint(elem.Value)
+			}
+			if !ignored[elem.Key] {
+				kept = append(kept, elem)
+			}
+		}
+		data, err := bson.Marshal(kept)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		hashes[k] = hex.EncodeToString(sum[:])
+	}
+	return hashes, cursor.Err()
+}
+
+// One checksum over the hashes of the sampled documents, in key order
+func combinedChecksum(keys []string, hashes map[string]string) string {
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s\t%s\n", k, hashes[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Suffix of the file storing rejected rows, with the reason in a trailing
+// column. Large rejects roll over into numbered parts (_rejects.2.csv, ...).
+const rejectsFile = "_rejects.csv"
+
+// Rejects file of the previous run, consulted to retry its rows
+const previousRejectsFile = "_rejects.prev.csv"
+
+// Rows a dry run would reject, kept apart from the real rejects
+const dryRunRejectsFile = "_dryrun_rejects.csv"
+
+// rejectsWriter appends rejected rows to the rejects file
+type rejectsWriter struct {
+	file       *rollingFile
+	writer     *csv.Writer
+	header     []string
+	needHeader bool
+	count      int
+}
+
+func newRejectsWriter(cfg Config, header []string) *rejectsWriter {
+	name := cfg.outputs.rejects
+	if cfg.DryRun {
+		name = cfg.outputs.dryRunRejects
+	}
+	file := newRollingFile(name, cfg.RejectsCompress, cfg.RejectsMaxSize, cfg.RejectsMaxFiles)
+	return &rejectsWriter{
+		file:       file,
+		writer:     csv.NewWriter(file),
+		header:     header,
+		needHeader: true,
+	}
+}
+
+// Write a rejected row, starting every file part with the header
+func (w *rejectsWriter) write(record []string, reason string) error {
+	if w.file.full() {
+		w.writer.Flush()
+		if err := w.writer.Error(); err != nil {
+			return err
+		}
+		if err := w.file.roll(); err != nil {
+			return err
+		}
+		w.needHeader = true
+	}
+
+	if w.needHeader {
+		if err := w.writer.Write(append(append([]string{}, w.header...), "error")); err != nil {
+			return err
+		}
+		w.needHeader = false
+	}
+
+	w.count++
+	return w.writer.Write(append(append([]string{}, record...), reason))
+}
+
+func (w *rejectsWriter) Close() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// Move the last run's rejects aside and return the PlaceIDs it rejected,
+// so they can be retried even though they are behind the resume point. A
+// dry run reads them in place.
+func loadPreviousRejects(files outputNames, placeIDColumn int, dryRun bool) (map[string]bool, error) {
+	previous := files.rejects
+	if !dryRun {
+		if err := rotatePreviousRejects(files); err != nil {
+			return nil, err
+		}
+		previous = files.previousRejects
+	}
+
+	parts, err := rollingParts(previous)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := map[string]bool{}
+	for _, part := range parts {
+		if err := readRejectedIDs(part.path, placeIDColumn, retry); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", part.path, err)
+		}
+	}
+	return retry, nil
+}
+
+// Replace the previous rejects with the last run's, leaving none when it
+// rejected nothing, so rows retried successfully aren't retried again
+func rotatePreviousRejects(files outputNames) error {
+	current, err := rollingParts(files.rejects)
+	if err != nil {
+		return err
+	}
+
+	previous, err := rollingParts(files.previousRejects)
+	if err != nil {
+		return err
+	}
+	for _, part := range previous {
+		if err := os.Remove(part.path); err != nil {
+			return err
+		}
+	}
+
+	for _, part := range current {
+		if err := os.Rename(part.path, partName(files.previousRejects, part.n, part.compressed)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add the PlaceIDs in a rejects file part to ids
+func readRejectedIDs(path string, placeIDColumn int, ids map[string]bool) error {
+	file, err := openPart(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	if _, err := reader.Read(); err != nil { // Header
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if placeIDColumn < len(record) {
+			ids[record[placeIDColumn]] = true
+		}
+	}
+}
+
+// rowError is the reason a single row was rejected
+type rowError struct {
+	Kind string
+	Err  error
+}
+
+func (e *rowError) Error() string { return e.Err.Error() }
+func (e *rowError) Unwrap() error { return e.Err }
+
+// Kind of a rejection error, for counting errors by type
+func errorKind(err error) string {
+	var rowErr *rowError
+	if errors.As(err, &rowErr) {
+		return rowErr.Kind
+	}
+	return "invalid_row"
+}
+
+// Split a failed InsertMany into per-document errors. Errors that are not
+// per-document write errors are returned as-is.
+func rejectedDocuments(err error) (map[int]error, error) {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return nil, err
+	}
+
+	rowErrs := make(map[int]error, len(bulkErr.WriteErrors))
+	for _, writeErr := range bulkErr.WriteErrors {
+		kind := fmt.Sprintf("write_error_%d", writeErr.Code)
+		switch {
+		case mongo.IsDuplicateKeyError(writeErr):
+			kind = "duplicate_key"
+		case writeErr.Code == 121:
+			kind = "document_validation"
+		}
+		rowErrs[writeErr.Index] = &rowError{Kind: kind, Err: errors.New(writeErr.Message)}
+	}
+	return rowErrs, nil
+}
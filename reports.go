@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Upload the summary, audit log and rejects files of a finished run to the
+// configured object store, under <prefix>/<timestamp>_<importId>/
+func uploadReports(ctx context.Context, cfg Config, stats *runStats) error {
+	store, err := newObjectStore(ctx, cfg.ReportsUploadURL, cfg.ReportsUploadEndpoint)
+	if err != nil {
+		return err
+	}
+
+	files := []string{cfg.outputs.summary}
+	for _, name := range []string{cfg.outputs.audit, cfg.outputs.rejects} {
+		parts, err := rollingParts(name)
+		if err != nil {
+			return err
+		}
+		for _, part := range parts {
+			files = append(files, part.path)
+		}
+	}
+
+	folder := reportsFolder(stats)
+	var errs []error
+	for _, file := range files {
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		key := store.key(folder, filepath.Base(file))
+		if err := store.putFile(ctx, key, file); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		slog.Info("Uploaded report", "file", file, "bucket", store.bucket, "key", key)
+	}
+	return errors.Join(errs...)
+}
+
+// Folder a run's reports are uploaded to, under the upload prefix
+func reportsFolder(stats *runStats) string {
+	return stats.startedAt.UTC().Format("20060102T150405Z") + "_" + stats.importID
+}
+
+// Upload the run's reports if configured, logging rather than failing
+// the run when the upload doesn't work
+func uploadReportsIfConfigured(cfg Config, stats *runStats) {
+	if cfg.ReportsUploadURL == "" || cfg.DryRun {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if err := uploadReports(ctx, cfg, stats); err != nil {
+		slog.Error("Error uploading reports", "error", err)
+	}
+}
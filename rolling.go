@@ -0,0 +1,219 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rollingFile writes numbered parts (name.csv, name.2.csv, name.3.csv, ...),
+// optionally gzip-compressed. The owner calls roll at a record boundary once
+// full reports the current part has reached maxSize bytes on disk; at most
+// maxParts parts are kept. Files kept across runs, like logs, continue after
+// their last part rather than starting over.
+type rollingFile struct {
+	name     string
+	compress bool
+	maxSize  int64
+	maxParts int
+
+	part    int
+	file    *os.File
+	gz      *gzip.Writer
+	size    int64
+	appends bool
+}
+
+func newRollingFile(name string, compress bool, maxSize int64, maxParts int) *rollingFile {
+	return &rollingFile{name: name, compress: compress, maxSize: maxSize, maxParts: maxParts}
+}
+
+// A rolling file appended to from its last existing part, a gzip part
+// getting a further gzip member
+func appendRollingFile(name string, compress bool, maxSize int64, maxParts int) (*rollingFile, error) {
+	r := &rollingFile{name: name, compress: compress, maxSize: maxSize, maxParts: maxParts, appends: true}
+	parts, err := rollingParts(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) > 0 {
+		last := parts[len(parts)-1]
+		r.part = last.n
+		if last.compressed == compress {
+			r.part--
+		}
+	}
+	return r, nil
+}
+
+// Write to the current part, creating the first one on first use
+func (r *rollingFile) Write(p []byte) (int, error) {
+	if r.file == nil {
+		if err := r.open(r.part + 1); err != nil {
+			return 0, err
+		}
+	}
+	if r.gz != nil {
+		return r.gz.Write(p)
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Write out what the gzip writer holds, so a part being appended to can be
+// read up to the last record
+func (r *rollingFile) flush() error {
+	if r.gz != nil {
+		return r.gz.Flush()
+	}
+	return nil
+}
+
+// Whether the current part has reached its maximum size
+func (r *rollingFile) full() bool {
+	return r.file != nil && r.maxSize > 0 && r.size >= r.maxSize
+}
+
+// Close the current part and start the next, dropping the oldest part when
+// there are too many
+func (r *rollingFile) roll() error {
+	next := r.part + 1
+	if err := r.Close(); err != nil {
+		return err
+	}
+	if err := r.open(next); err != nil {
+		return err
+	}
+	if r.maxParts > 0 && next > r.maxParts {
+		os.Remove(partName(r.name, next-r.maxParts, r.compress))
+	}
+	return nil
+}
+
+func (r *rollingFile) open(part int) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if r.appends {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(partName(r.name, part, r.compress), flags, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.part, r.size = file, part, info.Size()
+	if r.compress {
+		r.gz = gzip.NewWriter(&countingWriter{w: file, n: &r.size})
+	}
+	return nil
+}
+
+func (r *rollingFile) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	var err error
+	if r.gz != nil {
+		err = r.gz.Close()
+		r.gz = nil
+	}
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	r.file = nil
+	return err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// Name of part n of a rolling file, the first part keeping the plain name
+func partName(name string, n int, compress bool) string {
+	if n > 1 {
+		ext := filepath.Ext(name)
+		name = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	if compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// rollingPart is an existing part of a rolling file
+type rollingPart struct {
+	path       string
+	n          int
+	compressed bool
+}
+
+// Find the existing parts of a rolling file, compressed or not, in part order
+func rollingParts(name string) ([]rollingPart, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	var parts []rollingPart
+	for _, pattern := range []string{name, name + ".gz", stem + ".*" + ext, stem + ".*" + ext + ".gz"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			compressed := strings.HasSuffix(match, ".gz")
+			number := strings.TrimSuffix(strings.TrimSuffix(match, ".gz"), ext)
+			if number == stem {
+				parts = append(parts, rollingPart{path: match, n: 1, compressed: compressed})
+			} else if n, err := strconv.Atoi(strings.TrimPrefix(number, stem+".")); err == nil && n > 1 {
+				parts = append(parts, rollingPart{path: match, n: n, compressed: compressed})
+			}
+		}
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].n < parts[j].n })
+	return parts, nil
+}
+
+// Open a part for reading, decompressing gzip parts
+func openPart(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &gzipReadCloser{Reader: gz, file: file}, nil
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
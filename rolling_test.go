@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The rows of each existing part of a rolling CSV file, by part number
+func readParts(t *testing.T, name string) map[int][][]string {
+	t.Helper()
+	parts, err := rollingParts(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := map[int][][]string{}
+	for _, part := range parts {
+		r, err := openPart(part.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(r).ReadAll()
+		r.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %v", part.path, err)
+		}
+		rows[part.n] = records
+	}
+	return rows
+}
+
+func TestRejectsRolling(t *testing.T) {
+	tests := []struct {
+		name     string
+		compress bool
+		maxSize  int64
+		maxParts int
+		parts    []int // Part numbers kept
+	}{
+		{name: "one part", parts: []int{1}},
+		{name: "rolled", maxSize: 1, parts: []int{1, 2, 3, 4, 5}},
+		{name: "rolled and compressed", compress: true, maxSize: 1, parts: []int{1, 2, 3, 4, 5}},
+		{name: "oldest parts dropped", maxSize: 1, maxParts: 2, parts: []int{4, 5}},
+		{name: "compressed, oldest parts dropped", compress: true, maxSize: 1, maxParts: 3, parts: []int{3, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{RejectsCompress: tt.compress, RejectsMaxSize: tt.maxSize, RejectsMaxFiles: tt.maxParts}
+			cfg.outputs = newOutputNames(filepath.Join(t.TempDir(), "places"))
+			w := newRejectsWriter(cfg, []string{"placeId", "address"})
+			for i := 1; i <= 5; i++ {
+				if err := w.write([]string{fmt.Sprintf("p%d", i), "Road"}, "invalid_coordinates"); err != nil {
+					t.Fatal(err)
+				}
+				// Rolling happens once the part is on disk, as between batches
+				w.writer.Flush()
+				if err := w.file.flush(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			rows := readParts(t, cfg.outputs.rejects)
+			var kept []int
+			for n := 1; n <= 5; n++ {
+				if _, ok := rows[n]; ok {
+					kept = append(kept, n)
+				}
+			}
+			if !reflect.DeepEqual(kept, tt.parts) {
+				t.Fatalf("parts kept = %v, want %v", kept, tt.parts)
+			}
+			for _, n := range kept {
+				records := rows[n]
+				if len(records) < 2 || !reflect.DeepEqual(records[0], []string{"placeId", "address", "error"}) {
+					t.Errorf("part %d = %q, want the header then rows", n, records)
+				}
+			}
+			if last := rows[kept[len(kept)-1]]; !reflect.DeepEqual(last[len(last)-1], []string{"p5", "Road", "invalid_coordinates"}) {
+				t.Errorf("last row = %q, want p5's", last[len(last)-1])
+			}
+		})
+	}
+}
+
+func TestAppendRollingFile(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "places_audit.csv")
+			for run := 1; run <= 2; run++ {
+				f, err := appendRollingFile(name, compress, 0, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := io.WriteString(f, fmt.Sprintf("run%d\n", run)); err != nil {
+					t.Fatal(err)
+				}
+				if err := f.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Each run appends to the same part, a gzip member apiece
+			rows := readParts(t, name)
+			if want := map[int][][]string{1: {{"run1"}, {"run2"}}}; !reflect.DeepEqual(rows, want) {
+				t.Errorf("parts = %q, want %q", rows, want)
+			}
+		})
+	}
+}
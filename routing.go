@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// routeTarget is a collection rows can be routed to
+type routeTarget struct {
+	Database   string
+	Collection string
+}
+
+func (t routeTarget) String() string {
+	return t.Database + "." + t.Collection
+}
+
+// router sends each row to the collection ROUTES gives for its value in
+// ROUTE_COLUMN, matched case-insensitively, or to the fallback: the "*"
+// route, else the configured collection
+type router struct {
+	column   int
+	routes   map[string]routeTarget
+	fallback routeTarget
+
+	// Rows routed to each target
+	counts map[routeTarget]int64
+}
+
+// Route rows by their ROUTE_COLUMN value. Nil without a ROUTE_COLUMN.
+func newRouter(cfg Config, header *Header, cols columns) (*router, error) {
+	if cfg.RouteColumn == "" {
+		return nil, nil
+	}
+	i, ok := header.Index(cfg.RouteColumn)
+	if !ok {
+		i, ok = cols[cfg.RouteColumn]
+	}
+	if !ok {
+		return nil, fmt.Errorf("ROUTE_COLUMN: no column %q", cfg.RouteColumn)
+	}
+
+	routes, fallback, err := parseRoutes(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &router{column: i, routes: routes, fallback: fallback, counts: map[routeTarget]int64{}}, nil
+}
+
+// Parse ROUTES, e.g. "Dhaka=dhaka_places,Chattogram=ctg.places,*=places",
+// each target a collection in DB_NAME or a database.collection, into the
+// targets by lowercased value and the fallback
+func parseRoutes(cfg Config) (map[string]routeTarget, routeTarget, error) {
+	routes := map[string]routeTarget{}
+	fallback := routeTarget{Database: cfg.DBName, Collection: cfg.CollectionName}
+	for _, rule := range strings.Split(cfg.Routes, ",") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		value, name, _ := strings.Cut(rule, "=")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fallback, fmt.Errorf("ROUTES: %q must be value=collection or value=database.collection", rule)
+		}
+		target := routeTarget{Database: cfg.DBName, Collection: name}
+		if database, collection, ok := strings.Cut(name, "."); ok {
+			target = routeTarget{Database: database, Collection: collection}
+		}
+		if value = strings.ToLower(strings.TrimSpace(value)); value == "*" {
+			fallback = target
+		} else {
+			routes[value] = target
+		}
+	}
+	return routes, fallback, nil
+}
+
+// Every collection a run writes to: the configured one, and with a
+// ROUTE_COLUMN those of ROUTES
+func writtenTargets(cfg Config) ([]routeTarget, error) {
+	targets := []routeTarget{{Database: cfg.DBName, Collection: cfg.CollectionName}}
+	if cfg.RouteColumn == "" {
+		return targets, nil
+	}
+	routes, fallback, err := parseRoutes(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r := &router{routes: routes, fallback: fallback}
+	for _, target := range r.targets() {
+		if target != targets[0] {
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+// Target of a row
+func (r *router) route(record []string) routeTarget {
+	value := ""
+	if r.column < len(record) {
+		value = strings.ToLower(strings.TrimSpace(record[r.column]))
+	}
+	target, ok := r.routes[value]
+	if !ok {
+		target = r.fallback
+	}
+	r.counts[target]++
+	return target
+}
+
+// Every collection rows can be routed to, fallback first
+func (r *router) targets() []routeTarget {
+	seen := map[routeTarget]bool{r.fallback: true}
+	var routed []routeTarget
+	for _, target := range r.routes {
+		if !seen[target] {
+			seen[target] = true
+			routed = append(routed, target)
+		}
+	}
+	sort.Slice(routed, func(i, j int) bool { return routed[i].String() < routed[j].String() })
+	return append([]routeTarget{r.fallback}, routed...)
+}
+
+// Write a batch, each document to the collection of its target. Documents
+// MongoDB rejects come back as one mongo.BulkWriteException indexing into
+// the whole batch.
+func (r *router) write(ctx context.Context, client *mongo.Client, opts *options.CollectionOptions, mode string, batch []any, targets []routeTarget) (int64, error) {
+	groups := map[routeTarget][]int{}
+	var order []routeTarget
+	for i, target := range targets {
+		if _, ok := groups[target]; !ok {
+			order = append(order, target)
+		}
+		groups[target] = append(groups[target], i)
+	}
+
+	var unmatched int64
+	var rejected mongo.BulkWriteException
+	for _, target := range order {
+		indexes := groups[target]
+		docs := make([]any, len(indexes))
+		for j, i := range indexes {
+			docs[j] = batch[i]
+		}
+		n, err := writeBatch(ctx, client.Database(target.Database).Collection(target.Collection, opts), mode, docs)
+		unmatched += n
+
+		var bulkErr mongo.BulkWriteException
+		if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+			for _, writeErr := range bulkErr.WriteErrors {
+				writeErr.Index = indexes[writeErr.Index]
+				rejected.WriteErrors = append(rejected.WriteErrors, writeErr)
+			}
+		} else if err != nil {
+			return unmatched, fmt.Errorf("writing to %s: %w", target, err)
+		}
+	}
+	if len(rejected.WriteErrors) > 0 {
+		return unmatched, rejected
+	}
+	return unmatched, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	header, err := newHeader([]string{"placeId", "address", "town"}, duplicateHeadersRename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols := columns{"placeId": 0, "address": 1, "city": 2}
+	tests := []struct {
+		name   string
+		column string
+		routes string
+		record []string
+		want   routeTarget
+		err    bool
+	}{
+		{name: "header column", column: "town", routes: "Dhaka=dhaka_places", record: []string{"p1", "", "Dhaka"}, want: routeTarget{"seed", "dhaka_places"}},
+		{name: "place field", column: "city", routes: "Dhaka=dhaka_places", record: []string{"p1", "", "Dhaka"}, want: routeTarget{"seed", "dhaka_places"}},
+		{name: "case and space", column: "town", routes: " dhaka = dhaka_places", record: []string{"p1", "", "  DHAKA "}, want: routeTarget{"seed", "dhaka_places"}},
+		{name: "other database", column: "town", routes: "Chattogram=ctg.places", record: []string{"p1", "", "Chattogram"}, want: routeTarget{"ctg", "places"}},
+		{name: "unrouted value", column: "town", routes: "Dhaka=dhaka_places", record: []string{"p1", "", "Sylhet"}, want: routeTarget{"seed", "places"}},
+		{name: "fallback route", column: "town", routes: "Dhaka=dhaka_places,*=other", record: []string{"p1", "", "Sylhet"}, want: routeTarget{"seed", "other"}},
+		{name: "short record", column: "town", routes: "Dhaka=dhaka_places", record: []string{"p1"}, want: routeTarget{"seed", "places"}},
+		{name: "unknown column", column: "district", routes: "Dhaka=dhaka_places", err: true},
+		{name: "route without a collection", column: "town", routes: "Dhaka=", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newRouter(Config{DBName: "seed", CollectionName: "places", RouteColumn: tt.column, Routes: tt.routes}, header, cols)
+			if tt.err {
+				if err == nil {
+					t.Errorf("newRouter(%q, %q) succeeded, want an error", tt.column, tt.routes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.route(tt.record); got != tt.want {
+				t.Errorf("route(%q) = %v, want %v", tt.record, got, tt.want)
+			}
+			if want := map[routeTarget]int64{tt.want: 1}; !reflect.DeepEqual(r.counts, want) {
+				t.Errorf("counts = %v, want %v", r.counts, want)
+			}
+		})
+	}
+}
+
+func TestRouterWithoutColumn(t *testing.T) {
+	r, err := newRouter(Config{DBName: "seed", CollectionName: "places", Routes: "Dhaka=dhaka_places"}, &Header{}, columns{})
+	if err != nil || r != nil {
+		t.Errorf("newRouter without ROUTE_COLUMN = %v, %v, want nil", r, err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// rowRange is an inclusive range of data row numbers
+type rowRange struct {
+	First int64 `json:"first"`
+	Last  int64 `json:"last"`
+}
+
+// Parse a "first:last" row range; either end may be left open, e.g.
+// "1500000:" for everything from row 1500000
+func parseRowRange(value string) (rowRange, error) {
+	var r rowRange
+	first, last, ok := strings.Cut(value, ":")
+	if !ok {
+		return r, fmt.Errorf("row range %q must be first:last", value)
+	}
+
+	var err error
+	if first != "" {
+		if r.First, err = strconv.ParseInt(first, 10, 64); err != nil || r.First < 1 {
+			return r, fmt.Errorf("row range %q: first row must be a positive number", value)
+		}
+	}
+	if last != "" {
+		if r.Last, err = strconv.ParseInt(last, 10, 64); err != nil || r.Last < max(r.First, 1) {
+			return r, fmt.Errorf("row range %q: last row must be a number no less than the first", value)
+		}
+	}
+	return r, nil
+}
+
+// Whether the range restricts anything
+func (r rowRange) set() bool {
+	return r.First > 0 || r.Last > 0
+}
+
+// Whether data row n is inside the range
+func (r rowRange) contains(n int64) bool {
+	return n >= r.First && (r.Last == 0 || n <= r.Last)
+}
+
+func (r rowRange) String() string {
+	if !r.set() {
+		return ""
+	}
+	s := ""
+	if r.First > 0 {
+		s = strconv.FormatInt(r.First, 10)
+	}
+	s += ":"
+	if r.Last > 0 {
+		s += strconv.FormatInt(r.Last, 10)
+	}
+	return s
+}
+
+func (r *rowRange) Set(value string) error {
+	parsed, err := parseRowRange(value)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestParseRowRange(t *testing.T) {
+	tests := []struct {
+		value string
+		want  rowRange
+		err   bool
+	}{
+		{value: "1:100", want: rowRange{First: 1, Last: 100}},
+		{value: "1500000:", want: rowRange{First: 1500000}},
+		{value: ":500", want: rowRange{Last: 500}},
+		{value: "7:7", want: rowRange{First: 7, Last: 7}},
+		{value: ":", want: rowRange{}},
+		{value: "", err: true},
+		{value: "100", err: true},
+		{value: "0:10", err: true},
+		{value: "-5:10", err: true},
+		{value: "10:5", err: true},
+		{value: ":0", err: true},
+		{value: "a:10", err: true},
+		{value: "1:b", err: true},
+		{value: "1:2:3", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRowRange(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseRowRange(%q) = %+v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRowRange(%q): %v", tt.value, err)
+		} else if got != tt.want {
+			t.Errorf("parseRowRange(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRowRangeContains(t *testing.T) {
+	tests := []struct {
+		r    rowRange
+		n    int64
+		want bool
+	}{
+		{rowRange{First: 10, Last: 20}, 9, false},
+		{rowRange{First: 10, Last: 20}, 10, true},
+		{rowRange{First: 10, Last: 20}, 20, true},
+		{rowRange{First: 10, Last: 20}, 21, false},
+		{rowRange{First: 10}, 1 << 40, true},
+		{rowRange{Last: 5}, 1, true},
+		{rowRange{Last: 5}, 6, false},
+	}
+	for _, tt := range tests {
+		if got := tt.r.contains(tt.n); got != tt.want {
+			t.Errorf("%v contains %d = %v, want %v", tt.r, tt.n, got, tt.want)
+		}
+	}
+}
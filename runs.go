@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Collection every run is recorded in, in the target database
+const runsCollection = "_seed_runs"
+
+// runRecord is what the runs collection keeps of a run, to tell who loaded
+// what and when long after the summary files are gone
+type runRecord struct {
+	ImportID        string           `bson:"importId"`
+	CSVFile         string           `bson:"csvFile"`
+	SourceSHA256    string           `bson:"sourceSha256,omitempty"` // Only when the whole source was read
+	Database        string           `bson:"database"`
+	Collection      string           `bson:"collection"`
+	WriteMode       string           `bson:"writeMode"`
+	Operator        string           `bson:"operator"`
+	Host            string           `bson:"host"`
+	Status          string           `bson:"status"`
+	Error           string           `bson:"error,omitempty"`
+	StartedAt       time.Time        `bson:"startedAt"`
+	FinishedAt      time.Time        `bson:"finishedAt"`
+	DurationSeconds float64          `bson:"durationSeconds"`
+	FirstRow        int64            `bson:"firstRow"`
+	LastRow         int64            `bson:"lastRow"`
+	RowsRead        int64            `bson:"rowsRead"`
+	Inserted        int64            `bson:"inserted"`
+	Rejected        int64            `bson:"rejected"`
+	Skipped         int64            `bson:"skipped"`
+	Filtered        int64            `bson:"filtered"`
+	Duplicates      int64            `bson:"duplicates"`
+	Flagged         int64            `bson:"flagged"`
+	ErrorsByType    map[string]int64 `bson:"errorsByType"`
+}
+
+// Who is running the seeder: SEED_OPERATOR, else the OS user
+func runOperator(cfg Config) string {
+	if cfg.Operator != "" {
+		return cfg.Operator
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// Record the run in the runs collection
+func recordRun(ctx context.Context, db *mongo.Database, cfg Config, summary runSummary, sourceSHA256 string) error {
+	host, _ := os.Hostname()
+	record := runRecord{
+		ImportID:        summary.ImportID,
+		CSVFile:         summary.CSVFile,
+		SourceSHA256:    sourceSHA256,
+		Database:        cfg.DBName,
+		Collection:      cfg.CollectionName,
+		WriteMode:       cfg.WriteMode,
+		Operator:        runOperator(cfg),
+		Host:            host,
+		Status:          summary.Status,
+		Error:           summary.Error,
+		StartedAt:       summary.StartedAt,
+		FinishedAt:      summary.FinishedAt,
+		DurationSeconds: summary.DurationSeconds,
+		FirstRow:        summary.FirstRow,
+		LastRow:         summary.LastRow,
+		RowsRead:        summary.RowsRead,
+		Inserted:        summary.Inserted,
+		Rejected:        summary.Rejected,
+		Skipped:         summary.Skipped,
+		Filtered:        summary.Filtered,
+		Duplicates:      summary.Duplicates,
+		Flagged:         summary.Flagged,
+		ErrorsByType:    summary.ErrorsByType,
+	}
+	_, err := db.Collection(runsCollection).InsertOne(ctx, record)
+	return err
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+)
+
+// Whether a data row is in the configured sample. Rows are picked by a hash
+// of their PlaceID rather than at random, so every run, and a resumed one,
+// picks the same rows.
+func (cfg Config) sampled(rowNumber int64, placeID string) bool {
+	switch {
+	case cfg.SampleEvery > 0:
+		return (rowNumber-1)%cfg.SampleEvery == 0
+	case cfg.Sample > 0:
+		sum := sha256.Sum256([]byte(placeID))
+		return float64(binary.BigEndian.Uint64(sum[:8])) < cfg.Sample*math.MaxUint64
+	}
+	return true
+}
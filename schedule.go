@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Seed CSV_FILE at every time SCHEDULE gives, until interrupted, e.g.
+// nightly with "0 2 * * *". Its patterns are expanded afresh each time, so
+// files added to the feed are picked up. A run that fails is logged and
+// tried again at the next time, resuming from its checkpoints; one that
+// succeeds has its checkpoints cleared so the next run seeds the feed
+// afresh. With SCHEDULE_SKIP_UNCHANGED, runs are skipped while the inputs
+// and every one's fingerprint are the same as at the last successful run.
+func runSchedule(cfg Config, targets []Config, postImport []postImportStep) error {
+	schedule, err := cron.ParseStandard(cfg.Schedule)
+	if err != nil {
+		return err
+	}
+
+	var seeded map[string]string // Input fingerprints at the last successful run
+	for {
+		next := schedule.Next(time.Now())
+		slog.Info("Next scheduled run", "at", next, "schedule", cfg.Schedule)
+		time.Sleep(time.Until(next))
+
+		inputs, err := expandInputs(cfg.CSVFile)
+		if err != nil {
+			slog.Warn("Scheduled run skipped", "error", err)
+			continue
+		}
+
+		var fingerprints map[string]string
+		if cfg.ScheduleSkipUnchanged {
+			if fingerprints, err = fingerprintInputs(cfg, inputs); err != nil {
+				slog.Warn("Error checking inputs for changes, seeding them anyway", "error", err)
+			} else if seeded != nil && maps.Equal(fingerprints, seeded) {
+				slog.Info("Inputs unchanged since the last run, skipping", "files", len(inputs))
+				continue
+			}
+		}
+
+		if err := seedRun(cfg, targets, inputs, postImport); err != nil {
+			slog.Warn("Scheduled run failed, resuming at the next", "error", err)
+			continue
+		}
+		seeded = fingerprints
+		if cfg.DryRun {
+			continue
+		}
+		for _, target := range targets {
+			for _, source := range inputs {
+				progress := target.forSource(source, outputPrefix(source)).outputs.progress
+				if err := clearCheckpoint(context.Background(), target, progress); err != nil {
+					slog.Warn("Error clearing checkpoint", "error", err, "file", progress)
+				}
+			}
+		}
+		slog.Info("Scheduled run complete")
+	}
+}
+
+// Tell each input's version: a remote one by its ETag, or else
+// Last-Modified, and size from the headers of a request closed before its
+// body is read, so it isn't downloaded an extra time, and any other by the
+// hash of its bytes, reading it through once
+func fingerprintInputs(cfg Config, inputs []string) (map[string]string, error) {
+	fingerprints := map[string]string{}
+	for _, source := range inputs {
+		in, err := openInput(source, readModeBufio, cfg.SourceEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		fingerprint, err := fingerprintInput(in)
+		in.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		fingerprints[source] = fingerprint
+	}
+	return fingerprints, nil
+}
+
+func fingerprintInput(in *input) (string, error) {
+	if in.http != nil && in.size >= 0 {
+		size := strconv.FormatInt(in.size, 10)
+		if in.http.validator != "" {
+			return "validator " + in.http.validator + " size " + size, nil
+		}
+		if in.http.modified != "" {
+			return "modified " + in.http.modified + " size " + size, nil
+		}
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, in); err != nil {
+		return "", err
+	}
+	return "sha256 " + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFingerprintInputs(t *testing.T) {
+	const body = "a,b\n1,2\n"
+	sum := sha256.Sum256([]byte(body))
+	hashed := "sha256 " + hex.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/etag.csv":
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+		case "/modified.csv":
+			w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+		case "/chunked.csv":
+			w.Header().Set("ETag", `"v1"`)
+			w.(http.Flusher).Flush() // No Content-Length
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	local := filepath.Join(t.TempDir(), "local.csv")
+	if err := os.WriteFile(local, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{name: "local", source: local, want: hashed},
+		{name: "etag", source: server.URL + "/etag.csv", want: `validator "v1" size 8`},
+		{name: "last modified", source: server.URL + "/modified.csv", want: "modified Mon, 01 Jan 2024 00:00:00 GMT size 8"},
+		{name: "no headers", source: server.URL + "/plain.csv", want: hashed},
+		{name: "no size", source: server.URL + "/chunked.csv", want: hashed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fingerprintInputs(Config{}, []string{tt.source})
+			if err != nil {
+				t.Fatalf("fingerprintInputs(%s): %v", tt.source, err)
+			}
+			if got[tt.source] != tt.want {
+				t.Errorf("fingerprint of %s = %q, want %q", tt.source, got[tt.source], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Check the header matches the mapping's columns exactly, names and order
+func checkStrictSchema(raw []string, mapping Mapping) error {
+	if len(mapping.Columns) == 0 {
+		return fmt.Errorf("strict schema mode needs the expected columns in the mapping file")
+	}
+
+	if len(raw) != len(mapping.Columns) {
+		return fmt.Errorf("strict schema: header has %d columns, mapping expects %d", len(raw), len(mapping.Columns))
+	}
+	for i, name := range raw {
+		if strings.TrimSpace(name) != mapping.Columns[i] {
+			return fmt.Errorf("strict schema: column %d is %q, mapping expects %q", i, strings.TrimSpace(name), mapping.Columns[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Backends MONGO_URI can be resolved from
+const (
+	secretsBackendVault = "vault"
+	secretsBackendAWS   = "aws"
+)
+
+// Variables holding credentials, each of which can instead be read from the
+// file named by the variable with a _FILE suffix, such as a Docker or
+// Kubernetes secret mount
+var secretVariables = []string{
+	"MONGO_URI",
+	"AZURE_STORAGE_SAS_TOKEN",
+	"AZURE_STORAGE_KEY",
+	"SFTP_KEY_PASSPHRASE",
+	"VAULT_TOKEN",
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"SLACK_WEBHOOK_URL",
+	"SMTP_PASSWORD",
+	"SERVE_TOKEN",
+	"CHECKPOINT_URL",
+}
+
+// Set each secret variable whose _FILE variable is set from that file,
+// without its trailing newline
+func loadSecretFiles() error {
+	for _, name := range secretVariables {
+		file := os.Getenv(name + "_FILE")
+		if file == "" {
+			continue
+		}
+		if os.Getenv(name) != "" {
+			return fmt.Errorf("%s and %s_FILE are both set", name, name)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		if err := os.Setenv(name, strings.TrimRight(string(data), "\r\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resolve MONGO_URI from SECRETS_BACKEND, when one is set, returning when
+// to resolve it again: every SECRETS_REFRESH, else two thirds into a Vault
+// lease, else never (zero). The secret holds the connection string under
+// MONGO_URI_SECRET_KEY, or a username and password, such as Vault's
+// dynamic database credentials, to put in MONGO_URI.
+func resolveMongoURI(ctx context.Context, cfg Config) (string, time.Time, error) {
+	var (
+		values map[string]any
+		lease  time.Duration
+		err    error
+	)
+	switch cfg.SecretsBackend {
+	case "":
+		return cfg.MongoURI, time.Time{}, nil
+	case secretsBackendVault:
+		values, lease, err = readVaultSecret(ctx, cfg.MongoURISecret)
+	case secretsBackendAWS:
+		values, err = readAWSSecret(ctx, cfg.MongoURISecret, cfg.MongoURISecretKey)
+	}
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("reading %s secret %s: %w", cfg.SecretsBackend, cfg.MongoURISecret, err)
+	}
+
+	uri, err := secretMongoURI(values, cfg.MongoURISecretKey, cfg.MongoURI)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s secret %s: %w", cfg.SecretsBackend, cfg.MongoURISecret, err)
+	}
+	var refreshAt time.Time
+	switch {
+	case cfg.SecretsRefresh > 0:
+		refreshAt = time.Now().Add(cfg.SecretsRefresh)
+	case lease > 0:
+		refreshAt = time.Now().Add(lease * 2 / 3)
+	}
+	return uri, refreshAt, nil
+}
+
+// The connection string in a secret's values, or base with the secret's
+// username and password
+func secretMongoURI(values map[string]any, key, base string) (string, error) {
+	if uri, ok := values[key].(string); ok && uri != "" {
+		return uri, nil
+	}
+	username, _ := values["username"].(string)
+	password, _ := values["password"].(string)
+	if username == "" || password == "" {
+		return "", fmt.Errorf("no %q, or username and password, in the secret", key)
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("MONGO_URI: %w", err)
+	}
+	u.User = url.UserPassword(username, password)
+	return u.String(), nil
+}
+
+// Read a secret from Vault at VAULT_ADDR with VAULT_TOKEN, returning its
+// values, those of a KV version 2 secret unwrapped, and its lease
+func readVaultSecret(ctx context.Context, path string) (map[string]any, time.Duration, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, 0, fmt.Errorf("VAULT_ADDR is not set")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("GET %s: %s", req.URL.Path, resp.Status)
+	}
+
+	var secret struct {
+		LeaseDuration int64          `json:"lease_duration"`
+		Data          map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, 0, err
+	}
+	values := secret.Data
+	if inner, ok := values["data"].(map[string]any); ok && values["metadata"] != nil {
+		values = inner
+	}
+	return values, time.Duration(secret.LeaseDuration) * time.Second, nil
+}
+
+// Read a secret from AWS Secrets Manager with the standard AWS credentials.
+// A secret that isn't a JSON object is taken as the value of key.
+func readAWSSecret(ctx context.Context, id, key string) (map[string]any, error) {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out, err := secretsmanager.NewFromConfig(awsCfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: &id})
+	if err != nil {
+		return nil, err
+	}
+	if out.SecretString == nil {
+		return nil, fmt.Errorf("the secret has no string value")
+	}
+	var values map[string]any
+	if json.Unmarshal([]byte(*out.SecretString), &values) != nil {
+		values = map[string]any{key: *out.SecretString}
+	}
+	return values, nil
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Imports waiting to run before uploads are turned away
+const serveQueueSize = 100
+
+// importJob is an uploaded CSV queued to be seeded, and how it went
+type importJob struct {
+	ID         string       `json:"id"`
+	Status     string       `json:"status"` // queued, running, completed, failed or canceled
+	Error      string       `json:"error,omitempty"`
+	File       string       `json:"file"`
+	Database   string       `json:"database,omitempty"`
+	Collection string       `json:"collection"`
+	DryRun     bool         `json:"dryRun"`
+	QueuedAt   time.Time    `json:"queuedAt"`
+	StartedAt  *time.Time   `json:"startedAt,omitempty"`
+	FinishedAt *time.Time   `json:"finishedAt,omitempty"`
+	Summaries  []runSummary `json:"summaries,omitempty"`
+
+	// Live, while running
+	Progress []importProgress `json:"progress,omitempty"`
+
+	targets   []Config
+	dir       string
+	path      string
+	summaries []string
+	control   *runControl
+	cancel    context.CancelFunc
+}
+
+// importServer takes CSV uploads and seeds them one at a time
+type importServer struct {
+	cfg        Config
+	targets    []Config
+	postImport []postImportStep
+	queue      chan *importJob
+
+	mu   sync.Mutex
+	jobs map[string]*importJob
+}
+
+// The serve subcommand: POST /imports takes a multipart upload of a CSV
+// "file", and optionally the "database" and "collection" to seed it into
+// and "dryRun", queues it and answers with the import's ID; GET
+// /imports/{id} reports how it is going, live while it runs, DELETE
+// /imports/{id} cancels it, and GET /imports lists them all.
+// Each import is seeded as a run of its own, hooks and notifications
+// included, with the upload and then its reports kept in SERVE_DIR/<id>/
+// until SERVE_RETENTION after it finishes.
+func runServe(cfg Config, targets []Config, postImport []postImportStep) error {
+	if err := os.MkdirAll(cfg.ServeDir, 0755); err != nil {
+		return err
+	}
+	s := &importServer{
+		cfg:        cfg,
+		targets:    targets,
+		postImport: postImport,
+		queue:      make(chan *importJob, serveQueueSize),
+		jobs:       map[string]*importJob{},
+	}
+	go s.work()
+	go s.expire()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /imports", s.authorized(s.createImport))
+	mux.HandleFunc("GET /imports", s.authorized(s.listImports))
+	mux.HandleFunc("GET /imports/{id}", s.authorized(s.getImport))
+	mux.HandleFunc("DELETE /imports/{id}", s.authorized(s.cancelImport))
+
+	// Whichever server stops first stops serve
+	errs := make(chan error, 2)
+	if cfg.GRPCAddr != "" {
+		go func() { errs <- s.serveGRPC() }()
+	}
+	go func() {
+		slog.Info("Serving imports", "addr", cfg.ServeAddr, "dir", cfg.ServeDir)
+		errs <- http.ListenAndServe(cfg.ServeAddr, mux)
+	}()
+	return <-errs
+}
+
+// Require SERVE_TOKEN as a bearer token, if set; it must be when listening
+// beyond localhost
+func (s *importServer) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		want := "Bearer " + s.cfg.ServeToken
+		if s.cfg.ServeToken != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, errors.New("missing or wrong bearer token"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// Why an import can't be queued or canceled
+var (
+	errQueueFull    = errors.New("too many imports queued, try again later")
+	errNoSuchImport = errors.New("no such import")
+)
+
+// A new import with the server's defaults, and a directory for its file
+func (s *importServer) newJob() (*importJob, error) {
+	job := &importJob{ID: primitive.NewObjectID().Hex(), Status: "queued", Collection: s.cfg.CollectionName, DryRun: s.cfg.DryRun}
+	job.dir = filepath.Join(s.cfg.ServeDir, job.ID)
+	return job, os.MkdirAll(job.dir, 0755)
+}
+
+// Name the import's file, returning where to save it
+func (job *importJob) setFile(name string) string {
+	job.File = filepath.Base(name)
+	if job.File == "." || job.File == string(filepath.Separator) {
+		job.File = "upload.csv"
+	}
+	job.path = filepath.Join(job.dir, job.File)
+	return job.path
+}
+
+// Check the import and queue it, removing its directory if it isn't
+func (s *importServer) submit(job *importJob) (err error) {
+	defer func() {
+		if err != nil {
+			os.RemoveAll(job.dir)
+		}
+	}()
+	switch {
+	case job.path == "":
+		return errors.New("no file uploaded")
+	case job.Collection == "":
+		return errors.New("no collection given, and COLLECTION_NAME isn't set")
+	case job.Database != "" && s.cfg.Targets != "":
+		return errors.New("database can't be given when seeding TARGETS")
+	case job.Database != "" && !s.databaseAllowed(job.Database):
+		return fmt.Errorf("database %q isn't DB_NAME or one of SERVE_DATABASES", job.Database)
+	}
+
+	// Each target seeds the upload, writing its reports next to it
+	ctx, cancel := context.WithCancel(context.Background())
+	job.control, job.cancel = &runControl{ctx: ctx}, cancel
+	for _, target := range s.targets {
+		target.CollectionName = job.Collection
+		target.DryRun = job.DryRun
+		target.control = job.control
+		if job.Database != "" {
+			target.DBName = job.Database
+		}
+		job.targets = append(job.targets, target)
+		job.summaries = append(job.summaries, target.forSource(job.path, outputPrefix(job.path)).outputs.summary)
+	}
+	if job.Database == "" && s.cfg.Targets == "" {
+		job.Database = s.cfg.DBName
+	}
+	job.QueuedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case s.queue <- job:
+		s.jobs[job.ID] = job
+	default:
+		cancel()
+		return errQueueFull
+	}
+	slog.Info("Import queued", "id", job.ID, "file", job.File, "database", job.Database, "collection", job.Collection)
+	return nil
+}
+
+// Whether uploads may seed the named database: DB_NAME or one of
+// SERVE_DATABASES
+func (s *importServer) databaseAllowed(name string) bool {
+	if name == s.cfg.DBName {
+		return true
+	}
+	for _, allowed := range strings.Split(s.cfg.ServeDatabases, ",") {
+		if strings.TrimSpace(allowed) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// A copy of the import, with its live progress while it runs
+func (s *importServer) get(id string) (importJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return importJob{}, errNoSuchImport
+	}
+	return s.view(job), nil
+}
+
+// Copies of every import still kept
+func (s *importServer) list() []importJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]importJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, s.view(job))
+	}
+	return jobs
+}
+
+// Cancel a queued import, or stop a running one at its next row
+func (s *importServer) cancelJob(id string) (importJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return importJob{}, errNoSuchImport
+	}
+	switch job.Status {
+	case "queued":
+		now := time.Now()
+		job.Status, job.FinishedAt = "canceled", &now
+	case "running":
+	default:
+		return s.view(job), fmt.Errorf("import already %s", job.Status)
+	}
+	job.cancel()
+	slog.Info("Import canceled", "id", job.ID)
+	return s.view(job), nil
+}
+
+// A copy of the job with its live progress, under the lock
+func (s *importServer) view(job *importJob) importJob {
+	view := *job
+	if job.Status == "running" {
+		view.Progress = job.control.progress()
+	}
+	return view
+}
+
+// POST /imports: save the upload and queue it
+func (s *importServer) createImport(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.ServeMaxUpload)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeJSONError(w, uploadErrorStatus(err), err)
+		return
+	}
+
+	job, err := s.newJob()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	fail := func(status int, err error) {
+		os.RemoveAll(job.dir)
+		writeJSONError(w, status, err)
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fail(uploadErrorStatus(err), err)
+			return
+		}
+		if part.FormName() == "file" {
+			if job.path != "" {
+				fail(http.StatusBadRequest, errors.New("more than one file uploaded"))
+				return
+			}
+			if err := saveUpload(job.setFile(part.FileName()), part); err != nil {
+				fail(uploadErrorStatus(err), err)
+				return
+			}
+			continue
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, 1024))
+		if err != nil {
+			fail(uploadErrorStatus(err), err)
+			return
+		}
+		switch part.FormName() {
+		case "database":
+			job.Database = string(value)
+		case "collection":
+			job.Collection = string(value)
+		case "dryRun":
+			// Only turns a dry run on, so a server with DRY_RUN set never
+			// writes
+			dryRun, err := strconv.ParseBool(string(value))
+			if err != nil {
+				fail(http.StatusBadRequest, fmt.Errorf("dryRun: %w", err))
+				return
+			}
+			job.DryRun = job.DryRun || dryRun
+		default:
+			fail(http.StatusBadRequest, fmt.Errorf("unknown field %q", part.FormName()))
+			return
+		}
+	}
+	if err := s.submit(job); errors.Is(err, errQueueFull) {
+		writeJSONError(w, http.StatusServiceUnavailable, err)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	view, _ := s.get(job.ID)
+	w.Header().Set("Location", "/imports/"+job.ID)
+	writeJSON(w, http.StatusAccepted, view)
+}
+
+// 413 for a request body over SERVE_MAX_UPLOAD, else 400
+func uploadErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// Copy an uploaded file to disk
+func saveUpload(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// GET /imports/{id}
+func (s *importServer) getImport(w http.ResponseWriter, r *http.Request) {
+	job, err := s.get(r.PathValue("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// GET /imports
+func (s *importServer) listImports(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.list())
+}
+
+// DELETE /imports/{id}
+func (s *importServer) cancelImport(w http.ResponseWriter, r *http.Request) {
+	job, err := s.cancelJob(r.PathValue("id"))
+	switch {
+	case errors.Is(err, errNoSuchImport):
+		writeJSONError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeJSONError(w, http.StatusConflict, err)
+	default:
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+// Seed queued imports in turn
+func (s *importServer) work() {
+	for job := range s.queue {
+		canceled := false
+		s.update(func() {
+			if canceled = job.Status == "canceled"; !canceled {
+				now := time.Now()
+				job.Status, job.StartedAt = "running", &now
+			}
+		})
+		if canceled {
+			os.Remove(job.path)
+			continue
+		}
+		slog.Info("Import started", "id", job.ID, "file", job.File)
+
+		cfg := s.cfg
+		cfg.CSVFile = job.path
+		cfg.CollectionName = job.Collection
+		cfg.DryRun = job.DryRun
+		if job.Database != "" {
+			cfg.DBName = job.Database
+		}
+		err := seedRun(cfg, job.targets, []string{job.path}, s.postImport)
+		summaries := readSummaries(job.summaries, *job.StartedAt)
+
+		s.update(func() {
+			now := time.Now()
+			job.Status, job.FinishedAt, job.Summaries = "completed", &now, summaries
+			switch {
+			case job.control.ctx.Err() != nil:
+				job.Status = "canceled"
+			case err != nil:
+				job.Status, job.Error = "failed", err.Error()
+			}
+		})
+		job.cancel()
+		// Only the reports are kept; the upload is never seeded again
+		if err := os.Remove(job.path); err != nil {
+			slog.Warn("Error removing upload", "id", job.ID, "error", err)
+		}
+		slog.Info("Import finished", "id", job.ID, "status", job.Status)
+	}
+}
+
+// Forget imports finished more than SERVE_RETENTION ago, and remove their
+// reports, checking every minute
+func (s *importServer) expire() {
+	for now := range time.Tick(time.Minute) {
+		s.prune(now)
+	}
+}
+
+// Forget the imports that finished more than SERVE_RETENTION before now
+func (s *importServer) prune(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, job := range s.jobs {
+		if job.FinishedAt == nil || now.Sub(*job.FinishedAt) < s.cfg.ServeRetention {
+			continue
+		}
+		delete(s.jobs, id)
+		if err := os.RemoveAll(job.dir); err != nil {
+			slog.Warn("Error removing expired import", "id", id, "error", err)
+		}
+	}
+}
+
+// Change a job under the lock
+func (s *importServer) update(change func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// runControl lets the server follow the runs seeding an import, one per
+// input and target, and cancel them
+type runControl struct {
+	ctx context.Context
+
+	mu   sync.Mutex
+	runs []trackedRun
+}
+
+type trackedRun struct {
+	file   string
+	target string
+	stats  *runStats
+}
+
+// importProgress is how far one run of an import has got
+type importProgress struct {
+	File   string `json:"file"`
+	Target string `json:"target,omitempty"`
+	statsSnapshot
+	ErrorsByType map[string]int64 `json:"errorsByType"`
+}
+
+// Follow a run's stats. Runs outside the server have no control.
+func (c *runControl) track(cfg Config, stats *runStats) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.runs = append(c.runs, trackedRun{file: filepath.Base(cfg.CSVFile), target: cfg.target, stats: stats})
+}
+
+// The context runs are cancelled by
+func (c *runControl) context() context.Context {
+	if c == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// Live progress of every run so far
+func (c *runControl) progress() []importProgress {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	progress := make([]importProgress, len(c.runs))
+	for i, run := range c.runs {
+		progress[i] = importProgress{
+			File:          run.file,
+			Target:        run.target,
+			statsSnapshot: run.stats.snapshot(),
+			ErrorsByType:  run.stats.errorCounts(),
+		}
+	}
+	return progress
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) *importServer {
+	t.Helper()
+	cfg := Config{
+		ServeDir:       t.TempDir(),
+		ServeMaxUpload: 1024,
+		ServeRetention: time.Hour,
+		DBName:         "seed",
+		CollectionName: "places",
+	}
+	return &importServer{
+		cfg:     cfg,
+		targets: []Config{cfg},
+		queue:   make(chan *importJob, serveQueueSize),
+		jobs:    map[string]*importJob{},
+	}
+}
+
+// A multipart upload of the given name and value parts, "file" parts
+// uploading their value as places.csv
+func uploadRequest(t *testing.T, parts [][2]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, part := range parts {
+		name, value := part[0], part[1]
+		if name == "file" {
+			fw, err := w.CreateFormFile("file", "places.csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write([]byte(value))
+			continue
+		}
+		w.WriteField(name, value)
+	}
+	w.Close()
+	r := httptest.NewRequest(http.MethodPost, "/imports", &body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	return r
+}
+
+func TestCreateImport(t *testing.T) {
+	tests := []struct {
+		name       string
+		parts      [][2]string
+		status     int
+		collection string
+	}{
+		{name: "file", parts: [][2]string{{"file", "placeId\np1\n"}}, status: http.StatusAccepted, collection: "places"},
+		{name: "collection", parts: [][2]string{{"collection", "fixes"}, {"file", "placeId\np1\n"}}, status: http.StatusAccepted, collection: "fixes"},
+		{name: "no file", parts: [][2]string{{"collection", "fixes"}}, status: http.StatusBadRequest},
+		{name: "two files", parts: [][2]string{{"file", "placeId\np1\n"}, {"file", "placeId\np2\n"}}, status: http.StatusBadRequest},
+		{name: "oversize", parts: [][2]string{{"file", "placeId\n" + strings.Repeat("p1\n", 1000)}}, status: http.StatusRequestEntityTooLarge},
+		{name: "unknown field", parts: [][2]string{{"file", "placeId\np1\n"}, {"format", "csv"}}, status: http.StatusBadRequest},
+		{name: "other database", parts: [][2]string{{"database", "admin"}, {"file", "placeId\np1\n"}}, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			w := httptest.NewRecorder()
+			s.createImport(w, uploadRequest(t, tt.parts))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+
+			dirs, err := os.ReadDir(s.cfg.ServeDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.status != http.StatusAccepted {
+				if len(dirs) != 0 || len(s.jobs) != 0 {
+					t.Errorf("refused upload left %d directories and %d imports", len(dirs), len(s.jobs))
+				}
+				return
+			}
+
+			var job importJob
+			if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != "queued" || job.Collection != tt.collection || len(s.queue) != 1 {
+				t.Errorf("import = %+v with %d queued, want one queued for %s", job, len(s.queue), tt.collection)
+			}
+			if _, err := os.Stat(filepath.Join(s.cfg.ServeDir, job.ID, "places.csv")); err != nil {
+				t.Errorf("upload not saved: %v", err)
+			}
+		})
+	}
+}
+
+func TestPruneImports(t *testing.T) {
+	s := newTestServer(t)
+	now := time.Now()
+	finished := func(ago time.Duration) *time.Time {
+		at := now.Add(-ago)
+		return &at
+	}
+	jobs := map[string]*importJob{
+		"running":  {Status: "running"},
+		"queued":   {Status: "queued"},
+		"recent":   {Status: "completed", FinishedAt: finished(time.Minute)},
+		"expired":  {Status: "failed", FinishedAt: finished(2 * time.Hour)},
+		"canceled": {Status: "canceled", FinishedAt: finished(2 * time.Hour)},
+	}
+	for id, job := range jobs {
+		job.ID, job.dir = id, filepath.Join(s.cfg.ServeDir, id)
+		if err := os.MkdirAll(job.dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		s.jobs[id] = job
+	}
+
+	s.prune(now)
+	for id := range jobs {
+		_, kept := s.jobs[id]
+		_, err := os.Stat(filepath.Join(s.cfg.ServeDir, id))
+		want := id != "expired" && id != "canceled"
+		if kept != want || (err == nil) != want {
+			t.Errorf("import %s kept = %v with directory error %v, want kept = %v", id, kept, err, want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Batch size used against Atlas serverless unless BATCH_SIZE is set, small
+// enough to keep bursts of write processing units down
+const serverlessBatchSize = 100
+
+// offPeakWindow is a daily window of local time, which may wrap past
+// midnight, e.g. 22:00-06:00
+type offPeakWindow struct {
+	start, end time.Duration // Since midnight
+}
+
+// Parse an "HH:MM-HH:MM" window, empty meaning none
+func parseOffPeakWindow(value string) (*offPeakWindow, error) {
+	if value == "" {
+		return nil, nil
+	}
+	start, end, ok := strings.Cut(value, "-")
+	if !ok {
+		return nil, fmt.Errorf("off-peak window %q must be HH:MM-HH:MM", value)
+	}
+	var w offPeakWindow
+	var err error
+	if w.start, err = parseClock(start); err != nil {
+		return nil, fmt.Errorf("off-peak window %q: %w", value, err)
+	}
+	if w.end, err = parseClock(end); err != nil {
+		return nil, fmt.Errorf("off-peak window %q: %w", value, err)
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("off-peak window %q is empty", value)
+	}
+	return &w, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Time to wait from now until the window opens, zero inside it
+func (w *offPeakWindow) until(now time.Time) time.Duration {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	clock := now.Sub(midnight)
+
+	inside := clock >= w.start && clock < w.end
+	if w.start > w.end {
+		inside = clock >= w.start || clock < w.end
+	}
+	if inside {
+		return 0
+	}
+	if clock < w.start {
+		return w.start - clock
+	}
+	return 24*time.Hour - clock + w.start
+}
+
+// writePacer keeps writes under a rate and inside an off-peak window
+type writePacer struct {
+	rate   int64 // Documents per second, 0 for no limit
+	window *offPeakWindow
+	next   time.Time // Earliest start of the next write
+}
+
+// A pacer for the configured write rate and window, nil if neither is set
+func newWritePacer(cfg Config) (*writePacer, error) {
+	window, err := parseOffPeakWindow(cfg.OffPeakWindow)
+	if err != nil || (cfg.WriteRate <= 0 && window == nil) {
+		return nil, err
+	}
+	return &writePacer{rate: cfg.WriteRate, window: window}, nil
+}
+
+// Wait until a batch of docs documents may be written
+func (p *writePacer) wait(ctx context.Context, docs int) error {
+	delay := time.Until(p.next)
+	if p.window != nil {
+		if untilOpen := p.window.until(time.Now()); untilOpen > 0 {
+			slog.Info("Waiting for the off-peak window", "until", time.Now().Add(untilOpen).Format(time.TimeOnly))
+			delay = max(delay, untilOpen)
+		}
+	}
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if p.rate > 0 {
+		p.next = time.Now().Add(time.Duration(docs) * time.Second / time.Duration(p.rate))
+	}
+	return nil
+}
+
+// Estimate the Atlas serverless processing units a batch costs: a write
+// processing unit per started KB of each document and one per index entry,
+// and for upserts, a read processing unit per started 4KB of the document
+// looked up. Reads made to find duplicates aren't counted.
+func estimateProcessingUnits(batch []any, indexes int, mode string) (rpu, wpu int64) {
+	for _, doc := range batch {
+		data, err := bson.MarshalWithRegistry(bsonRegistry, doc)
+		if err != nil {
+			continue
+		}
+		size := int64(len(data))
+		wpu += (size+1023)/1024 + int64(indexes)
+		if mode == writeModeUpsert || mode == writeModeRefresh || mode == writeModeUpdate {
+			rpu += (size + 4095) / 4096
+		}
+	}
+	return rpu, wpu
+}
+
+// Number of indexes on the collection, each costing a write per document
+func countIndexes(ctx context.Context, collection *mongo.Collection) (int, error) {
+	specs, err := collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(specs), nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTP protocol version 3 packet types and values used to read a file
+const (
+	sftpInit    = 1
+	sftpVersion = 2
+	sftpOpen    = 3
+	sftpClose   = 4
+	sftpRead    = 5
+	sftpFstat   = 8
+	sftpStatus  = 101
+	sftpHandle  = 102
+	sftpData    = 103
+	sftpAttrs   = 105
+
+	sftpOpenRead  = 0x1
+	sftpAttrSize  = 0x1
+	sftpStatusEOF = 1
+
+	// Largest read servers are required to answer in full
+	sftpMaxRead = 32 * 1024
+)
+
+// sftpReader streams a file from an SFTP server, one read request at a time
+type sftpReader struct {
+	client  *ssh.Client
+	session *ssh.Session
+	in      io.WriteCloser
+	out     *bufio.Reader
+
+	id     uint32
+	handle string
+	offset int64
+	size   int64
+}
+
+// Whether the path is an sftp:// URL
+func isSFTPURL(path string) bool {
+	return strings.HasPrefix(path, "sftp://")
+}
+
+// Open sftp://user@host[:port]/path. Keys come from SFTP_KEY_FILE, with
+// SFTP_KEY_PASSPHRASE if it is encrypted, or a running ssh-agent; the host
+// key is checked against SFTP_KNOWN_HOSTS, ~/.ssh/known_hosts by default.
+func openSFTP(rawURL string) (*sftpReader, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" || u.Path == "" || u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("SFTP URL %q must be sftp://user@host/path", rawURL)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	auth, err := sftpAuth()
+	if err != nil {
+		return nil, err
+	}
+	knownHosts := os.Getenv("SFTP_KNOWN_HOSTS")
+	if knownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("loading SFTP known hosts: %w", err)
+	}
+
+	client, err := ssh.Dial("tcp", host, &ssh.ClientConfig{
+		User:            u.User.Username(),
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", host, err)
+	}
+	r := &sftpReader{client: client, size: -1}
+	if err := r.start(u.Path); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("opening %s: %w", rawURL, err)
+	}
+	return r, nil
+}
+
+// Authentication by the configured key file, or else the agent's keys
+func sftpAuth() ([]ssh.AuthMethod, error) {
+	if keyFile := os.Getenv("SFTP_KEY_FILE"); keyFile != "" {
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		var signer ssh.Signer
+		if passphrase := os.Getenv("SFTP_KEY_PASSPHRASE"); passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("SFTP_KEY_FILE: %w", err)
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to ssh-agent: %w", err)
+		}
+		return []ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(conn).Signers)}, nil
+	}
+	return nil, errors.New("no SFTP key: set SFTP_KEY_FILE or run an ssh-agent")
+}
+
+// Start the SFTP subsystem and open the file for reading
+func (r *sftpReader) start(path string) error {
+	session, err := r.client.NewSession()
+	if err != nil {
+		return err
+	}
+	r.session = session
+	if r.in, err = session.StdinPipe(); err != nil {
+		return err
+	}
+	out, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	r.out = bufio.NewReader(out)
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return err
+	}
+
+	if err := r.send(sftpInit, uint32(3)); err != nil {
+		return err
+	}
+	if typ, _, err := r.recv(); err != nil {
+		return err
+	} else if typ != sftpVersion {
+		return fmt.Errorf("unexpected SFTP packet %d, expected version", typ)
+	}
+
+	r.id++
+	if err := r.send(sftpOpen, r.id, path, uint32(sftpOpenRead), uint32(0)); err != nil {
+		return err
+	}
+	data, err := r.response(sftpHandle)
+	if err != nil {
+		return err
+	}
+	if r.handle, _, err = sftpString(data); err != nil {
+		return err
+	}
+
+	// The size is only for progress, unknown if the server doesn't say
+	r.id++
+	if err := r.send(sftpFstat, r.id, r.handle); err != nil {
+		return err
+	}
+	if data, err = r.response(sftpAttrs); err == nil && len(data) >= 12 && binary.BigEndian.Uint32(data)&sftpAttrSize != 0 {
+		r.size = int64(binary.BigEndian.Uint64(data[4:]))
+	}
+	return nil
+}
+
+func (r *sftpReader) Read(p []byte) (int, error) {
+	if len(p) > sftpMaxRead {
+		p = p[:sftpMaxRead]
+	}
+	r.id++
+	if err := r.send(sftpRead, r.id, r.handle, uint64(r.offset), uint32(len(p))); err != nil {
+		return 0, err
+	}
+	data, err := r.response(sftpData)
+	if err != nil {
+		return 0, err
+	}
+	chunk, _, err := sftpString(data)
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, chunk)
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *sftpReader) Close() error {
+	if r.handle != "" {
+		r.id++
+		if r.send(sftpClose, r.id, r.handle) == nil {
+			r.response(sftpStatus)
+		}
+	}
+	if r.session != nil {
+		r.session.Close()
+	}
+	return r.client.Close()
+}
+
+// Send a packet of uint32, uint64 and string fields
+func (r *sftpReader) send(typ byte, fields ...any) error {
+	packet := []byte{0, 0, 0, 0, typ}
+	for _, field := range fields {
+		switch v := field.(type) {
+		case uint32:
+			packet = binary.BigEndian.AppendUint32(packet, v)
+		case uint64:
+			packet = binary.BigEndian.AppendUint64(packet, v)
+		case string:
+			packet = binary.BigEndian.AppendUint32(packet, uint32(len(v)))
+			packet = append(packet, v...)
+		}
+	}
+	binary.BigEndian.PutUint32(packet, uint32(len(packet)-4))
+	_, err := r.in.Write(packet)
+	return err
+}
+
+// Receive a packet's type and the data after it
+func (r *sftpReader) recv() (byte, []byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r.out, length[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n == 0 || n > 1<<20 {
+		return 0, nil, fmt.Errorf("invalid SFTP packet length %d", n)
+	}
+	packet := make([]byte, n)
+	if _, err := io.ReadFull(r.out, packet); err != nil {
+		return 0, nil, err
+	}
+	return packet[0], packet[1:], nil
+}
+
+// Receive the response to the last request, the data after its id when it
+// is of the expected type. An EOF status is io.EOF; other statuses are
+// errors with the server's message.
+func (r *sftpReader) response(expected byte) ([]byte, error) {
+	typ, data, err := r.recv()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 || binary.BigEndian.Uint32(data) != r.id {
+		return nil, errors.New("SFTP response out of sequence")
+	}
+	data = data[4:]
+	if typ == expected {
+		return data, nil
+	}
+	if typ != sftpStatus || len(data) < 4 {
+		return nil, fmt.Errorf("unexpected SFTP packet %d", typ)
+	}
+	code := binary.BigEndian.Uint32(data)
+	if code == sftpStatusEOF {
+		return nil, io.EOF
+	}
+	message, _, _ := sftpString(data[4:])
+	return nil, fmt.Errorf("SFTP status %d: %s", code, message)
+}
+
+// A length-prefixed string and what follows it
+func sftpString(data []byte) (string, []byte, error) {
+	if len(data) < 4 || uint32(len(data)-4) < binary.BigEndian.Uint32(data) {
+		return "", nil, errors.New("truncated SFTP packet")
+	}
+	n := binary.BigEndian.Uint32(data)
+	return string(data[4 : 4+n]), data[4+n:], nil
+}
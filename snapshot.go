@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Snapshot files are named <csv>_snapshot_0001.ndjson, <csv>_snapshot_0002.ndjson, ...
+const snapshotFile = "_snapshot"
+
+// Keys looked up per query when exporting a snapshot
+const snapshotChunkSize = 1000
+
+// snapshotExporter periodically exports the documents inserted since the
+// last snapshot as NDJSON, so downstream systems can consume a long
+// import as it progresses
+type snapshotExporter struct {
+	collection *mongo.Collection
+	prefix     string
+	interval   time.Duration
+	last       time.Time
+	keys       []any
+	count      int
+}
+
+func newSnapshotExporter(collection *mongo.Collection, prefix string, interval time.Duration) *snapshotExporter {
+	return &snapshotExporter{collection: collection, prefix: prefix, interval: interval, last: time.Now()}
+}
+
+// Record the placeId of a newly written document
+func (s *snapshotExporter) add(key any) {
+	if key != nil {
+		s.keys = append(s.keys, key)
+	}
+}
+
+// Whether the interval has passed since the last snapshot
+func (s *snapshotExporter) due() bool {
+	return time.Since(s.last) >= s.interval
+}
+
+// Export the documents added since the last snapshot to the next snapshot
+// file. The file only appears once complete. Returns "" when there was
+// nothing to export.
+func (s *snapshotExporter) export(ctx context.Context) (string, int, error) {
+	s.last = time.Now()
+	if len(s.keys) == 0 {
+		return "", 0, nil
+	}
+
+	s.count++
+	name := fmt.Sprintf("%s_%04d.ndjson", s.prefix, s.count)
+	tmp := name + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp)
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	exported := 0
+	for start := 0; start < len(s.keys); start += snapshotChunkSize {
+		chunk := s.keys[start:min(start+snapshotChunkSize, len(s.keys))]
+		cursor, err := s.collection.Find(ctx, bson.D{{Key: "placeId", Value: bson.D{{Key: "$in", Value: chunk}}}})
+		if err != nil {
+			return "", 0, err
+		}
+		for cursor.Next(ctx) {
+			data, err := bson.MarshalExtJSON(cursor.Current, false, false)
+			if err != nil {
+				cursor.Close(ctx)
+				return "", 0, err
+			}
+			w.Write(data)
+			w.WriteByte('\n')
+			exported++
+		}
+		if err := cursor.Err(); err != nil {
+			cursor.Close(ctx)
+			return "", 0, err
+		}
+		cursor.Close(ctx)
+	}
+
+	if err := w.Flush(); err != nil {
+		return "", 0, err
+	}
+	if err := file.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return "", 0, err
+	}
+	s.keys = s.keys[:0]
+	return name, exported, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Rows looked at to detect spreadsheet index and padding columns
+const spreadsheetSampleRows = 100
+
+// columnSkip is the number of leading and trailing columns dropped from
+// every row, or auto to detect those added by spreadsheet tools
+type columnSkip struct {
+	Auto     bool
+	Leading  int
+	Trailing int
+}
+
+// Parse "auto", "none" or "leading:trailing", e.g. "1:0" to drop an index
+// column
+func parseColumnSkip(value string) (columnSkip, error) {
+	switch value {
+	case "auto":
+		return columnSkip{Auto: true}, nil
+	case "none", "":
+		return columnSkip{}, nil
+	}
+
+	leading, trailing, ok := strings.Cut(value, ":")
+	var skip columnSkip
+	var err1, err2 error
+	skip.Leading, err1 = strconv.Atoi(leading)
+	skip.Trailing, err2 = strconv.Atoi(trailing)
+	if !ok || err1 != nil || err2 != nil || skip.Leading < 0 || skip.Trailing < 0 {
+		return skip, fmt.Errorf("column skip %q must be auto, none or leading:trailing", value)
+	}
+	return skip, nil
+}
+
+func (s columnSkip) String() string {
+	switch {
+	case s.Auto:
+		return "auto"
+	case s.Leading == 0 && s.Trailing == 0:
+		return "none"
+	}
+	return fmt.Sprintf("%d:%d", s.Leading, s.Trailing)
+}
+
+// Set implements flag.Value
+func (s *columnSkip) Set(value string) error {
+	skip, err := parseColumnSkip(value)
+	if err != nil {
+		return err
+	}
+	*s = skip
+	return nil
+}
+
+// Drop the skipped columns from a record; records too short keep what's left
+func (s columnSkip) apply(record []string) []string {
+	if s.Leading == 0 && s.Trailing == 0 {
+		return record
+	}
+	end := max(len(record)-s.Trailing, 0)
+	if s.Leading >= end {
+		return nil
+	}
+	return record[s.Leading:end]
+}
+
+// Detect an unnamed leading index column of consecutive integers, as
+// written by pandas or an Excel round-trip, and an unnamed trailing column
+// with no values, as left by a trailing delimiter
+func detectSpreadsheetColumns(header []string, sample []sampledRow) columnSkip {
+	var skip columnSkip
+	if len(header) < 2 || len(sample) == 0 {
+		return skip
+	}
+
+	if name := strings.TrimSpace(header[0]); name == "" || name == "Unnamed: 0" {
+		sequential := true
+		var previous int64
+		checked := 0
+		for _, row := range sample {
+			if row.err != nil {
+				continue
+			}
+			n, err := strconv.ParseInt(strings.TrimSpace(row.record[0]), 10, 64)
+			if err != nil || (checked > 0 && n != previous+1) {
+				sequential = false
+				break
+			}
+			previous = n
+			checked++
+		}
+		if sequential && checked > 0 {
+			skip.Leading = 1
+		}
+	}
+
+	last := len(header) - 1
+	if last > skip.Leading && strings.TrimSpace(header[last]) == "" {
+		skip.Trailing = 1
+		for _, row := range sample {
+			if row.err == nil && last < len(row.record) && strings.TrimSpace(row.record[last]) != "" {
+				skip.Trailing = 0
+				break
+			}
+		}
+	}
+	return skip
+}
+
+// Read the header and drop the configured or detected spreadsheet columns
+// from it and every row after it. Rows read ahead to detect them are
+// returned, already trimmed, to be processed before reading on.
+func (r *csvReader) readHeader(skip columnSkip) ([]string, []sampledRow, error) {
+	header, err := r.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	r.header = slices.Clone(header)
+	r.padTo(len(header))
+
+	var sample []sampledRow
+	if skip.Auto {
+		if sample, err = readSample(r, spreadsheetSampleRows); err != nil {
+			return nil, nil, err
+		}
+		skip = detectSpreadsheetColumns(header, sample)
+	}
+	if skip.Leading == 0 && skip.Trailing == 0 {
+		return header, sample, nil
+	}
+
+	slog.Info("Skipping spreadsheet columns", "leading", skip.Leading, "trailing", skip.Trailing)
+	for i := range sample {
+		sample[i].record = skip.apply(sample[i].record)
+	}
+	r.skip = skip
+	return skip.apply(header), sample, nil
+}
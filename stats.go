@@ -0,0 +1,205 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// runStats counts what happened during a run. Counters are updated
+// atomically so they can be read while the import is in progress.
+type runStats struct {
+	importID   string
+	startedAt  time.Time
+	rowsRead   atomic.Int64
+	inserted   atomic.Int64
+	rejected   atomic.Int64
+	skipped    atomic.Int64
+	filtered   atomic.Int64
+	duplicates atomic.Int64
+	merged     atomic.Int64
+	flagged    atomic.Int64
+	checkpoint atomic.Value // string
+
+	// Rows held back as near duplicates of an earlier place
+	nearDuplicates atomic.Int64
+
+	// Rows not written in new mode as their placeId was already stored, and
+	// in refresh mode as their row hash was unchanged
+	existing  atomic.Int64
+	unchanged atomic.Int64
+
+	// Rows not written in update mode as no document had their placeId
+	unmatched atomic.Int64
+
+	// Division/district fields filled from, and rows disagreeing with, the
+	// boundary file
+	boundaryFilled     atomic.Int64
+	boundaryMismatched atomic.Int64
+
+	// Empty plus codes filled from the location
+	plusCodesDerived atomic.Int64
+
+	// Estimated Atlas serverless read and write processing units
+	estimatedRPUs atomic.Int64
+	estimatedWPUs atomic.Int64
+
+	// Range of data row numbers processed and flushed, 1 being the row
+	// after the header
+	firstRow atomic.Int64
+	lastRow  atomic.Int64
+
+	mu              sync.Mutex
+	errorsByType    map[string]int64
+	flaggedByReason map[string]int64
+	recentRejects   []rejectedRow
+}
+
+// Rejected rows kept for the dashboard, newest last
+const recentRejectsKept = 10
+
+// rejectedRow is why a row was rejected, and when
+type rejectedRow struct {
+	at     time.Time
+	reason string
+}
+
+func newRunStats() *runStats {
+	return &runStats{importID: primitive.NewObjectID().Hex(), startedAt: time.Now(), errorsByType: map[string]int64{}, flaggedByReason: map[string]int64{}}
+}
+
+// Count a rejected row by error kind, keeping the latest reasons
+func (s *runStats) addRejected(kind, reason string) {
+	s.rejected.Add(1)
+
+	s.mu.Lock()
+	s.errorsByType[kind]++
+	if len(s.recentRejects) == recentRejectsKept {
+		s.recentRejects = s.recentRejects[1:]
+	}
+	s.recentRejects = append(s.recentRejects, rejectedRow{at: time.Now(), reason: reason})
+	s.mu.Unlock()
+}
+
+// Count a row caught by the garbage filter, flags being "field:reason"
+func (s *runStats) addFlagged(flags []string) {
+	s.flagged.Add(1)
+
+	s.mu.Lock()
+	for _, flag := range flags {
+		s.flaggedByReason[flag]++
+	}
+	s.mu.Unlock()
+}
+
+// Rate of n events per second since the run started
+func (s *runStats) rate(n int64) float64 {
+	elapsed := time.Since(s.startedAt).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed
+}
+
+// Record that data row n was processed rather than skipped
+func (s *runStats) processedRow(n int64) {
+	s.firstRow.CompareAndSwap(0, n)
+}
+
+// Record that every processed row up to data row n has been flushed
+func (s *runStats) flushedRow(n int64) {
+	s.lastRow.Store(n)
+}
+
+// Record the last PlaceID saved to the progress file
+func (s *runStats) setCheckpoint(placeID string) {
+	s.checkpoint.Store(placeID)
+}
+
+// statsSnapshot is a point-in-time copy of the run stats
+type statsSnapshot struct {
+	RowsRead           int64   `json:"rowsRead"`
+	Inserted           int64   `json:"inserted"`
+	Rejected           int64   `json:"rejected"`
+	Skipped            int64   `json:"skipped"`
+	Filtered           int64   `json:"filtered"`
+	Duplicates         int64   `json:"duplicates"`
+	NearDuplicates     int64   `json:"nearDuplicates"`
+	Existing           int64   `json:"existing"`
+	Unchanged          int64   `json:"unchanged"`
+	Unmatched          int64   `json:"unmatched"`
+	Merged             int64   `json:"merged"`
+	Flagged            int64   `json:"flagged"`
+	BoundaryFilled     int64   `json:"boundaryFilled"`
+	BoundaryMismatched int64   `json:"boundaryMismatched"`
+	PlusCodesDerived   int64   `json:"plusCodesDerived"`
+	RowsPerSecond      float64 `json:"rowsPerSecond"`
+	DocsPerSecond      float64 `json:"docsPerSecond"`
+	ElapsedSeconds     float64 `json:"elapsedSeconds"`
+	HeapAllocBytes     uint64  `json:"heapAllocBytes"`
+	Checkpoint         string  `json:"checkpoint"`
+}
+
+func (s *runStats) snapshot() statsSnapshot {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	checkpoint, _ := s.checkpoint.Load().(string)
+	rows, inserted := s.rowsRead.Load(), s.inserted.Load()
+	return statsSnapshot{
+		RowsRead:           rows,
+		Inserted:           inserted,
+		Rejected:           s.rejected.Load(),
+		Skipped:            s.skipped.Load(),
+		Filtered:           s.filtered.Load(),
+		Duplicates:         s.duplicates.Load(),
+		NearDuplicates:     s.nearDuplicates.Load(),
+		Existing:           s.existing.Load(),
+		Unchanged:          s.unchanged.Load(),
+		Unmatched:          s.unmatched.Load(),
+		Merged:             s.merged.Load(),
+		Flagged:            s.flagged.Load(),
+		BoundaryFilled:     s.boundaryFilled.Load(),
+		BoundaryMismatched: s.boundaryMismatched.Load(),
+		PlusCodesDerived:   s.plusCodesDerived.Load(),
+		RowsPerSecond:      s.rate(rows),
+		DocsPerSecond:      s.rate(inserted),
+		ElapsedSeconds:     time.Since(s.startedAt).Seconds(),
+		HeapAllocBytes:     mem.HeapAlloc,
+		Checkpoint:         checkpoint,
+	}
+}
+
+// Copy of the rejected row counts by error kind
+func (s *runStats) errorCounts() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int64, len(s.errorsByType))
+	for kind, n := range s.errorsByType {
+		counts[kind] = n
+	}
+	return counts
+}
+
+// Copy of the latest rejected rows
+func (s *runStats) recentRejected() []rejectedRow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]rejectedRow(nil), s.recentRejects...)
+}
+
+// Copy of the garbage filter counts by field and reason
+func (s *runStats) flaggedCounts() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int64, len(s.flaggedByReason))
+	for flag, n := range s.flaggedByReason {
+		counts[flag] = n
+	}
+	return counts
+}
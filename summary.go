@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Suffix of the file the end-of-run summary is written to
+const summaryFile = "_summary.json"
+
+// runSummary is the machine-readable result of a run
+type runSummary struct {
+	ImportID           string           `json:"importId"`
+	Status             string           `json:"status"`
+	DryRun             bool             `json:"dryRun"`
+	Error              string           `json:"error,omitempty"`
+	CSVFile            string           `json:"csvFile"`
+	Target             string           `json:"target,omitempty"`
+	StartedAt          time.Time        `json:"startedAt"`
+	FinishedAt         time.Time        `json:"finishedAt"`
+	DurationSeconds    float64          `json:"durationSeconds"`
+	RowsRead           int64            `json:"rowsRead"`
+	Inserted           int64            `json:"inserted"`
+	Skipped            int64            `json:"skipped"`
+	Filtered           int64            `json:"filtered"`
+	Duplicates         int64            `json:"duplicates"`
+	NearDuplicates     int64            `json:"nearDuplicates"`
+	Existing           int64            `json:"existing"`
+	Unchanged          int64            `json:"unchanged"`
+	Unmatched          int64            `json:"unmatched"`
+	Merged             int64            `json:"merged"`
+	Flagged            int64            `json:"flagged"`
+	BoundaryFilled     int64            `json:"boundaryFilled"`
+	BoundaryMismatched int64            `json:"boundaryMismatched"`
+	PlusCodesDerived   int64            `json:"plusCodesDerived"`
+	Rejected           int64            `json:"rejected"`
+	RejectsFile        string           `json:"rejectsFile,omitempty"` // Only when rows were rejected
+	ReportsURL         string           `json:"reportsUrl,omitempty"`  // Where the reports are uploaded to, if they are
+	FirstRow           int64            `json:"firstRow"`
+	LastRow            int64            `json:"lastRow"`
+	RowsPerSecond      float64          `json:"rowsPerSecond"`
+	DocsPerSecond      float64          `json:"docsPerSecond"`
+	Checkpoint         string           `json:"checkpoint"`
+	EstimatedRPUs      int64            `json:"estimatedRPUs,omitempty"`
+	EstimatedWPUs      int64            `json:"estimatedWPUs,omitempty"`
+	ErrorsByType       map[string]int64 `json:"errorsByType"`
+	FlaggedByReason    map[string]int64 `json:"flaggedByReason,omitempty"`
+}
+
+// Summarise the run, runErr being the error it stopped with, if any
+func newRunSummary(cfg Config, stats *runStats, runErr error) runSummary {
+	snapshot := stats.snapshot()
+	summary := runSummary{
+		ImportID:           stats.importID,
+		Status:             "completed",
+		DryRun:             cfg.DryRun,
+		CSVFile:            cfg.CSVFile,
+		Target:             cfg.target,
+		StartedAt:          stats.startedAt,
+		FinishedAt:         time.Now(),
+		DurationSeconds:    snapshot.ElapsedSeconds,
+		RowsRead:           snapshot.RowsRead,
+		Inserted:           snapshot.Inserted,
+		Skipped:            snapshot.Skipped,
+		Filtered:           snapshot.Filtered,
+		Duplicates:         snapshot.Duplicates,
+		NearDuplicates:     snapshot.NearDuplicates,
+		Existing:           snapshot.Existing,
+		Unchanged:          snapshot.Unchanged,
+		Unmatched:          snapshot.Unmatched,
+		Merged:             snapshot.Merged,
+		Flagged:            snapshot.Flagged,
+		BoundaryFilled:     snapshot.BoundaryFilled,
+		BoundaryMismatched: snapshot.BoundaryMismatched,
+		PlusCodesDerived:   snapshot.PlusCodesDerived,
+		Rejected:           snapshot.Rejected,
+		FirstRow:           stats.firstRow.Load(),
+		LastRow:            stats.lastRow.Load(),
+		RowsPerSecond:      snapshot.RowsPerSecond,
+		DocsPerSecond:      snapshot.DocsPerSecond,
+		Checkpoint:         snapshot.Checkpoint,
+		EstimatedRPUs:      stats.estimatedRPUs.Load(),
+		EstimatedWPUs:      stats.estimatedWPUs.Load(),
+		ErrorsByType:       stats.errorCounts(),
+		FlaggedByReason:    stats.flaggedCounts(),
+	}
+	if runErr != nil {
+		summary.Status = "failed"
+		summary.Error = runErr.Error()
+	}
+	if summary.Rejected > 0 {
+		summary.RejectsFile = cfg.outputs.rejects
+		if cfg.DryRun {
+			summary.RejectsFile = cfg.outputs.dryRunRejects
+		}
+	}
+	if cfg.ReportsUploadURL != "" && !cfg.DryRun {
+		summary.ReportsURL = strings.TrimRight(cfg.ReportsUploadURL, "/") + "/" + reportsFolder(stats) + "/"
+	}
+	return summary
+}
+
+// Write the summary to the named summary file and stdout
+func writeSummary(summary runSummary, name string) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if err := writeStdout(data); err != nil {
+		return err
+	}
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		return fmt.Errorf("writing summary file: %w", err)
+	}
+	return nil
+}
+
+// Read the summary files of runs started since startedAt, leaving out
+// missing files and those left by earlier runs
+func readSummaries(files []string, startedAt time.Time) []runSummary {
+	summaries := []runSummary{}
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		var summary runSummary
+		if err == nil {
+			err = json.Unmarshal(data, &summary)
+		}
+		if err != nil {
+			slog.Warn("Error reading summary", "file", name, "error", err)
+			continue
+		}
+		if !summary.StartedAt.Before(startedAt) {
+			summaries = append(summaries, summary)
+		}
+	}
+	return summaries
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Names TARGETS may list, each suffixing its own MONGO_URI_ and DB_NAME_
+var targetNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// The configuration for each of TARGETS, seeded in turn, or just the one
+// configured without them. A target's URI and database come from
+// MONGO_URI_<NAME> and DB_NAME_<NAME>, falling back to MONGO_URI and
+// DB_NAME, e.g. TARGETS=dhaka,singapore with MONGO_URI_DHAKA and
+// MONGO_URI_SINGAPORE for two regional clusters.
+func seedTargets(cfg Config) ([]Config, error) {
+	if cfg.Targets == "" {
+		return []Config{cfg}, nil
+	}
+	var targets []Config
+	names := map[string]bool{}
+	databases := map[string]string{}
+	for _, name := range strings.Split(cfg.Targets, ",") {
+		name = strings.TrimSpace(name)
+		if !targetNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("TARGETS: %q must be letters, digits and underscores", name)
+		}
+		suffix := strings.ToUpper(name)
+		if names[suffix] {
+			return nil, fmt.Errorf("TARGETS: %s is listed twice", name)
+		}
+		names[suffix] = true
+
+		target := cfg
+		target.target = name
+		target.MongoURI = envOr("MONGO_URI_"+suffix, cfg.MongoURI)
+		target.DBName = envOr("DB_NAME_"+suffix, cfg.DBName)
+		if target.MongoURI == "" || target.DBName == "" {
+			return nil, fmt.Errorf("TARGETS: %s needs MONGO_URI_%s or MONGO_URI, and DB_NAME_%s or DB_NAME", name, suffix, suffix)
+		}
+		database := target.MongoURI + "\x00" + target.DBName
+		if other, ok := databases[database]; ok {
+			return nil, fmt.Errorf("TARGETS: %s and %s are the same database", other, name)
+		}
+		databases[database] = name
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
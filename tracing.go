@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Tracer for the import pipeline, a no-op unless tracing is set up
+var tracer = otel.Tracer("MongoLocationSeeder")
+
+// Set up OpenTelemetry tracing from the standard OTEL_ environment
+// variables. Tracing is enabled by OTEL_TRACES_EXPORTER (otlp, console or
+// none) or, for otlp, by setting an OTLP endpoint. The returned function
+// flushes pending spans.
+func setupTracing(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	exporterName := os.Getenv("OTEL_TRACES_EXPORTER")
+	if exporterName == "" && (os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "") {
+		exporterName = "otlp"
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch exporterName {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "console":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	case "otlp":
+		protocol := envOr("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", envOr("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf"))
+		switch protocol {
+		case "grpc":
+			exporter, err = otlptracegrpc.New(ctx)
+		case "http/protobuf":
+			exporter, err = otlptracehttp.New(ctx)
+		default:
+			return nil, fmt.Errorf("unsupported OTLP protocol %q", protocol)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER %q", exporterName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "MongoLocationSeeder")),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Field documents store the import ID of the run that wrote them in
+const importIDField = "importId"
+
+// The undo subcommand: delete, or with SOFT_DELETE mark as deleted, the
+// documents a run wrote, found by the import ID in its summary and audit
+// log, in the collection and every one ROUTES sends rows to. A dry run only
+// counts them. Upsert and refresh runs may have replaced documents, which
+// would be removed rather than restored, so they are only undone with
+// --force, as are runs missing from the runs collection.
+func runUndo(cfg Config, importID string) error {
+	if _, err := primitive.ObjectIDFromHex(importID); err != nil {
+		return fmt.Errorf("%q is not an import ID", importID)
+	}
+	targets, err := writtenTargets(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	clientOpts, _, err := clientOptions(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	client, err := mongo.Connect(ctx, clientOpts)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+	if err := pingServer(ctx, client, cfg.ConnectRetries); err != nil {
+		return err
+	}
+
+	var run runRecord
+	err = client.Database(cfg.DBName).Collection(runsCollection).FindOne(ctx, bson.D{{Key: importIDField, Value: importID}}).Decode(&run)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		err = checkUndoable(importID, nil, cfg.UndoForce)
+	case err == nil:
+		err = checkUndoable(importID, &run, cfg.UndoForce)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		if err := undoCollection(ctx, cfg, client.Database(target.Database).Collection(target.Collection), importID); err != nil {
+			return fmt.Errorf("%s: %w", target, err)
+		}
+	}
+	return nil
+}
+
+// Whether the run, nil if it isn't recorded, can be undone: only with force
+// when it isn't recorded or ran in upsert or refresh mode
+func checkUndoable(importID string, run *runRecord, force bool) error {
+	switch {
+	case run == nil:
+		if !force {
+			return fmt.Errorf("import %s isn't in %s, so its write mode is unknown; undo it anyway with --force", importID, runsCollection)
+		}
+		slog.Warn("Import not recorded, undoing it anyway", "importId", importID)
+	case run.WriteMode == writeModeUpsert || run.WriteMode == writeModeRefresh:
+		if !force {
+			return fmt.Errorf("import %s ran in %s mode, so its documents may have replaced earlier ones, which undo deletes rather than restores; undo it anyway with --force", importID, run.WriteMode)
+		}
+		slog.Warn("Undoing an import that may have replaced documents", "importId", importID, "writeMode", run.WriteMode)
+	}
+	return nil
+}
+
+// Delete, or mark deleted, the run's documents in one collection
+func undoCollection(ctx context.Context, cfg Config, collection *mongo.Collection, importID string) error {
+	name := collection.Database().Name() + "." + collection.Name()
+	filter := bson.D{{Key: importIDField, Value: importID}}
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	slog.Info("Documents from the run", "importId", importID, "documents", count, "collection", name)
+	if cfg.DryRun || count == 0 {
+		return nil
+	}
+
+	if cfg.SoftDelete {
+		filter = append(filter, bson.E{Key: "isDeleted", Value: bson.D{{Key: "$ne", Value: true}}})
+		result, err := collection.UpdateMany(ctx, filter, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "isDeleted", Value: true},
+			{Key: "deletedAt", Value: time.Now().UTC()},
+		}}})
+		if err != nil {
+			return err
+		}
+		slog.Info("undo_complete", "importId", importID, "softDeleted", result.ModifiedCount, "collection", name)
+		return nil
+	}
+
+	result, err := collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+	slog.Info("undo_complete", "importId", importID, "deleted", result.DeletedCount, "collection", name)
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckUndoable(t *testing.T) {
+	tests := []struct {
+		name  string
+		run   *runRecord
+		force bool
+		err   bool
+	}{
+		{name: "insert", run: &runRecord{WriteMode: writeModeInsert}},
+		{name: "new", run: &runRecord{WriteMode: writeModeNew}},
+		{name: "update", run: &runRecord{WriteMode: writeModeUpdate}},
+		{name: "upsert", run: &runRecord{WriteMode: writeModeUpsert}, err: true},
+		{name: "refresh", run: &runRecord{WriteMode: writeModeRefresh}, err: true},
+		{name: "unrecorded", err: true},
+		{name: "upsert with force", run: &runRecord{WriteMode: writeModeUpsert}, force: true},
+		{name: "refresh with force", run: &runRecord{WriteMode: writeModeRefresh}, force: true},
+		{name: "unrecorded with force", force: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkUndoable("652f1c2e9d1e4a0001a1b2c3", tt.run, tt.force)
+			if (err != nil) != tt.err {
+				t.Errorf("checkUndoable = %v, want error = %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestWrittenTargets(t *testing.T) {
+	tests := []struct {
+		name        string
+		routeColumn string
+		routes      string
+		want        []routeTarget
+	}{
+		{name: "unrouted", routes: "dhaka=dhaka_places", want: []routeTarget{{"seed", "places"}}},
+		{
+			name:        "routed",
+			routeColumn: "city",
+			routes:      "Dhaka=dhaka_places, Chattogram=ctg.places, Sylhet=dhaka_places",
+			want:        []routeTarget{{"seed", "places"}, {"ctg", "places"}, {"seed", "dhaka_places"}},
+		},
+		{
+			name:        "fallback route",
+			routeColumn: "city",
+			routes:      "Dhaka=dhaka_places,*=other_places",
+			want:        []routeTarget{{"seed", "places"}, {"seed", "other_places"}, {"seed", "dhaka_places"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := writtenTargets(Config{DBName: "seed", CollectionName: "places", RouteColumn: tt.routeColumn, Routes: tt.routes})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("writtenTargets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
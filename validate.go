@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Rows sampled to check every record has as many fields as the header
+const validateSampleRows = 1000
+
+// Free space required next to the progress, rejects and summary files
+const validateMinFreeBytes = 100 << 20
+
+// validationCheck is one line of the validation report
+type validationCheck struct {
+	name   string
+	ok     bool
+	detail string
+}
+
+// The validate subcommand: check everything a run needs before touching
+// any data, printing a report. Fails if any check fails.
+func runValidate(cfg Config) error {
+	var checks []validationCheck
+	add := func(name string, err error, detail string) {
+		if err != nil {
+			detail = err.Error()
+		}
+		checks = append(checks, validationCheck{name: name, ok: err == nil, detail: detail})
+	}
+
+	// Input file, header and mapping
+	mapping, err := loadMapping(cfg.MappingFile)
+	add("mapping file", err, orDefault(cfg.MappingFile, "default column positions"))
+	if err == nil {
+		header, detail, err := validateCSV(cfg, mapping)
+		add("header shape", err, detail)
+		if header != nil {
+			add("required columns", validateColumns(header, mapping), fmt.Sprintf("%d columns", len(header.Names)))
+		}
+	}
+
+	// Local files
+	dir := filepath.Dir(cfg.outputs.progress)
+	add("output directory writable", checkWritable(dir), dir)
+	free, err := diskFree(dir)
+	if err == nil && free < validateMinFreeBytes {
+		err = fmt.Errorf("only %d MB free, need %d MB", free>>20, validateMinFreeBytes>>20)
+	}
+	add("disk space", err, fmt.Sprintf("%d MB free", free>>20))
+
+	// MongoDB
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	clientOpts, _, err := clientOptions(ctx, cfg)
+	var client *mongo.Client
+	if err == nil {
+		client, err = mongo.Connect(ctx, clientOpts)
+	}
+	if err == nil {
+		defer client.Disconnect(context.Background())
+		err = client.Ping(ctx, nil)
+	}
+	add("mongo connectivity", err, "ping ok")
+	if err == nil {
+		users, privileges, err := connectionStatus(ctx, client)
+		add("mongo authentication", err, authDetail(users))
+		if err == nil {
+			add("collection writable", checkInsertPrivilege(users, privileges, cfg.DBName, cfg.CollectionName),
+				cfg.DBName+"."+cfg.CollectionName)
+		}
+	}
+
+	// Checkpoints, where they aren't kept in local files
+	if cfg.CheckpointBackend != checkpointBackendFile {
+		detail := cfg.CheckpointBackend
+		checkpoints, err := openCheckpointStore(ctx, cfg)
+		if err == nil {
+			defer checkpoints.Close()
+			var resume resumePoint
+			resume, err = getLastProcessedPlaceID(ctx, checkpoints, cfg.outputs.progress)
+			if resume.PlaceID != "" {
+				detail += ", resuming at PlaceID " + resume.PlaceID
+			}
+		}
+		add("checkpoint store", err, detail)
+	}
+
+	failed := 0
+	for _, check := range checks {
+		status := " OK "
+		if !check.ok {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("[%s] %-26s %s\n", status, check.name, check.detail)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// Check the header and that sampled rows have as many fields as it
+func validateCSV(cfg Config, mapping Mapping) (*Header, string, error) {
+	cfg.ReadMode = readModeBufio // Only a sample is read
+	file, err := openSource(cfg, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	reader := newCSVReader(file, cfg)
+	rawHeader, sample, err := reader.readHeader(cfg.SkipColumns)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading header: %w", err)
+	}
+	reader.FieldsPerRecord = -1 // Counted below, with the row number
+	if cfg.StrictSchema {
+		if err := checkStrictSchema(rawHeader, mapping); err != nil {
+			return nil, "", err
+		}
+	}
+	header, err := newHeader(rawHeader, cfg.DuplicateHeaders)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows := 0
+	for ; rows < validateSampleRows; rows++ {
+		var record []string
+		if rows < len(sample) {
+			record, err = sample[rows].record, sample[rows].err
+		} else {
+			record, err = reader.Read()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return header, "", err
+		}
+		if len(record) != len(rawHeader) {
+			return header, "", fmt.Errorf("row %d has %d fields, header has %d", rows+1, len(record), len(rawHeader))
+		}
+	}
+
+	detail := fmt.Sprintf("%d columns, %d rows sampled, header hash %s", len(rawHeader), rows, headerHash(rawHeader)[:12])
+	if len(header.Renamed) > 0 {
+		var renamed []string
+		for i := range header.Names {
+			if name, ok := header.Renamed[i]; ok {
+				renamed = append(renamed, fmt.Sprintf("%s -> %s", name, header.Names[i]))
+			}
+		}
+		detail += ", duplicates renamed: " + strings.Join(renamed, ", ")
+	}
+	return header, detail, nil
+}
+
+// Check every mapped field resolves to a column in the header
+func validateColumns(header *Header, mapping Mapping) error {
+	cols, err := mapping.resolve(header)
+	if err != nil {
+		return err
+	}
+	for field, i := range cols {
+		if i >= len(header.Names) {
+			return fmt.Errorf("field %q expects column %d, header has %d", field, i, len(header.Names))
+		}
+	}
+	_, err = mapping.resolveGeo(header, cols, GeoField{OnInvalid: geoInvalidKeep, Format: geoFormatGeoJSON})
+	return err
+}
+
+// Check files can be created in dir
+func checkWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".seeder-validate-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// privilege is an action grant returned by connectionStatus
+type privilege struct {
+	Resource struct {
+		DB         *string `bson:"db"`
+		Collection *string `bson:"collection"`
+	} `bson:"resource"`
+	Actions []string `bson:"actions"`
+}
+
+// Authenticated users and their privileges on this connection
+func connectionStatus(ctx context.Context, client *mongo.Client) ([]string, []privilege, error) {
+	var status struct {
+		AuthInfo struct {
+			AuthenticatedUsers []struct {
+				User string `bson:"user"`
+				DB   string `bson:"db"`
+			} `bson:"authenticatedUsers"`
+			AuthenticatedUserPrivileges []privilege `bson:"authenticatedUserPrivileges"`
+		} `bson:"authInfo"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{
+		{Key: "connectionStatus", Value: 1},
+		{Key: "showPrivileges", Value: true},
+	}).Decode(&status)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var users []string
+	for _, user := range status.AuthInfo.AuthenticatedUsers {
+		users = append(users, user.User+"@"+user.DB)
+	}
+	return users, status.AuthInfo.AuthenticatedUserPrivileges, nil
+}
+
+func authDetail(users []string) string {
+	if len(users) == 0 {
+		return "no authenticated users (access control disabled?)"
+	}
+	return "authenticated as " + strings.Join(users, ", ")
+}
+
+// Check the privileges allow inserting into the collection. Without
+// authenticated users access control is off and anything goes.
+func checkInsertPrivilege(users []string, privileges []privilege, db, collection string) error {
+	if len(users) == 0 {
+		return nil
+	}
+	for _, p := range privileges {
+		if p.Resource.DB == nil || p.Resource.Collection == nil {
+			continue // Cluster or other non-collection resource
+		}
+		dbMatches := *p.Resource.DB == "" || *p.Resource.DB == db
+		collectionMatches := *p.Resource.Collection == "" || *p.Resource.Collection == collection
+		if !dbMatches || !collectionMatches {
+			continue
+		}
+		for _, action := range p.Actions {
+			if action == "insert" {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no insert privilege on %s.%s", db, collection)
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,118 @@
+package main
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// Validation actions: reject documents that fail the validator, or only
+// log them on the server
+const (
+	validationActionError = "error"
+	validationActionWarn  = "warn"
+)
+
+// BSON type times are stored as under the BSON_TIME_FORMAT
+func timeBSONType(timeFormat string) string {
+	switch timeFormat {
+	case timeFormatRFC3339:
+		return "string"
+	case timeFormatUnix, timeFormatUnixMs:
+		return "long"
+	}
+	return "date"
+}
+
+// A property of one BSON type, or null as null tokens store
+func nullable(bsonType string) bson.D {
+	return bson.D{{Key: "bsonType", Value: bson.A{bsonType, "null"}}}
+}
+
+// $jsonSchema validator for Places: placeId is required, every other field
+// has its type when present, and fields the mapping doesn't know, such as
+// computed ones, are allowed
+func placeValidator(geo []geoColumn, timeFormat string) bson.D {
+	properties := bson.D{{Key: "placeId", Value: bson.D{{Key: "bsonType", Value: "string"}}}}
+	for _, field := range []string{"address", "version", "plusCode", "city", "division", "district", "postalCode", "sublocality", "localArea"} {
+		properties = append(properties, bson.E{Key: field, Value: nullable("string")})
+	}
+	properties = append(properties,
+		bson.E{Key: "isAutoCompleteAddress", Value: nullable("bool")},
+		bson.E{Key: "types", Value: bson.D{{Key: "bsonType", Value: bson.A{"array", "null"}}, {Key: "items", Value: bson.D{{Key: "bsonType", Value: "string"}}}}},
+		bson.E{Key: "suggestions", Value: bson.D{{Key: "bsonType", Value: "array"}}},
+		bson.E{Key: "reviews", Value: bson.D{{Key: "bsonType", Value: "array"}}},
+		bson.E{Key: "mergedAt", Value: nullable(timeBSONType(timeFormat))},
+		bson.E{Key: "isMerged", Value: bson.D{{Key: "bsonType", Value: "bool"}}},
+	)
+
+	coordinates := bson.D{
+		{Key: "bsonType", Value: "array"},
+		{Key: "minItems", Value: 2},
+		{Key: "maxItems", Value: 2},
+		{Key: "items", Value: bson.D{{Key: "bsonType", Value: "double"}}},
+	}
+	for _, g := range geo {
+		switch g.Format {
+		case geoFormatGeoJSON:
+			properties = append(properties, bson.E{Key: g.Field, Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"object", "null"}},
+				{Key: "required", Value: bson.A{"type", "coordinates"}},
+				{Key: "properties", Value: bson.D{
+					{Key: "type", Value: bson.D{{Key: "enum", Value: bson.A{"Point"}}}},
+					{Key: "coordinates", Value: coordinates},
+				}},
+			}})
+		case geoFormatPair:
+			pair := append(bson.D{}, coordinates...)
+			pair[0].Value = bson.A{"array", "null"}
+			properties = append(properties, bson.E{Key: g.Field, Value: pair})
+		case geoFormatFields:
+			latitude, longitude := geoFieldNames(g.Field)
+			properties = append(properties,
+				bson.E{Key: latitude, Value: bson.D{{Key: "bsonType", Value: "double"}}},
+				bson.E{Key: longitude, Value: bson.D{{Key: "bsonType", Value: "double"}}},
+			)
+		}
+	}
+	return jsonSchemaValidator(bson.A{"placeId"}, properties)
+}
+
+// $jsonSchema validator for generic documents: each column's field has its
+// type, or is null, when present
+func documentValidator(schema documentSchema, timeFormat string) bson.D {
+	properties := bson.D{}
+	for i, name := range schema.names {
+		if schema.excluded[i] {
+			continue
+		}
+		var bsonType string
+		switch schema.types[i].Type {
+		case typeInt32:
+			bsonType = "int"
+		case typeInt64:
+			bsonType = "long"
+		case typeDouble:
+			bsonType = "double"
+		case typeBool:
+			bsonType = "bool"
+		case typeDate:
+			bsonType = timeBSONType(timeFormat)
+		case typeDecimal128:
+			bsonType = "decimal"
+		case typeArray:
+			bsonType = "array"
+		case typeObject, typeWKT:
+			bsonType = "object"
+		default:
+			bsonType = "string"
+		}
+		properties = append(properties, bson.E{Key: name, Value: nullable(bsonType)})
+	}
+	return jsonSchemaValidator(nil, properties)
+}
+
+func jsonSchemaValidator(required bson.A, properties bson.D) bson.D {
+	schema := bson.D{{Key: "bsonType", Value: "object"}}
+	if len(required) > 0 {
+		schema = append(schema, bson.E{Key: "required", Value: required})
+	}
+	schema = append(schema, bson.E{Key: "properties", Value: properties})
+	return bson.D{{Key: "$jsonSchema", Value: schema}}
+}
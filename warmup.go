@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Open n pooled connections before the first batch by pinging on all of
+// them at once, so connection setup and authentication don't land on the
+// first inserts
+func warmUpConnections(ctx context.Context, client *mongo.Client, n int) error {
+	ctx, span := tracer.Start(ctx, "mongo.warmup")
+	defer span.End()
+
+	start := time.Now()
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = client.Ping(ctx, readpref.Primary())
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return fmt.Errorf("warming up connections: %w", err)
+		}
+	}
+
+	slog.Info("Connections warmed up", "connections", n, "durationMs", time.Since(start).Milliseconds())
+	return nil
+}
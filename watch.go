@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Folder in the watched directory seeded files and their reports go to
+const watchDoneDir = "done"
+
+// Seed files matching the pattern as they arrive in the watched directory,
+// once they stop growing, and move them to done/ along with their reports.
+// A file that fails, or is only dry run, is left where it is and seeded
+// again if it changes. The post-import steps run after each file.
+func runWatch(cfg Config, postImport []postImportStep) error {
+	done := filepath.Join(cfg.Watch, watchDoneDir)
+	if err := os.MkdirAll(done, 0755); err != nil {
+		return err
+	}
+	slog.Info("Watching for files", "dir", cfg.Watch, "pattern", cfg.WatchPattern, "interval", cfg.WatchInterval)
+
+	// Files as of the last check, and those left in place as they were
+	var previous map[string]os.FileInfo
+	handled := map[string]os.FileInfo{}
+
+	ticker := time.NewTicker(cfg.WatchInterval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		matches, err := filepath.Glob(filepath.Join(cfg.Watch, cfg.WatchPattern))
+		if err != nil {
+			return err
+		}
+
+		current := make(map[string]os.FileInfo, len(matches))
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			current[path] = info
+
+			// Wait for a file to look the same twice before reading it, so
+			// one still being written isn't picked up part way
+			if last, ok := previous[path]; !ok || !sameFile(last, info) {
+				continue
+			}
+			if last, ok := handled[path]; ok && sameFile(last, info) {
+				continue
+			}
+			delete(handled, path)
+
+			if err := seedWatched(cfg, postImport, path, done); err != nil {
+				slog.Error("Error seeding watched file, it will be retried if it changes", "file", path, "error", err)
+				handled[path] = info
+			} else if cfg.DryRun {
+				handled[path] = info
+			}
+		}
+		previous = current
+	}
+}
+
+// Seed one watched file, writing its reports to done/, then move it there
+func seedWatched(cfg Config, postImport []postImportStep, path, done string) error {
+	cfg = cfg.forSource(path, filepath.Join(done, outputPrefix(filepath.Base(path))))
+	slog.Info("Seeding watched file", "file", path)
+	if err := processCSV(cfg); err != nil {
+		return err
+	}
+	if err := runPostImport(cfg, postImport); err != nil {
+		return err
+	}
+	if cfg.DryRun {
+		return nil
+	}
+
+	// The feed may drop a file of the same name again, to be seeded afresh
+	if err := clearCheckpoint(context.Background(), cfg, cfg.outputs.progress); err != nil {
+		return err
+	}
+	slog.Info("Watched file seeded", "file", path, "movedTo", done)
+	return os.Rename(path, filepath.Join(done, filepath.Base(path)))
+}
+
+func sameFile(a, b os.FileInfo) bool {
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+)
+
+// Functions available to WHERE expressions, whose columns are all strings
+var whereFunctions = map[string]govaluate.ExpressionFunction{
+	// Parse a column as a number, to compare it numerically
+	"number": func(args ...any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("number takes one argument")
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return args[0], nil
+		}
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+	},
+	"lower": func(args ...any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("lower takes one argument")
+		}
+		return strings.ToLower(fmt.Sprint(args[0])), nil
+	},
+}
+
+// rowFilter keeps the rows a WHERE expression is true for, e.g.
+// country == "Bangladesh" && postalCode != ""
+type rowFilter struct {
+	expr    *govaluate.EvaluableExpression
+	columns map[string]int
+}
+
+// Parse the expression, resolving its names as header names or else as
+// the Place fields the mapping maps to columns. Nil when where is empty.
+func newRowFilter(where string, header *Header, cols columns) (*rowFilter, error) {
+	if where == "" {
+		return nil, nil
+	}
+	expr, err := govaluate.NewEvaluableExpressionWithFunctions(where, whereFunctions)
+	if err != nil {
+		return nil, fmt.Errorf("WHERE %q: %w", where, err)
+	}
+
+	f := &rowFilter{expr: expr, columns: map[string]int{}}
+	for _, name := range expr.Vars() {
+		i, ok := header.Index(name)
+		if !ok {
+			i, ok = cols[name]
+		}
+		if !ok {
+			return nil, fmt.Errorf("WHERE %q: no column %q", where, name)
+		}
+		f.columns[name] = i
+	}
+	return f, nil
+}
+
+// Whether the row matches the expression
+func (f *rowFilter) keep(record []string) (bool, error) {
+	result, err := f.expr.Eval(rowParameters{columns: f.columns, record: record})
+	if err != nil {
+		return false, &rowError{Kind: "where_error", Err: err}
+	}
+	keep, ok := result.(bool)
+	if !ok {
+		return false, &rowError{Kind: "where_error", Err: fmt.Errorf("WHERE gave %v, not true or false", result)}
+	}
+	return keep, nil
+}
+
+// rowParameters looks up a row's values for an expression
+type rowParameters struct {
+	columns map[string]int
+	record  []string
+}
+
+func (p rowParameters) Get(name string) (any, error) {
+	i, ok := p.columns[name]
+	if !ok {
+		return nil, fmt.Errorf("no column %q", name)
+	}
+	if i >= len(p.record) {
+		return "", nil
+	}
+	return p.record[i], nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// WKT geometry types, their GeoJSON names and how deeply their lists of
+// positions nest: 0 for one list, 1 for a list of them and so on
+var wktGeometries = map[string]struct {
+	name  string
+	depth int
+}{
+	"POINT":           {"Point", 0},
+	"LINESTRING":      {"LineString", 0},
+	"POLYGON":         {"Polygon", 1},
+	"MULTIPOINT":      {"MultiPoint", 0},
+	"MULTILINESTRING": {"MultiLineString", 1},
+	"MULTIPOLYGON":    {"MultiPolygon", 2},
+}
+
+// Parse a WKT geometry, e.g. "POLYGON ((90.3 23.7, 90.5 23.7, 90.4 23.9, 90.3 23.7))",
+// into a GeoJSON geometry. An EWKT SRID prefix is dropped and only x and y
+// are kept from Z and M coordinates. EMPTY geometries are nil.
+func parseWKT(value string) (bson.D, error) {
+	text := strings.TrimSpace(value)
+	if strings.HasPrefix(strings.ToUpper(text), "SRID=") {
+		if i := strings.IndexByte(text, ';'); i >= 0 {
+			text = strings.TrimSpace(text[i+1:])
+		}
+	}
+
+	open := strings.IndexByte(text, '(')
+	head := strings.Fields(strings.ToUpper(text))
+	if open >= 0 {
+		head = strings.Fields(strings.ToUpper(text[:open]))
+	}
+	if len(head) == 0 {
+		return nil, fmt.Errorf("%q is not WKT", value)
+	}
+	geometry, ok := wktGeometries[head[0]]
+	if !ok {
+		return nil, fmt.Errorf("%q is not a supported WKT geometry", value)
+	}
+	for _, word := range head[1:] {
+		switch word {
+		case "Z", "M", "ZM":
+		case "EMPTY":
+			if open < 0 {
+				return nil, nil
+			}
+			fallthrough
+		default:
+			return nil, fmt.Errorf("%q is not WKT", value)
+		}
+	}
+	if open < 0 {
+		return nil, fmt.Errorf("%q is not WKT", value)
+	}
+
+	p := &wktParser{text: text[open:]}
+	coordinates, err := p.list(geometry.depth, head[0] == "MULTIPOINT")
+	if err == nil {
+		p.skipSpace()
+		if p.pos < len(p.text) {
+			err = fmt.Errorf("unexpected %q", p.text[p.pos:])
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%q is not valid WKT: %w", value, err)
+	}
+	if geometry.name == "Point" {
+		// A point's list holds its one position
+		points := coordinates.(bson.A)
+		if len(points) != 1 {
+			return nil, fmt.Errorf("%q is not valid WKT: a point has one position", value)
+		}
+		coordinates = points[0]
+	}
+	if err := checkRings(geometry.name, coordinates); err != nil {
+		return nil, fmt.Errorf("%q is not a valid %s: %w", value, geometry.name, err)
+	}
+	return bson.D{{Key: "type", Value: geometry.name}, {Key: "coordinates", Value: coordinates}}, nil
+}
+
+// wktParser reads the parenthesized coordinates of a WKT geometry
+type wktParser struct {
+	text string
+	pos  int
+}
+
+func (p *wktParser) skipSpace() {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// Whether the next character is c, consuming it if so
+func (p *wktParser) accept(c byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.text) && p.text[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// Read a parenthesized, comma-separated list of positions, or of lists
+// nested depth deep. Multipoints may wrap each position in parentheses.
+func (p *wktParser) list(depth int, wrappedPoints bool) (any, error) {
+	if !p.accept('(') {
+		return nil, fmt.Errorf("expected ( at %d", p.pos)
+	}
+	var items bson.A
+	for {
+		var item any
+		var err error
+		switch {
+		case depth > 0:
+			item, err = p.list(depth-1, false)
+		case wrappedPoints && p.accept('('):
+			item, err = p.position()
+			if err == nil && !p.accept(')') {
+				err = fmt.Errorf("expected ) at %d", p.pos)
+			}
+		default:
+			item, err = p.position()
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		if p.accept(')') {
+			return items, nil
+		}
+		if !p.accept(',') {
+			return nil, fmt.Errorf("expected , or ) at %d", p.pos)
+		}
+	}
+}
+
+// Read one position, "x y" with optional z and m, as [x, y]
+func (p *wktParser) position() (bson.A, error) {
+	var numbers []float64
+	for {
+		p.skipSpace()
+		start := p.pos
+		for p.pos < len(p.text) && strings.IndexByte(" \t\r\n,()", p.text[p.pos]) < 0 {
+			p.pos++
+		}
+		if start == p.pos {
+			break
+		}
+		n, err := strconv.ParseFloat(p.text[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinate %q", p.text[start:p.pos])
+		}
+		numbers = append(numbers, n)
+	}
+	if len(numbers) < 2 || len(numbers) > 4 {
+		return nil, fmt.Errorf("a position has 2 to 4 coordinates, got %d", len(numbers))
+	}
+	if numbers[0] < -180 || numbers[0] > 180 || numbers[1] < -90 || numbers[1] > 90 {
+		return nil, fmt.Errorf("position %v %v out of range", numbers[0], numbers[1])
+	}
+	return bson.A{numbers[0], numbers[1]}, nil
+}
+
+// Check polygon rings are closed and have at least four positions, which
+// a 2dsphere index requires
+func checkRings(name string, coordinates any) error {
+	var polygons []bson.A
+	switch name {
+	case "Polygon":
+		polygons = []bson.A{coordinates.(bson.A)}
+	case "MultiPolygon":
+		for _, polygon := range coordinates.(bson.A) {
+			polygons = append(polygons, polygon.(bson.A))
+		}
+	}
+	for _, rings := range polygons {
+		for _, ring := range rings {
+			positions := ring.(bson.A)
+			if len(positions) < 4 {
+				return fmt.Errorf("a ring needs at least 4 positions, got %d", len(positions))
+			}
+			first, last := positions[0].(bson.A), positions[len(positions)-1].(bson.A)
+			if first[0] != last[0] || first[1] != last[1] {
+				return fmt.Errorf("ring is not closed")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseWKT(t *testing.T) {
+	square := bson.A{bson.A{bson.A{90.3, 23.7}, bson.A{90.5, 23.7}, bson.A{90.4, 23.9}, bson.A{90.3, 23.7}}}
+	tests := []struct {
+		value string
+		want  bson.D // nil for an EMPTY geometry
+		err   bool
+	}{
+		{value: "POINT (90.4 23.8)", want: bson.D{{Key: "type", Value: "Point"}, {Key: "coordinates", Value: bson.A{90.4, 23.8}}}},
+		{value: "point(90.4 23.8)", want: bson.D{{Key: "type", Value: "Point"}, {Key: "coordinates", Value: bson.A{90.4, 23.8}}}},
+		{value: "SRID=4326;POINT Z (90.4 23.8 12)", want: bson.D{{Key: "type", Value: "Point"}, {Key: "coordinates", Value: bson.A{90.4, 23.8}}}},
+		{value: "POINT ZM (90.4 23.8 12 3)", want: bson.D{{Key: "type", Value: "Point"}, {Key: "coordinates", Value: bson.A{90.4, 23.8}}}},
+		{value: "LINESTRING (90.3 23.7, 90.5 23.9)", want: bson.D{{Key: "type", Value: "LineString"}, {Key: "coordinates", Value: bson.A{bson.A{90.3, 23.7}, bson.A{90.5, 23.9}}}}},
+		{value: "POLYGON ((90.3 23.7, 90.5 23.7, 90.4 23.9, 90.3 23.7))", want: bson.D{{Key: "type", Value: "Polygon"}, {Key: "coordinates", Value: square}}},
+		{value: "MULTIPOINT ((90.3 23.7), (90.5 23.9))", want: bson.D{{Key: "type", Value: "MultiPoint"}, {Key: "coordinates", Value: bson.A{bson.A{90.3, 23.7}, bson.A{90.5, 23.9}}}}},
+		{value: "MULTIPOINT (90.3 23.7, 90.5 23.9)", want: bson.D{{Key: "type", Value: "MultiPoint"}, {Key: "coordinates", Value: bson.A{bson.A{90.3, 23.7}, bson.A{90.5, 23.9}}}}},
+		{value: "MULTIPOLYGON (((90.3 23.7, 90.5 23.7, 90.4 23.9, 90.3 23.7)))", want: bson.D{{Key: "type", Value: "MultiPolygon"}, {Key: "coordinates", Value: bson.A{square}}}},
+		{value: "POINT EMPTY"},
+		{value: "POLYGON EMPTY"},
+
+		// Unclosed and short rings
+		{value: "POLYGON ((90.3 23.7, 90.5 23.7, 90.4 23.9, 90.3 23.8))", err: true},
+		{value: "POLYGON ((90.3 23.7, 90.5 23.7, 90.3 23.7))", err: true},
+		{value: "POLYGON ((90.3 23.7, 90.5 23.7, 90.4 23.9, 90.3 23.7), (90.35 23.75, 90.45 23.75, 90.4 23.8, 90.36 23.75))", err: true},
+		{value: "MULTIPOLYGON (((90.3 23.7, 90.5 23.7, 90.4 23.9, 90.3 23.7)), ((91 24, 92 24, 91.5 25, 91 24.5)))", err: true},
+
+		// Malformed
+		{value: "", err: true},
+		{value: "CIRCLE (90.4 23.8)", err: true},
+		{value: "POINT", err: true},
+		{value: "POINT (90.4)", err: true},
+		{value: "POINT (90.4 23.8, 90.5 23.9)", err: true},
+		{value: "POINT (90.4 abc)", err: true},
+		{value: "POINT (190 23.8)", err: true},
+		{value: "POINT (90.4 23.8", err: true},
+		{value: "POINT (90.4 23.8) extra", err: true},
+		{value: "POINT EMPTY (90.4 23.8)", err: true},
+		{value: "POLYGON (90.3 23.7, 90.5 23.7, 90.4 23.9, 90.3 23.7)", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseWKT(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseWKT(%q) = %v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseWKT(%q): %v", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseWKT(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// How ID_FIELD values become the _id
+const (
+	idTypeString   = "string"
+	idTypeObjectID = "objectid"
+)
+
+// Write modes
+const (
+	writeModeInsert  = "insert"
+	writeModeUpsert  = "upsert"
+	writeModeNew     = "new"
+	writeModeRefresh = "refresh"
+	writeModeUpdate  = "update"
+)
+
+// Fields of a Place that don't come from the CSV, and the immutable _id,
+// left alone by updates
+var generatedFields = map[string]bool{"_id": true, "placeId": true, "suggestions": true, "reviews": true, "isMerged": true}
+
+// Write a batch of documents. Insert adds new documents, as does new once
+// those already stored are dropped; upsert replaces the document with the
+// same placeId, or _id when ID_FIELD sets it, or inserts it, as does
+// refresh once those whose row hash is unchanged are dropped; update sets
+// the fields of the document with the same placeId or _id, returning how
+// many had none. Per-document failures come back as a
+// mongo.BulkWriteException. With an unacknowledged write concern nothing
+// comes back, so every document counts as written.
+func writeBatch(ctx context.Context, collection *mongo.Collection, mode string, batch []any) (int64, error) {
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if mode == writeModeInsert || mode == writeModeNew {
+		_, err := collection.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false))
+		return 0, unacknowledged(err)
+	}
+
+	models, err := writeModels(mode, batch)
+	if err != nil {
+		return 0, err
+	}
+	result, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if mode != writeModeUpdate {
+		return 0, unacknowledged(err)
+	}
+	if result == nil || errors.Is(err, mongo.ErrUnacknowledgedWrite) {
+		return 0, unacknowledged(err)
+	}
+	failed := 0
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) {
+		failed = len(bulkErr.WriteErrors)
+	}
+	return int64(len(batch)-failed) - result.MatchedCount, err
+}
+
+// The bulk write models for a batch in upsert, refresh or update mode:
+// replacing each document, or inserting it, or setting its fields
+func writeModels(mode string, batch []any) ([]mongo.WriteModel, error) {
+	models := make([]mongo.WriteModel, len(batch))
+	for i, doc := range batch {
+		if mode != writeModeUpdate {
+			models[i] = mongo.NewReplaceOneModel().
+				SetFilter(documentKey(doc)).
+				SetReplacement(doc).
+				SetUpsert(true)
+			continue
+		}
+		fields, err := updateFields(doc, documentPlaceID(doc))
+		if err != nil {
+			return nil, err
+		}
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(documentKey(doc)).
+			SetUpdate(bson.D{{Key: "$set", Value: fields}})
+	}
+	return models, nil
+}
+
+// A write error, nil for the one an unacknowledged write comes back with
+func unacknowledged(err error) error {
+	if errors.Is(err, mongo.ErrUnacknowledgedWrite) {
+		return nil
+	}
+	return err
+}
+
+// Run fn in a transaction, committed only if it succeeds. fn is run again
+// when the transaction hits a transient error, so must be idempotent.
+func inTransaction(ctx context.Context, client *mongo.Client, fn func(ctx context.Context) error) error {
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+// The fields an update sets: those of the document as it would be stored,
+// except placeId, fields the file has no column for and an unset mergedAt.
+// Without any left, placeId is set to itself, as $set can't be empty.
+func updateFields(doc any, placeID any) (bson.D, error) {
+	data, err := bson.MarshalWithRegistry(bsonRegistry, doc)
+	if err != nil {
+		return nil, err
+	}
+	var stored bson.D
+	if err := bson.UnmarshalWithRegistry(bsonRegistry, data, &stored); err != nil {
+		return nil, err
+	}
+
+	fields := make(bson.D, 0, len(stored)+1)
+	autoComplete := false
+	for _, e := range stored {
+		if generatedFields[e.Key] || (e.Key == "mergedAt" && e.Value == nil) {
+			continue
+		}
+		autoComplete = autoComplete || e.Key == "isAutoCompleteAddress"
+		fields = append(fields, e)
+	}
+	// Omitting empty fields drops a false isAutoCompleteAddress the row sets
+	if place, ok := doc.(*Place); ok && !autoComplete && !slices.Contains(place.omitFields, "isAutoCompleteAddress") && place.nullFields["isAutoCompleteAddress"] == "" {
+		fields = append(fields, bson.E{Key: "isAutoCompleteAddress", Value: place.IsAutoCompleteAddress})
+	}
+	if len(fields) == 0 {
+		fields = bson.D{{Key: "placeId", Value: placeID}}
+	}
+	return fields, nil
+}
+
+// Fields of a correction row left alone with BSON_OMIT_EMPTY, beyond the
+// empty ones it drops: isAutoCompleteAddress when its cell is blank, as
+// false would be set otherwise, and geo fields whose coordinates are both
+// blank, which would otherwise drop the stored location
+func blankUpdateFields(cols columns, geo []geoColumn, record []string) []string {
+	var fields []string
+	if _, ok := cols["isAutoCompleteAddress"]; ok && strings.TrimSpace(cols.get(record, "isAutoCompleteAddress")) == "" {
+		fields = append(fields, "isAutoCompleteAddress")
+	}
+	for _, g := range geo {
+		if blank(record, g.latitude) && blank(record, g.longitude) {
+			fields = append(fields, g.Field)
+		}
+	}
+	return fields
+}
+
+// Whether the record's cell at i is missing or blank
+func blank(record []string, i int) bool {
+	return i >= len(record) || strings.TrimSpace(record[i]) == ""
+}
+
+// PlaceIDs of the batch already in the collection, with the row hash stored
+// in hashField if it is set
+func storedRowHashes(ctx context.Context, collection *mongo.Collection, batch []any, hashField string) (map[any]string, error) {
+	var placeIDs bson.A
+	for _, doc := range batch {
+		if placeID := documentPlaceID(doc); placeID != nil {
+			placeIDs = append(placeIDs, placeID)
+		}
+	}
+	stored := map[any]string{}
+	if len(placeIDs) == 0 {
+		return stored, nil
+	}
+
+	projection := bson.D{{Key: "_id", Value: 0}, {Key: "placeId", Value: 1}}
+	if hashField != "" {
+		projection = append(projection, bson.E{Key: hashField, Value: 1})
+	}
+	cursor, err := collection.Find(ctx,
+		bson.D{{Key: "placeId", Value: bson.D{{Key: "$in", Value: placeIDs}}}},
+		options.Find().SetProjection(projection),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		hash, _ := doc[hashField].(string)
+		stored[doc["placeId"]] = hash
+	}
+	return stored, cursor.Err()
+}
+
+// Drop the documents of a batch, and their records, that new mode finds
+// stored, by placeId, or refresh mode finds stored with the same row hash,
+// returning what is left and how many were dropped
+func dropStored(mode, hashField string, stored map[any]string, batch []any, records [][]string) ([]any, [][]string, int) {
+	kept := 0
+	for i, doc := range batch {
+		hash, found := stored[documentPlaceID(doc)]
+		if found && (mode == writeModeNew || hash == documentRowHash(doc, hashField)) {
+			continue
+		}
+		batch[kept], records[kept] = doc, records[i]
+		kept++
+	}
+	return batch[:kept], records[:kept], len(batch) - kept
+}
+
+// PlaceID of a batch document, the placeId field of an inferred one
+func documentPlaceID(doc any) any {
+	switch doc := doc.(type) {
+	case *Place:
+		return doc.PlaceID
+	case bson.D:
+		for _, e := range doc {
+			if e.Key == "placeId" {
+				return e.Value
+			}
+		}
+	}
+	return nil
+}
+
+// Filter matching the stored copy of a batch document: its _id when it
+// has one, else its placeId
+func documentKey(doc any) bson.D {
+	var id any
+	switch doc := doc.(type) {
+	case *Place:
+		id = doc.Extra["_id"]
+	case bson.D:
+		for _, e := range doc {
+			if e.Key == "_id" {
+				id = e.Value
+			}
+		}
+	}
+	if id != nil {
+		return bson.D{{Key: "_id", Value: id}}
+	}
+	return bson.D{{Key: "placeId", Value: documentPlaceID(doc)}}
+}
+
+// Row hash stored in a batch document's field
+func documentRowHash(doc any, field string) string {
+	var value any
+	switch doc := doc.(type) {
+	case *Place:
+		value = doc.Extra[field]
+	case bson.D:
+		for _, e := range doc {
+			if e.Key == field {
+				value = e.Value
+			}
+		}
+	}
+	hash, _ := value.(string)
+	return hash
+}
+
+// Add a field to a batch document, returning the document
+func setDocumentField(doc any, key string, value any) any {
+	switch d := doc.(type) {
+	case *Place:
+		if d.Extra == nil {
+			d.Extra = map[string]any{}
+		}
+		d.Extra[key] = value
+	case bson.D:
+		return append(d, bson.E{Key: key, Value: value})
+	}
+	return doc
+}
+
+// ObjectID derived from a key, the same for the same key in every run and
+// environment. Its timestamp bytes come from the hash, so mean nothing.
+func keyObjectID(key string) primitive.ObjectID {
+	sum := sha256.Sum256([]byte(key))
+	var id primitive.ObjectID
+	copy(id[:], sum[:])
+	return id
+}
+
+// Hash of a source row, to tell when it changes between imports
+func rowHash(record []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(record, "\x1f")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Places in a batch
+func batchPlaces(batch []any) []*Place {
+	places := make([]*Place, 0, len(batch))
+	for _, doc := range batch {
+		if place, ok := doc.(*Place); ok {
+			places = append(places, place)
+		}
+	}
+	return places
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestUpdateFields(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    []string
+		record    []string
+		mapping   Mapping
+		omitEmpty bool
+		want      bson.D
+	}{
+		{
+			name:   "two columns",
+			header: []string{"placeId", "address"},
+			record: []string{"p1", "1 New Road"},
+			want:   bson.D{{Key: "address", Value: "1 New Road"}},
+		},
+		{
+			name:   "columns out of the default order",
+			header: []string{"city", "placeId"},
+			record: []string{"Dhaka", "p1"},
+			want:   bson.D{{Key: "city", Value: "Dhaka"}},
+		},
+		{
+			name:    "mapped column",
+			header:  []string{"placeId", "town"},
+			record:  []string{"p1", "Sylhet"},
+			mapping: Mapping{Fields: map[string]string{"city": "town"}},
+			want:    bson.D{{Key: "city", Value: "Sylhet"}},
+		},
+		{
+			name:   "coordinates",
+			header: []string{"placeId", "latitude", "longitude"},
+			record: []string{"p1", "23.8", "90.4"},
+			want:   bson.D{{Key: "location", Value: bson.D{{Key: "type", Value: "Point"}, {Key: "coordinates", Value: bson.A{90.4, 23.8}}}}},
+		},
+		{
+			name:   "one coordinate",
+			header: []string{"placeId", "address", "latitude"},
+			record: []string{"p1", "1 New Road", "23.8"},
+			want:   bson.D{{Key: "address", Value: "1 New Road"}},
+		},
+		{
+			name:   "empty cell",
+			header: []string{"placeId", "address", "city"},
+			record: []string{"p1", "1 New Road", ""},
+			want:   bson.D{{Key: "address", Value: "1 New Road"}, {Key: "city", Value: ""}},
+		},
+		{
+			name:      "empty cell with omitted empty fields",
+			header:    []string{"placeId", "address", "city"},
+			record:    []string{"p1", "1 New Road", ""},
+			omitEmpty: true,
+			want:      bson.D{{Key: "address", Value: "1 New Road"}},
+		},
+		{
+			name:      "false with omitted empty fields",
+			header:    []string{"placeId", "isAutoCompleteAddress"},
+			record:    []string{"p1", "false"},
+			omitEmpty: true,
+			want:      bson.D{{Key: "isAutoCompleteAddress", Value: false}},
+		},
+		{
+			name:      "blank with omitted empty fields",
+			header:    []string{"placeId", "isAutoCompleteAddress", "latitude", "longitude"},
+			record:    []string{"p1", " ", "", ""},
+			omitEmpty: true,
+			want:      bson.D{{Key: "placeId", Value: "p1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.omitEmpty {
+				registry, err := newBSONRegistry(Config{BSONOmitEmpty: true, BSONTimeFormat: timeFormatDate})
+				if err != nil {
+					t.Fatal(err)
+				}
+				saved := bsonRegistry
+				bsonRegistry = registry
+				defer func() { bsonRegistry = saved }()
+			}
+
+			header, err := newHeader(tt.header, duplicateHeadersRename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cols, err := tt.mapping.resolve(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cols.provided(header, tt.mapping)
+			geo, err := tt.mapping.resolveGeo(header, cols, GeoField{OnInvalid: geoInvalidKeep, Format: geoFormatGeoJSON})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Built as processCSV builds the places it updates
+			place := Place{
+				PlaceID:               cols.get(tt.record, "placeId"),
+				Address:               cols.get(tt.record, "address"),
+				IsAutoCompleteAddress: strings.ToLower(cols.get(tt.record, "isAutoCompleteAddress")) == "true",
+				Types:                 parseArrayFromColumn(cols.get(tt.record, "types")),
+				City:                  cols.get(tt.record, "city"),
+				Suggestions:           []any{},
+				Reviews:               []any{},
+			}
+			place.omitFields = cols.unprovided(geo)
+			if tt.omitEmpty {
+				place.omitFields = append(place.omitFields, blankUpdateFields(cols, geo, tt.record)...)
+			}
+			if _, err := setGeoFields(&place, geo, tt.record); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := updateFields(&place, place.PlaceID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("updateFields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteModels(t *testing.T) {
+	place := func() *Place {
+		return &Place{PlaceID: "p1", Address: "1 New Road", Types: []string{"road"}, Suggestions: []any{}, Reviews: []any{}}
+	}
+	withID := place()
+	withID.Extra = map[string]any{"_id": "p1"}
+	generic := bson.D{{Key: "placeId", Value: "g1"}, {Key: "name", Value: "Gulshan"}}
+
+	tests := []struct {
+		name   string
+		mode   string
+		doc    any
+		filter bson.D
+		set    []string // Keys an update sets, nil for a replacement
+	}{
+		{name: "upsert", mode: writeModeUpsert, doc: place(), filter: bson.D{{Key: "placeId", Value: "p1"}}},
+		{name: "upsert by _id", mode: writeModeUpsert, doc: withID, filter: bson.D{{Key: "_id", Value: "p1"}}},
+		{name: "refresh", mode: writeModeRefresh, doc: generic, filter: bson.D{{Key: "placeId", Value: "g1"}}},
+		{
+			name:   "update",
+			mode:   writeModeUpdate,
+			doc:    place(),
+			filter: bson.D{{Key: "placeId", Value: "p1"}},
+			set:    []string{"address", "version", "isAutoCompleteAddress", "types", "plusCode", "city", "division", "district", "postalCode", "sublocality", "localArea", "location"},
+		},
+		{name: "update generic", mode: writeModeUpdate, doc: generic, filter: bson.D{{Key: "placeId", Value: "g1"}}, set: []string{"name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			models, err := writeModels(tt.mode, []any{tt.doc})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(models) != 1 {
+				t.Fatalf("got %d models, want 1", len(models))
+			}
+
+			if tt.set == nil {
+				replace, ok := models[0].(*mongo.ReplaceOneModel)
+				if !ok {
+					t.Fatalf("model = %T, want a replacement", models[0])
+				}
+				if !reflect.DeepEqual(replace.Filter, tt.filter) || !reflect.DeepEqual(replace.Replacement, tt.doc) || replace.Upsert == nil || !*replace.Upsert {
+					t.Errorf("replacement = %+v, want an upsert of the document by %v", replace, tt.filter)
+				}
+				return
+			}
+
+			update, ok := models[0].(*mongo.UpdateOneModel)
+			if !ok {
+				t.Fatalf("model = %T, want an update", models[0])
+			}
+			if !reflect.DeepEqual(update.Filter, tt.filter) || update.Upsert != nil {
+				t.Errorf("update filter = %v with upsert %v, want %v without", update.Filter, update.Upsert, tt.filter)
+			}
+			fields := update.Update.(bson.D)[0].Value.(bson.D)
+			var keys []string
+			for _, e := range fields {
+				keys = append(keys, e.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.set) {
+				t.Errorf("update sets %v, want %v", keys, tt.set)
+			}
+		})
+	}
+}
+
+func TestDropStored(t *testing.T) {
+	doc := func(placeID, hash string) any {
+		return &Place{PlaceID: placeID, Extra: map[string]any{"rowHash": hash}}
+	}
+	tests := []struct {
+		name   string
+		mode   string
+		stored map[any]string
+		want   []string
+	}{
+		{name: "new, none stored", mode: writeModeNew, stored: map[any]string{}, want: []string{"p1", "p2", "p3"}},
+		{name: "new, some stored", mode: writeModeNew, stored: map[any]string{"p1": "", "p3": ""}, want: []string{"p2"}},
+		{name: "new, all stored", mode: writeModeNew, stored: map[any]string{"p1": "", "p2": "", "p3": ""}, want: []string{}},
+		{name: "new, hashes ignored", mode: writeModeNew, stored: map[any]string{"p2": "changed"}, want: []string{"p1", "p3"}},
+		{name: "refresh, none stored", mode: writeModeRefresh, stored: map[any]string{}, want: []string{"p1", "p2", "p3"}},
+		{name: "refresh, unchanged", mode: writeModeRefresh, stored: map[any]string{"p1": "h1", "p2": "h2"}, want: []string{"p3"}},
+		{name: "refresh, changed", mode: writeModeRefresh, stored: map[any]string{"p1": "old", "p2": "h2"}, want: []string{"p1", "p3"}},
+		{name: "refresh, stored without a hash", mode: writeModeRefresh, stored: map[any]string{"p3": ""}, want: []string{"p1", "p2", "p3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch := []any{doc("p1", "h1"), doc("p2", "h2"), doc("p3", "h3")}
+			records := [][]string{{"p1"}, {"p2"}, {"p3"}}
+			kept, keptRecords, dropped := dropStored(tt.mode, "rowHash", tt.stored, batch, records)
+
+			got := []string{}
+			for i, doc := range kept {
+				got = append(got, documentPlaceID(doc).(string))
+				if keptRecords[i][0] != got[i] {
+					t.Errorf("document %s kept with the record of %s", got[i], keptRecords[i][0])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) || dropped != 3-len(tt.want) {
+				t.Errorf("kept %v, dropping %d, want %v", got, dropped, tt.want)
+			}
+		})
+	}
+}
+
+func TestRowHash(t *testing.T) {
+	base := rowHash([]string{"p1", "1 New Road", "Dhaka"})
+	tests := []struct {
+		name   string
+		record []string
+		same   bool
+	}{
+		{name: "same row", record: []string{"p1", "1 New Road", "Dhaka"}, same: true},
+		{name: "changed cell", record: []string{"p1", "2 New Road", "Dhaka"}},
+		{name: "cells split differently", record: []string{"p1", "1 New", "Road", "Dhaka"}},
+		{name: "cells joined", record: []string{"p1", "1 New RoadDhaka"}},
+		{name: "trailing empty cell", record: []string{"p1", "1 New Road", "Dhaka", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rowHash(tt.record); (got == base) != tt.same {
+				t.Errorf("rowHash(%q) = %s, base %s, want same = %v", tt.record, got, base, tt.same)
+			}
+		})
+	}
+
+	generic := bson.D{{Key: "placeId", Value: "g1"}, {Key: "rowHash", Value: base}}
+	if got := documentRowHash(generic, "rowHash"); got != base {
+		t.Errorf("documentRowHash of a generic document = %q, want %q", got, base)
+	}
+	place := setDocumentField(&Place{PlaceID: "p1"}, "rowHash", base)
+	if got := documentRowHash(place, "rowHash"); got != base {
+		t.Errorf("documentRowHash of a place = %q, want %q", got, base)
+	}
+}
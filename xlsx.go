@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// xlsxReader reads the rows of a worksheet, as text formatted the way
+// Excel shows it
+type xlsxReader struct {
+	book  *excelize.File
+	rows  *excelize.Rows
+	read  int64
+	width int // Of the header, shorter rows are padded to it
+}
+
+// If the input is an Excel workbook, by format or, in auto mode, by its
+// .xlsx extension, read the named sheet, or the first, instead. Workbooks
+// are loaded into memory whole; the sheet's rows are streamed.
+func (in *input) openSpreadsheet(format, source, sheet string) error {
+	if format != inputFormatXLSX && (format != inputFormatAuto || !strings.EqualFold(sourceExt(source), ".xlsx")) {
+		return nil
+	}
+
+	book, err := excelize.OpenReader(in.Reader)
+	if err != nil {
+		return fmt.Errorf("opening workbook: %w", err)
+	}
+	sheets := book.GetSheetList()
+	if sheet == "" && len(sheets) > 0 {
+		sheet = sheets[0]
+	}
+	if index, _ := book.GetSheetIndex(sheet); index < 0 {
+		book.Close()
+		return fmt.Errorf("sheet %q not found, the workbook has %s", sheet, strings.Join(sheets, ", "))
+	}
+	rows, err := book.Rows(sheet)
+	if err != nil {
+		book.Close()
+		return err
+	}
+
+	// Progress counts rows, out of those the sheet says it spans
+	in.size = 0
+	if dimension, err := book.GetSheetDimension(sheet); err == nil {
+		if _, last, ok := strings.Cut(dimension, ":"); ok {
+			if _, row, err := excelize.CellNameToCoordinates(last); err == nil {
+				in.size = int64(row)
+			}
+		}
+	}
+
+	in.table = &xlsxReader{book: book, rows: rows}
+	in.closers = append(in.closers, in.table)
+	in.format = inputFormatXLSX
+	in.encoding = encodingUTF8
+	return nil
+}
+
+// Read the next row, the first being the header. Empty rows are skipped.
+func (x *xlsxReader) Read() ([]string, error) {
+	for x.rows.Next() {
+		x.read++
+		record, err := x.rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		if len(record) == 0 {
+			continue
+		}
+		if x.width == 0 {
+			x.width = len(record)
+		}
+		if len(record) < x.width {
+			record = append(record, make([]string, x.width-len(record))...)
+		}
+		return record, nil
+	}
+	if err := x.rows.Error(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Rows read, standing in for a byte offset
+func (x *xlsxReader) InputOffset() int64 {
+	return x.read
+}
+
+func (x *xlsxReader) Close() error {
+	x.rows.Close()
+	return x.book.Close()
+}
+
+// Extension of a local path or URL path
+func sourceExt(source string) string {
+	if isURL(source) {
+		if u, err := url.Parse(source); err == nil {
+			return path.Ext(u.Path)
+		}
+	}
+	return path.Ext(source)
+}